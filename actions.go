@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+)
+
+// whether any action on duplicates was asked for, -exec and plugin actions included
+func acting() bool {
+	return actingBuiltIn() || execFlag != empty || len(actions) > 0
+}
+
+// whether duplicates are deleted, moved, tagged or linked by dup itself
+func actingBuiltIn() bool {
+	return deleteFlag || hardlinkFlag || reflinkFlag || moveToFlag != empty || tagFlag != empty || len(policyRules) > 0
+}
+
+// what is done to duplicates, for messages
+func actionName() string {
+	switch {
+	case !actingBuiltIn() && execFlag != empty:
+		return "run -exec on"
+	case !actingBuiltIn():
+		return "run plugin actions on"
+	case len(policyRules) > 0:
+		return "resolve by " + policyFileFlag
+	case deleteFlag:
+		return "delete"
+	case moveToFlag != empty:
+		return "move to " + moveToFlag
+	case tagFlag != empty:
+		return "tag as " + tagFlag
+	}
+	return "replace by links"
+}
+
+// act on duplicates of every group, keeping files as chosen by -keep or the -policy-file
+func actOnDups(dups []FileGroup) {
+	var done, skipped int
+	for _, g := range dups {
+		d, s := actOnGroup(g)
+		done += d
+		skipped += s
+	}
+	log.Printf("%d files handled (%s), %d left as they are\n", done, actionName(), skipped)
+}
+
+// delete, move or link all duplicates of group as resolved, return number of handled and
+// skipped files, links fall back reflink -> hardlink -> report-only per group when the
+// filesystem can't do better
+func actOnGroup(g FileGroup) (done int, skipped int) {
+	r, keptFiles, removed := resolve(g)
+	if len(removed) == 0 {
+		// no more copies than -keep-n
+		return 0, 0
+	}
+	if r.action == "report" {
+		return 0, len(removed)
+	}
+	mode := reportOnly
+	if r.action == "reflink" {
+		mode = reflinkMode
+	} else if r.action == "hardlink" {
+		mode = hardlinkMode
+	}
+	if len(keptFiles) == 0 {
+		log.Printf("skip group %s-%s: no file is kept\n", g.size, g.hash)
+		return 0, len(removed)
+	}
+	kept := keptFiles[0]
+	// every link of a collapsed file goes with it
+	removed = withLinks(removed)
+	for _, n := range g.notes {
+		log.Printf("group %s-%s: %s\n", g.size, g.hash, n)
+	}
+	if err := verifyGroup(g); err != nil {
+		log.Printf("skip group %s-%s: %v\n", g.size, g.hash, err)
+		return 0, len(removed)
+	}
+	ki, err := os.Stat(kept.path)
+	if err != nil {
+		log.Printf("skip group %s-%s: %v\n", g.size, g.hash, err)
+		return 0, len(removed)
+	}
+	var newest *metadata
+	if preserveFlag {
+		if newest, err = readMetadata(kept.path); err != nil {
+			log.Printf("can't read metadata of %s: %v\n", kept.path, err)
+		}
+	}
+	for _, f := range removed {
+		ok, linked := replaceable(ki, f)
+		if linked {
+			continue
+		}
+		if !ok {
+			skipped++
+			continue
+		}
+		var md *metadata
+		if preserveFlag {
+			if md, err = readMetadata(f.path); err != nil {
+				log.Printf("skip %s: can't read metadata: %v\n", f.path, err)
+				skipped++
+				continue
+			}
+		}
+		action, target := empty, kept.path
+		switch {
+		case r.action == "delete" && trashFlag:
+			action = "trash"
+			target, err = trash(f.path)
+		case r.action == "delete":
+			action, err = "delete", os.Remove(f.path)
+		case r.action == "move":
+			// told apart from moves of dup merge, which quarantine commands leave alone
+			action = "quarantine"
+			target, err = quarantine(f)
+		case r.action == "tag":
+			action, target = "tag", tagFlag
+			err = platformTag(f.path, tagFlag)
+		default:
+			action, err = linkFile(kept, f, &mode)
+		}
+		if err != nil {
+			log.Printf("skip %s: %v\n", f.path, err)
+			skipped++
+			continue
+		}
+		if action == reportOnly.String() {
+			skipped++
+			continue
+		}
+		log.Printf("%s %s -> %s\n", action, f.path, target)
+		if err = audit(action, f.path, target, f); err != nil {
+			log.Fatalf("can't write audit log: %v", err)
+		}
+		done++
+		if md != nil && (newest == nil || md.mtime.After(newest.mtime)) {
+			newest = md
+		}
+	}
+	// -reference files stay as they are, metadata included
+	if newest != nil && newest.path != kept.path && !isReference(kept.path) {
+		if err = newest.apply(kept.path); err != nil {
+			log.Printf("can't preserve metadata of %s on %s: %v\n", newest.path, kept.path, err)
+		}
+	}
+	return done, skipped
+}
+
+// whether duplicate f can be removed in favor of the kept file of ki, logging why
+// not; linked tells f is a hardlink of the kept file already, which needs nothing
+func replaceable(ki os.FileInfo, f FileDetail) (ok bool, linked bool) {
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		log.Printf("skip %s: %v\n", f.path, err)
+		return false, false
+	}
+	if who := heldOpen(f.path); who != empty {
+		log.Printf("skip %s: open by %s\n", f.path, who)
+		return false, false
+	}
+	if os.SameFile(ki, fi) {
+		return false, true
+	}
+	if streams, _ := altStreams(f.path); len(streams) > 0 && !adsFlag {
+		// replacing would silently drop e.g. Zone.Identifier, rerun with -ads to compare streams too
+		log.Printf("report-only %s: has alternate data streams %v\n", f.path, streams)
+		return false, false
+	}
+	return true, false
+}
+
+// replace f with a link to kept, degrading mode when the filesystem can't do it,
+// return the kind of link made
+func linkFile(kept, f FileDetail, mode *linkMode) (string, error) {
+	if f.extents != empty && f.extents == kept.extents {
+		log.Printf("report-only %s: already shares its extents with %s\n", f.path, kept.path)
+		return reportOnly.String(), nil
+	}
+	if same, err := sameDevice(kept.path, f.path); err != nil || !same {
+		log.Printf("report-only %s: not on the same device as %s\n", f.path, kept.path)
+		return reportOnly.String(), nil
+	}
+	for *mode > reportOnly {
+		err := replaceWithLink(kept.path, f.path, *mode)
+		if err == nil {
+			return mode.String(), nil
+		}
+		if !errors.Is(err, errNotSupported) && !unsupported(err) {
+			return empty, err
+		}
+		log.Printf("%s not supported for %s, falling back\n", *mode, f.path)
+		*mode--
+	}
+	log.Printf("report-only %s: can't be linked to %s\n", f.path, kept.path)
+	return reportOnly.String(), nil
+}
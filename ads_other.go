@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// alternate data streams only exist on NTFS
+func altStreams(path string) ([]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modkernel32          = syscall.NewLazyDLL("kernel32.dll")
+	procFindFirstStreamW = modkernel32.NewProc("FindFirstStreamW")
+	procFindNextStreamW  = modkernel32.NewProc("FindNextStreamW")
+)
+
+// WIN32_FIND_STREAM_DATA
+type win32FindStreamData struct {
+	StreamSize int64
+	StreamName [syscall.MAX_PATH + 36]uint16
+}
+
+// list alternate data streams of file, names are in ":name:$DATA" form and
+// can be appended to the file path to open the stream, the unnamed main
+// stream is not included
+func altStreams(path string) ([]string, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	var data win32FindStreamData
+	// 0 is FindStreamInfoStandard
+	h, _, e := procFindFirstStreamW.Call(uintptr(unsafe.Pointer(p)), 0, uintptr(unsafe.Pointer(&data)), 0)
+	if syscall.Handle(h) == syscall.InvalidHandle {
+		if e == syscall.ERROR_HANDLE_EOF {
+			return nil, nil
+		}
+		return nil, e
+	}
+	defer syscall.FindClose(syscall.Handle(h))
+	var names []string
+	for {
+		if name := syscall.UTF16ToString(data.StreamName[:]); name != "::$DATA" {
+			names = append(names, name)
+		}
+		if r, _, e := procFindNextStreamW.Call(h, uintptr(unsafe.Pointer(&data))); r == 0 {
+			if e == syscall.ERROR_HANDLE_EOF {
+				break
+			}
+			return names, e
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package main
+
+import "io/fs"
+
+// allocation is unknown, files count with their size
+func allocated(path string, fi fs.FileInfo) (int64, bool) {
+	return fi.Size(), false
+}
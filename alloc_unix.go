@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// bytes allocated on disk for the file, and whether that's less than its size
+func allocated(path string, fi fs.FileInfo) (int64, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fi.Size(), false
+	}
+	// st_blocks counts 512 byte units everywhere
+	alloc := int64(st.Blocks) * 512
+	return alloc, alloc < fi.Size()
+}
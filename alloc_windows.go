@@ -0,0 +1,31 @@
+package main
+
+import (
+	"io/fs"
+	"syscall"
+	"unsafe"
+)
+
+const fileAttributeSparseFile = 0x200
+
+var procGetCompressedFileSizeW = modkernel32.NewProc("GetCompressedFileSizeW")
+
+// bytes allocated on disk for the file, and whether that's less than its size,
+// only asked for files marked sparse
+func allocated(path string, fi fs.FileInfo) (int64, bool) {
+	attr, ok := fi.Sys().(*syscall.Win32FileAttributeData)
+	if !ok || attr.FileAttributes&fileAttributeSparseFile == 0 {
+		return fi.Size(), false
+	}
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return fi.Size(), false
+	}
+	var high uint32
+	low, _, e := procGetCompressedFileSizeW.Call(uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&high)))
+	if uint32(low) == 0xffffffff && e != syscall.Errno(0) {
+		return fi.Size(), false
+	}
+	alloc := int64(high)<<32 | int64(uint32(low))
+	return alloc, alloc < fi.Size()
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// write an editable plan of what to do with every file to this file instead of acting
+var planFlag string
+
+// what can be decided per file in a plan, linking goes to the first kept file of the group
+var planActions = map[string]bool{"keep": true, "delete": true, "trash": true, "hardlink": true, "reflink": true}
+
+// plan of dup -plan, as JSON, or as text when the file name doesn't end in .json
+type actionPlan struct {
+	Base      string      `json:"base"`
+	Algorithm string      `json:"algorithm"`
+	Groups    []planGroup `json:"groups"`
+}
+
+type planGroup struct {
+	Size  int64      `json:"size"`
+	Hash  string     `json:"hash"`
+	Files []planFile `json:"files"`
+}
+
+type planFile struct {
+	Action string    `json:"action"`
+	Path   string    `json:"path"`
+	Mtime  time.Time `json:"mtime,omitempty"`
+}
+
+// action the flags ask for on removed files, as written to the plan
+func plannedAction() (string, error) {
+	switch {
+	case moveToFlag != empty || tagFlag != empty:
+		return empty, errors.New("-plan can only plan -delete, -trash, -hardlink and -reflink")
+	case deleteFlag && trashFlag:
+		return "trash", nil
+	case reflinkFlag:
+		return "reflink", nil
+	case hardlinkFlag:
+		return "hardlink", nil
+	}
+	return "delete", nil
+}
+
+// write the plan for the groups, files -keep keeps are marked keep, the others get action,
+// paths are absolute so that the plan can be applied from anywhere
+func writePlan(path, dir string, dups []FileGroup, action string) error {
+	base, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	p := actionPlan{Base: base, Algorithm: hashFlag, Groups: []planGroup{}}
+	for _, g := range dups {
+		size, _ := strconv.ParseInt(g.size, 10, 64)
+		pg := planGroup{Size: size, Hash: g.hash}
+		kept, _ := keepFiles(g, keepFlag)
+		keep := make(map[string]bool)
+		for _, f := range kept {
+			keep[f.path] = true
+		}
+		for _, f := range g.files {
+			a := action
+			if keep[f.path] {
+				a = "keep"
+			}
+			for _, l := range withLinks([]FileDetail{f}) {
+				abs, err := filepath.Abs(l.path)
+				if err != nil {
+					return err
+				}
+				pg.Files = append(pg.Files, planFile{Action: a, Path: abs, Mtime: f.mtime})
+			}
+		}
+		p.Groups = append(p.Groups, pg)
+	}
+	var b []byte
+	if strings.HasSuffix(strings.ToLower(uncompressedName(path)), ".json") {
+		if b, err = json.MarshalIndent(p, empty, "  "); err != nil {
+			return err
+		}
+		b = append(b, '\n')
+	} else {
+		b = p.text()
+	}
+	if err = writeOutput(path, b); err != nil {
+		return err
+	}
+	log.Printf("plan for %d groups written to %s, edit it and run %s apply %s\n", len(dups), path, os.Args[0], path)
+	return nil
+}
+
+// text form of the plan, a line per file with its action, mtime if known and quoted path
+func (p actionPlan) text() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# dup plan for %s\n", p.Base)
+	b.WriteString("# Change the action in front of a file to keep, delete, trash, hardlink or reflink,\n")
+	b.WriteString("# links point to the first kept file of the group. Lines starting with # are ignored.\n")
+	fmt.Fprintf(&b, "algorithm %s\n", p.Algorithm)
+	for _, g := range p.Groups {
+		fmt.Fprintf(&b, "\ngroup %d %s\n", g.Size, g.Hash)
+		for _, f := range g.Files {
+			fmt.Fprintf(&b, "%-8s ", f.Action)
+			if !f.Mtime.IsZero() {
+				fmt.Fprintf(&b, "%s ", f.Mtime.Format(time.RFC3339Nano))
+			}
+			fmt.Fprintf(&b, "%s\n", strconv.Quote(f.Path))
+		}
+	}
+	return b.Bytes()
+}
+
+// read a plan in either form
+func readPlan(path string) (actionPlan, error) {
+	var p actionPlan
+	b, err := readInput(path)
+	if err != nil {
+		return p, err
+	}
+	if t := bytes.TrimSpace(b); len(t) > 0 && t[0] == '{' {
+		if err = json.Unmarshal(b, &p); err != nil {
+			return p, fmt.Errorf("%s: %v", path, err)
+		}
+	} else {
+		s := bufio.NewScanner(bytes.NewReader(b))
+		for n := 1; s.Scan(); n++ {
+			line := strings.TrimSpace(s.Text())
+			if line == empty || strings.HasPrefix(line, "#") {
+				continue
+			}
+			word, rest, _ := strings.Cut(line, " ")
+			// the action is padded, the path quoted
+			rest = strings.TrimLeft(rest, " ")
+			switch {
+			case word == "algorithm":
+				p.Algorithm = rest
+			case word == "group":
+				size, hash, _ := strings.Cut(rest, " ")
+				v, err := strconv.ParseInt(size, 10, 64)
+				if err != nil {
+					return p, fmt.Errorf("%s:%d: invalid group size %q", path, n, size)
+				}
+				p.Groups = append(p.Groups, planGroup{Size: v, Hash: strings.TrimSpace(hash)})
+			case len(p.Groups) == 0:
+				return p, fmt.Errorf("%s:%d: file before the first group", path, n)
+			default:
+				f := planFile{Action: word}
+				if !strings.HasPrefix(rest, `"`) {
+					mtime, quoted, _ := strings.Cut(rest, " ")
+					if f.Mtime, err = time.Parse(time.RFC3339Nano, mtime); err != nil {
+						return p, fmt.Errorf("%s:%d: invalid mtime %q", path, n, mtime)
+					}
+					rest = strings.TrimLeft(quoted, " ")
+				}
+				if f.Path, err = strconv.Unquote(rest); err != nil {
+					return p, fmt.Errorf("%s:%d: path must be quoted, as in %s", path, n, strconv.Quote(rest))
+				}
+				g := &p.Groups[len(p.Groups)-1]
+				g.Files = append(g.Files, f)
+			}
+		}
+	}
+	for _, g := range p.Groups {
+		for _, f := range g.Files {
+			if !planActions[f.Action] {
+				return p, fmt.Errorf("%s: unknown action %q for %s", path, f.Action, f.Path)
+			}
+		}
+	}
+	return p, nil
+}
+
+// dup apply: carry out the decisions of an edited plan
+func applyCmd(args []string) error {
+	flags := flag.NewFlagSet("apply", flag.ExitOnError)
+	dryRun := flags.Bool("n", false, "only tell what would be done")
+	flags.BoolVar(&forceFlag, "force", false, "apply without asking for confirmation, required when not running on a terminal")
+	flags.BoolVar(&allowRootFlag, "allow-root", false, "allow applying a plan for a filesystem root or the home directory")
+	flags.StringVar(&verifyFlag, "verify", "hash", "check files before acting on them: off, size (size and mtime unchanged) or hash (rehashed)")
+	flags.StringVar(&auditFlag, "audit-log", empty, "append every delete and link to this JSON lines file, default audit.jsonl in the state dir, off for none")
+	flags.StringVar(&stateDirFlag, "state-dir", empty, "state dir holding the default audit log")
+	flags.BoolVar(&preserveFlag, "preserve-metadata", false, "apply newest mtime, ownership, permissions and xattrs of removed duplicates to the kept file, as for dup -preserve-metadata")
+	flags.BoolVar(&skipOpenFlag, "skip-open", false, "leave files that SMB clients, by smbstatus, or local programs have open as they are")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s apply [flags] PLAN\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Does exactly what the plan written by dup -plan, and maybe edited since, says for every file.")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("PLAN must be given")
+	}
+	if err := validVerify(verifyFlag); err != nil {
+		return err
+	}
+	p, err := readPlan(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if p.Algorithm != empty {
+		hashFlag = p.Algorithm
+	}
+	if err = checkRoot(p.Base); err != nil {
+		return err
+	}
+
+	var files int
+	for _, g := range p.Groups {
+		for _, f := range g.Files {
+			if f.Action != "keep" {
+				files++
+			}
+		}
+	}
+	if *dryRun {
+		for _, g := range p.Groups {
+			for _, f := range g.Files {
+				if f.Action != "keep" {
+					fmt.Printf("%s %s\n", f.Action, f.Path)
+				}
+			}
+		}
+		return nil
+	}
+	if !forceFlag {
+		if !isTerminal(os.Stdin) {
+			return errors.New("not running interactively, add -force to apply the plan")
+		}
+		fmt.Fprintf(os.Stderr, tr("About to act on %d files in %d groups under %s\nType yes to continue: "), files, len(p.Groups), p.Base)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(answer) != "yes" {
+			return errors.New("aborted")
+		}
+	}
+	if auditFlag == empty {
+		if auditFlag, err = defaultAuditLog(); err != nil {
+			return err
+		}
+	}
+	if auditFlag != "off" {
+		if err = openAudit(auditFlag); err != nil {
+			return err
+		}
+		defer auditFile.Close()
+	}
+
+	var done, skipped int
+	for _, g := range p.Groups {
+		d, s := applyGroup(g)
+		done += d
+		skipped += s
+	}
+	log.Printf("%d files handled as planned, %d left as they are\n", done, skipped)
+	return nil
+}
+
+// act on the files of a planned group, return number of handled and skipped files
+func applyGroup(pg planGroup) (done int, skipped int) {
+	g := FileGroup{size: strconv.FormatInt(pg.Size, 10), hash: pg.Hash}
+	var kept *FileDetail
+	var acting int
+	for _, pf := range pg.Files {
+		g.files = append(g.files, FileDetail{path: pf.Path, size: pg.Size, mtime: pf.Mtime, hash: pg.Hash})
+		if pf.Action == "keep" && kept == nil {
+			kept = &g.files[len(g.files)-1]
+		} else if pf.Action != "keep" {
+			acting++
+		}
+	}
+	if acting == 0 {
+		return 0, 0
+	}
+	// every file is checked, also the kept ones the links point to
+	if kept == nil {
+		log.Printf("skip group %s-%s: no file is kept\n", g.size, g.hash)
+		return 0, acting
+	}
+	keeping := make(map[string]bool)
+	for _, pf := range pg.Files {
+		if pf.Action == "keep" {
+			keeping[checkpointKey(pf.Path)] = true
+		}
+	}
+	for _, pf := range pg.Files {
+		if pf.Action != "keep" && keeping[checkpointKey(pf.Path)] {
+			log.Printf("skip group %s-%s: %s is both kept and removed\n", g.size, g.hash, pf.Path)
+			return 0, acting
+		}
+	}
+	if err := verifyGroup(g); err != nil {
+		log.Printf("skip group %s-%s: %v\n", g.size, g.hash, err)
+		return 0, acting
+	}
+	ki, err := os.Stat(kept.path)
+	if err != nil {
+		log.Printf("skip group %s-%s: %v\n", g.size, g.hash, err)
+		return 0, acting
+	}
+	var newest *metadata
+	if preserveFlag {
+		if newest, err = readMetadata(kept.path); err != nil {
+			log.Printf("can't read metadata of %s: %v\n", kept.path, err)
+		}
+	}
+	for i, pf := range pg.Files {
+		f := g.files[i]
+		if pf.Action == "keep" {
+			continue
+		}
+		// a link of the kept file is left as it is, renaming a link over it would do nothing
+		ok, linked := replaceable(ki, f)
+		if linked {
+			continue
+		}
+		if !ok {
+			skipped++
+			continue
+		}
+		var md *metadata
+		if preserveFlag {
+			if md, err = readMetadata(f.path); err != nil {
+				log.Printf("skip %s: can't read metadata: %v\n", f.path, err)
+				skipped++
+				continue
+			}
+		}
+		target := kept.path
+		switch pf.Action {
+		case "delete":
+			err = os.Remove(f.path)
+		case "trash":
+			target, err = trash(f.path)
+		case "hardlink":
+			err = replaceWithLink(kept.path, f.path, hardlinkMode)
+		case "reflink":
+			err = replaceWithLink(kept.path, f.path, reflinkMode)
+		}
+		if err != nil {
+			log.Printf("skip %s: %v\n", f.path, err)
+			skipped++
+			continue
+		}
+		log.Printf("%s %s -> %s\n", pf.Action, f.path, target)
+		if err = audit(pf.Action, f.path, target, f); err != nil {
+			log.Fatalf("can't write audit log: %v", err)
+		}
+		done++
+		if md != nil && (newest == nil || md.mtime.After(newest.mtime)) {
+			newest = md
+		}
+	}
+	if newest != nil && newest.path != kept.path {
+		if err = newest.apply(kept.path); err != nil {
+			log.Printf("can't preserve metadata of %s on %s: %v\n", newest.path, kept.path, err)
+		}
+	}
+	return done, skipped
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// one line of the audit log
+type auditEntry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Source string    `json:"source"`
+	Target string    `json:"target,omitempty"`
+	Hash   string    `json:"hash"`
+	Size   int64     `json:"size"`
+}
+
+// audit log file, nil when -audit-log is not given
+var auditFile *os.File
+
+// open audit log for appending
+func openAudit(path string) error {
+	var err error
+	auditFile, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	return err
+}
+
+// record an action done on file source, target is the kept file if any
+func audit(action, source, target string, f FileDetail) error {
+	if auditFile == nil {
+		return nil
+	}
+	// one log serves all runs, relative paths would be ambiguous in there
+	source = checkpointKey(source)
+	if target != empty {
+		target = checkpointKey(target)
+	}
+	b, err := json.Marshal(auditEntry{Time: time.Now(), Action: action, Source: source, Target: target, Hash: f.hash, Size: f.size})
+	if err != nil {
+		return err
+	}
+	_, err = auditFile.Write(append(b, '\n'))
+	return err
+}
+
+// dup audit: query the audit log
+func auditCmd(args []string) error {
+	flags := flag.NewFlagSet("audit", flag.ExitOnError)
+	logFlag := flags.String("log", empty, "audit log file to read, default audit.jsonl in the state dir")
+	flags.StringVar(&stateDirFlag, "state-dir", empty, "state dir holding the default audit log")
+	actionFlag := flags.String("action", empty, "only show this action (delete, quarantine, move, copy, hardlink, reflink, purge, restore, exec, plugin)")
+	pathFlag := flags.String("path", empty, "only show entries whose source or target starts with this path")
+	sinceFlag := flags.String("since", empty, "only show entries since this time (RFC 3339 or a duration like 24h)")
+	jsonFlag := flags.Bool("json", false, "print matching entries as JSON lines")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s audit [-log file] [flags]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if *logFlag == empty {
+		var err error
+		if *logFlag, err = defaultAuditLog(); err != nil {
+			return err
+		}
+	}
+	var since time.Time
+	if *sinceFlag != empty {
+		if d, err := time.ParseDuration(*sinceFlag); err == nil {
+			since = time.Now().Add(-d)
+		} else if since, err = time.Parse(time.RFC3339, *sinceFlag); err != nil {
+			return fmt.Errorf("invalid -since %q", *sinceFlag)
+		}
+	}
+
+	f, err := os.Open(*logFlag)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var count int
+	var bytes int64
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*KB), int(1*MB))
+	for line := 1; s.Scan(); line++ {
+		var e auditEntry
+		if err = json.Unmarshal(s.Bytes(), &e); err != nil {
+			return fmt.Errorf("%s:%d: %v", *logFlag, line, err)
+		}
+		if *actionFlag != empty && e.Action != *actionFlag {
+			continue
+		}
+		if *pathFlag != empty && !strings.HasPrefix(e.Source, *pathFlag) && !strings.HasPrefix(e.Target, *pathFlag) {
+			continue
+		}
+		if e.Time.Before(since) {
+			continue
+		}
+		count++
+		bytes += e.Size
+		if *jsonFlag {
+			fmt.Println(s.Text())
+			continue
+		}
+		target := empty
+		if e.Target != empty {
+			target = " -> " + e.Target
+		}
+		fmt.Printf("%s %-8s %12s %s%s\n", e.Time.Format(time.RFC3339), e.Action, strconv.FormatInt(e.Size, 10), e.Source, target)
+	}
+	if err = s.Err(); err != nil {
+		return err
+	}
+	if !*jsonFlag {
+		fmt.Printf("%d entries, %d bytes\n", count, bytes)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// algorithms from the weakest to the most collision-resistant, for recommendations
+var hashStrength = []string{"crc32", "crc32c", "xxhash", "sha256", "blake3"}
+
+// dup bench: measure walking, reading and hashing on the actual data
+func benchCmd(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	sample := byteSize(256 * MB)
+	flags.Var(&sample, "sample", "read up to this much data of randomly picked files")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s bench [flags] DIR\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Measures walk rate, read throughput and hashing throughput per -hash algorithm on files of DIR, and recommends settings.")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("DIR must be given")
+	}
+	basedir = flags.Arg(0)
+
+	start := time.Now()
+	var fds []FileDetail
+	if err := recursiveReadDir(basedir, &fds); err != nil {
+		return err
+	}
+	walk := time.Since(start)
+	var total int64
+	for _, f := range fds {
+		total += f.size
+	}
+	fmt.Printf("walk:     %d files, %s in %v, %.0f files/s\n", len(fds), formatSize(total), walk.Round(time.Millisecond), float64(len(fds))/walk.Seconds())
+	if len(fds) == 0 {
+		return nil
+	}
+
+	// files spread over the tree, the same ones on every run
+	rand.New(rand.NewSource(1)).Shuffle(len(fds), func(i, j int) { fds[i], fds[j] = fds[j], fds[i] })
+	var data []byte
+	var files int
+	start = time.Now()
+	for _, f := range fds {
+		if int64(len(data)) >= int64(sample) {
+			break
+		}
+		fh, err := os.Open(f.path)
+		if err != nil {
+			log.Printf("skip %s: %v\n", f.path, err)
+			continue
+		}
+		b, err := io.ReadAll(io.LimitReader(fh, int64(sample)-int64(len(data))))
+		fh.Close()
+		if err != nil {
+			log.Printf("skip %s: %v\n", f.path, err)
+			continue
+		}
+		data = append(data, b...)
+		files++
+	}
+	read := rate(int64(len(data)), time.Since(start))
+	fmt.Printf("read:     %s of %d files, %s/s (files in the page cache read faster than the disk)\n", formatSize(int64(len(data))), files, formatSize(int64(read)))
+
+	rates := make(map[string]float64)
+	for _, name := range hashStrength {
+		h := hashers[name]()
+		start = time.Now()
+		for b := data; len(b) > 0; {
+			n := len(b)
+			if n > int(1*MB) {
+				n = int(1 * MB)
+			}
+			h.Write(b[:n])
+			b = b[n:]
+		}
+		rates[name] = rate(int64(len(data)), time.Since(start))
+		fmt.Printf("hash:     %-7s %s/s\n", name, formatSize(int64(rates[name])))
+	}
+
+	// strongest hash keeping up with the disk, else the fastest one
+	best := hashStrength[0]
+	for _, name := range hashStrength {
+		if rates[name] > rates[best] {
+			best = name
+		}
+	}
+	bound := "CPU"
+	if rates[best] > read {
+		bound = "storage"
+		for _, name := range hashStrength {
+			if rates[name] >= read {
+				best = name
+			}
+		}
+	}
+	speed := read
+	if rates[best] < speed {
+		speed = rates[best]
+	}
+	fmt.Printf("\nhashing is %s bound, recommended: -hash %s\n", bound, best)
+	fmt.Printf("hashing all %s fully would take about %v, the size and sample passes usually skip most of it\n",
+		formatSize(total), time.Duration(float64(total)/speed*float64(time.Second)).Round(time.Second))
+	return nil
+}
+
+// bytes per second
+func rate(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		d = time.Nanosecond
+	}
+	return float64(n) / d.Seconds()
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// BLAKE3 hashing mode with 32 byte output, after the reference implementation
+// at https://github.com/BLAKE3-team/BLAKE3/blob/master/reference_impl/reference_impl.rs
+const (
+	blake3BlockLen   = 64
+	blake3ChunkLen   = 1024
+	blake3ChunkStart = 1 << 0
+	blake3ChunkEnd   = 1 << 1
+	blake3Parent     = 1 << 2
+	blake3Root       = 1 << 3
+)
+
+var blake3IV = [8]uint32{0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19}
+
+var blake3Permutation = [16]int{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8}
+
+func blake3G(a, b, c, d, mx, my uint32) (uint32, uint32, uint32, uint32) {
+	a += b + mx
+	d = bits.RotateLeft32(d^a, -16)
+	c += d
+	b = bits.RotateLeft32(b^c, -12)
+	a += b + my
+	d = bits.RotateLeft32(d^a, -8)
+	c += d
+	b = bits.RotateLeft32(b^c, -7)
+	return a, b, c, d
+}
+
+// message word order of every round, the permutation applied round after round
+var blake3Schedule = func() (s [7][16]int) {
+	for i := range s[0] {
+		s[0][i] = i
+	}
+	for r := 1; r < 7; r++ {
+		for i, j := range blake3Permutation {
+			s[r][i] = s[r-1][j]
+		}
+	}
+	return s
+}()
+
+func blake3Compress(cv *[8]uint32, m *[16]uint32, counter uint64, blockLen, flags uint32) [16]uint32 {
+	s0, s1, s2, s3, s4, s5, s6, s7 := cv[0], cv[1], cv[2], cv[3], cv[4], cv[5], cv[6], cv[7]
+	s8, s9, s10, s11 := blake3IV[0], blake3IV[1], blake3IV[2], blake3IV[3]
+	s12, s13, s14, s15 := uint32(counter), uint32(counter>>32), blockLen, flags
+	for r := range blake3Schedule {
+		k := &blake3Schedule[r]
+		s0, s4, s8, s12 = blake3G(s0, s4, s8, s12, m[k[0]], m[k[1]])
+		s1, s5, s9, s13 = blake3G(s1, s5, s9, s13, m[k[2]], m[k[3]])
+		s2, s6, s10, s14 = blake3G(s2, s6, s10, s14, m[k[4]], m[k[5]])
+		s3, s7, s11, s15 = blake3G(s3, s7, s11, s15, m[k[6]], m[k[7]])
+		s0, s5, s10, s15 = blake3G(s0, s5, s10, s15, m[k[8]], m[k[9]])
+		s1, s6, s11, s12 = blake3G(s1, s6, s11, s12, m[k[10]], m[k[11]])
+		s2, s7, s8, s13 = blake3G(s2, s7, s8, s13, m[k[12]], m[k[13]])
+		s3, s4, s9, s14 = blake3G(s3, s4, s9, s14, m[k[14]], m[k[15]])
+	}
+	return [16]uint32{s0 ^ s8, s1 ^ s9, s2 ^ s10, s3 ^ s11, s4 ^ s12, s5 ^ s13, s6 ^ s14, s7 ^ s15,
+		s8 ^ cv[0], s9 ^ cv[1], s10 ^ cv[2], s11 ^ cv[3], s12 ^ cv[4], s13 ^ cv[5], s14 ^ cv[6], s15 ^ cv[7]}
+}
+
+func blake3Words(b []byte) (w [16]uint32) {
+	var full [blake3BlockLen]byte
+	copy(full[:], b)
+	for i := range w {
+		w[i] = binary.LittleEndian.Uint32(full[4*i:])
+	}
+	return w
+}
+
+// input of a compression not done yet, it may still become the root
+type blake3Output struct {
+	cv       [8]uint32
+	block    [16]uint32
+	counter  uint64
+	blockLen uint32
+	flags    uint32
+}
+
+func (o blake3Output) chainingValue() (cv [8]uint32) {
+	s := blake3Compress(&o.cv, &o.block, o.counter, o.blockLen, o.flags)
+	copy(cv[:], s[:8])
+	return cv
+}
+
+type blake3Chunk struct {
+	cv         [8]uint32
+	counter    uint64
+	block      [blake3BlockLen]byte
+	blockLen   int
+	compressed int // blocks compressed so far
+}
+
+func (c *blake3Chunk) len() int {
+	return blake3BlockLen*c.compressed + c.blockLen
+}
+
+func (c *blake3Chunk) startFlag() uint32 {
+	if c.compressed == 0 {
+		return blake3ChunkStart
+	}
+	return 0
+}
+
+func (c *blake3Chunk) update(b []byte) {
+	for len(b) > 0 {
+		if c.blockLen == blake3BlockLen {
+			w := blake3Words(c.block[:])
+			s := blake3Compress(&c.cv, &w, c.counter, blake3BlockLen, c.startFlag())
+			copy(c.cv[:], s[:8])
+			c.compressed++
+			c.blockLen = 0
+		}
+		n := copy(c.block[c.blockLen:], b)
+		c.blockLen += n
+		b = b[n:]
+	}
+}
+
+func (c *blake3Chunk) output() blake3Output {
+	return blake3Output{cv: c.cv, block: blake3Words(c.block[:c.blockLen]), counter: c.counter,
+		blockLen: uint32(c.blockLen), flags: c.startFlag() | blake3ChunkEnd}
+}
+
+func blake3ParentOutput(left, right [8]uint32) blake3Output {
+	o := blake3Output{cv: blake3IV, blockLen: blake3BlockLen, flags: blake3Parent}
+	copy(o.block[:8], left[:])
+	copy(o.block[8:], right[:])
+	return o
+}
+
+type blake3 struct {
+	chunk blake3Chunk
+	stack [][8]uint32 // chaining values of complete subtrees
+}
+
+func newBlake3() *blake3 {
+	b := &blake3{}
+	b.Reset()
+	return b
+}
+
+func (b *blake3) Reset() {
+	b.chunk = blake3Chunk{cv: blake3IV}
+	b.stack = b.stack[:0]
+}
+
+func (b *blake3) Size() int      { return 32 }
+func (b *blake3) BlockSize() int { return blake3BlockLen }
+
+func (b *blake3) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		// a full chunk is only finished once more input shows it isn't the root
+		if b.chunk.len() == blake3ChunkLen {
+			o := b.chunk.output()
+			cv := o.chainingValue()
+			total := b.chunk.counter + 1
+			// merge subtrees the new chunk completes, one per trailing zero bit of the chunk count
+			for total&1 == 0 {
+				cv = blake3ParentOutput(b.stack[len(b.stack)-1], cv).chainingValue()
+				b.stack = b.stack[:len(b.stack)-1]
+				total >>= 1
+			}
+			b.stack = append(b.stack, cv)
+			b.chunk = blake3Chunk{cv: blake3IV, counter: b.chunk.counter + 1}
+		}
+		take := blake3ChunkLen - b.chunk.len()
+		if take > len(p) {
+			take = len(p)
+		}
+		b.chunk.update(p[:take])
+		p = p[take:]
+	}
+	return n, nil
+}
+
+func (b *blake3) Sum(p []byte) []byte {
+	o := b.chunk.output()
+	for i := len(b.stack) - 1; i >= 0; i-- {
+		o = blake3ParentOutput(b.stack[i], o.chainingValue())
+	}
+	s := blake3Compress(&o.cv, &o.block, 0, o.blockLen, o.flags|blake3Root)
+	for _, w := range s[:8] {
+		p = append(p, byte(w), byte(w>>8), byte(w>>16), byte(w>>24))
+	}
+	return p
+}
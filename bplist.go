@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"unicode/utf16"
+)
+
+// binary property lists, only what Finder tags need: a top level array of strings
+
+var errPlist = errors.New("unsupported binary property list")
+
+// encode strings as bplist00 array
+func stringsPlist(strs []string) []byte {
+	b := []byte("bplist00")
+	var offsets []int
+	// object 0 is the array, strings follow as objects 1..n
+	offsets = append(offsets, len(b))
+	b = append(b, plistMarker(0xa0, len(strs))...)
+	for i := range strs {
+		b = append(b, byte(i+1))
+	}
+	for _, s := range strs {
+		offsets = append(offsets, len(b))
+		if ascii(s) {
+			b = append(b, plistMarker(0x50, len(s))...)
+			b = append(b, s...)
+		} else {
+			u := utf16.Encode([]rune(s))
+			b = append(b, plistMarker(0x60, len(u))...)
+			for _, c := range u {
+				b = appendUint(b, uint64(c), 2)
+			}
+		}
+	}
+	tableOffset := len(b)
+	for _, o := range offsets {
+		b = appendUint(b, uint64(o), 8)
+	}
+	// trailer: 6 unused bytes, offset int size, object ref size, object count, top object, offset table offset
+	b = append(b, 0, 0, 0, 0, 0, 0, 8, 1)
+	b = appendUint(b, uint64(len(offsets)), 8)
+	b = appendUint(b, 0, 8)
+	return appendUint(b, uint64(tableOffset), 8)
+}
+
+// object marker with count, larger counts follow as int object
+func plistMarker(kind byte, n int) []byte {
+	if n < 15 {
+		return []byte{kind | byte(n)}
+	}
+	b := []byte{kind | 0x0f, 0x13}
+	return appendUint(b, uint64(n), 8)
+}
+
+func ascii(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// decode bplist00 holding an array of strings
+func parseStringsPlist(b []byte) ([]string, error) {
+	if len(b) < 40 || string(b[:8]) != "bplist00" {
+		return nil, errPlist
+	}
+	t := b[len(b)-32:]
+	offSize, refSize := int(t[6]), int(t[7])
+	count := binary.BigEndian.Uint64(t[8:])
+	top := binary.BigEndian.Uint64(t[16:])
+	table := binary.BigEndian.Uint64(t[24:])
+	if offSize == 0 || refSize == 0 || count > uint64(len(b)) || table+count*uint64(offSize) > uint64(len(b)) {
+		return nil, errPlist
+	}
+	offset := func(obj uint64) (int, error) {
+		if obj >= count {
+			return 0, errPlist
+		}
+		return int(readUint(b[table+obj*uint64(offSize):], offSize)), nil
+	}
+	o, err := offset(top)
+	if err != nil {
+		return nil, err
+	}
+	if b[o]&0xf0 != 0xa0 {
+		return nil, errPlist
+	}
+	n, p, err := plistCount(b, o)
+	if err != nil || p+n*refSize > len(b) {
+		return nil, errPlist
+	}
+	var strs []string
+	for i := 0; i < n; i++ {
+		so, err := offset(readUint(b[p+i*refSize:], refSize))
+		if err != nil {
+			return nil, err
+		}
+		l, sp, err := plistCount(b, so)
+		if err != nil {
+			return nil, err
+		}
+		switch b[so] & 0xf0 {
+		case 0x50:
+			if sp+l > len(b) {
+				return nil, errPlist
+			}
+			strs = append(strs, string(b[sp:sp+l]))
+		case 0x60:
+			if sp+2*l > len(b) {
+				return nil, errPlist
+			}
+			u := make([]uint16, l)
+			for j := range u {
+				u[j] = binary.BigEndian.Uint16(b[sp+2*j:])
+			}
+			strs = append(strs, string(utf16.Decode(u)))
+		default:
+			return nil, errPlist
+		}
+	}
+	return strs, nil
+}
+
+// count of the object at offset o, and where its data starts
+func plistCount(b []byte, o int) (int, int, error) {
+	if o >= len(b) {
+		return 0, 0, errPlist
+	}
+	if n := int(b[o] & 0x0f); n != 0x0f {
+		return n, o + 1, nil
+	}
+	if o+2 > len(b) || b[o+1]&0xf0 != 0x10 {
+		return 0, 0, errPlist
+	}
+	size := 1 << (b[o+1] & 0x0f)
+	if o+2+size > len(b) {
+		return 0, 0, errPlist
+	}
+	return int(readUint(b[o+2:], size)), o + 2 + size, nil
+}
+
+// big endian unsigned int of size bytes
+func readUint(b []byte, size int) uint64 {
+	var v uint64
+	for i := 0; i < size && i < len(b); i++ {
+		v = v<<8 | uint64(b[i])
+	}
+	return v
+}
+
+// append v as big endian unsigned int of size bytes
+func appendUint(b []byte, v uint64, size int) []byte {
+	for i := size - 1; i >= 0; i-- {
+		b = append(b, byte(v>>(8*i)))
+	}
+	return b
+}
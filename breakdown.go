@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// number of extensions and types listed in the breakdown
+const breakdownRows = 10
+
+// print which extensions and content types the reclaimable bytes belong to
+func printBreakdown(dups []FileGroup) {
+	byExt := make(map[string]int64)
+	byType := make(map[string]int64)
+	var total int64
+	for _, g := range dups {
+		kept, removed := keepFiles(g, keepFlag)
+		_, bytes := reclaimable(kept, removed)
+		if bytes == 0 {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(kept[0].path))
+		if ext == empty {
+			ext = "(none)"
+		}
+		byExt[ext] += bytes
+		byType[contentType(kept[0].path)] += bytes
+		total += bytes
+	}
+	printShares("waste by extension", byExt, total)
+	printShares("waste by type", byType, total)
+}
+
+// MIME type of file sniffed from its first bytes, by extension when sniffing only finds binary data
+func contentType(path string) string {
+	t := "application/octet-stream"
+	if f, err := os.Open(path); err == nil {
+		b := make([]byte, 512)
+		n, _ := f.Read(b)
+		f.Close()
+		t = http.DetectContentType(b[:n])
+	}
+	if t == "application/octet-stream" || strings.HasPrefix(t, "text/plain") {
+		if byExt := mime.TypeByExtension(filepath.Ext(path)); byExt != empty {
+			t = byExt
+		}
+	}
+	if i := strings.IndexByte(t, ';'); i >= 0 {
+		t = t[:i]
+	}
+	return t
+}
+
+func printShares(title string, bytes map[string]int64, total int64) {
+	fmt.Printf("%s:\n", paint(colorCyan, tr(title)))
+	keys := make([]string, 0, len(bytes))
+	for k := range bytes {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if bytes[keys[i]] != bytes[keys[j]] {
+			return bytes[keys[i]] > bytes[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	var rest int64
+	for i, k := range keys {
+		if i >= breakdownRows {
+			rest += bytes[k]
+			continue
+		}
+		fmt.Printf(tr("  %5.1f%%  %s bytes  %s\n"), 100*float64(bytes[k])/float64(total), paint(colorBold, fmt.Sprintf("%12d", bytes[k])), k)
+	}
+	if rest > 0 {
+		fmt.Printf(tr("  %5.1f%%  %s bytes  %d others\n"), 100*float64(rest)/float64(total), paint(colorBold, fmt.Sprintf("%12d", rest)), len(keys)-breakdownRows)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stop hashing after this long, 0 for no limit
+var maxDurationFlag time.Duration
+
+// stop hashing after reading this many bytes, 0 for no limit
+var maxHashedFlag byteSize
+
+// keep hashes in this file across runs, so a scan stopped by a budget continues where it stopped,
+// set by -resume and -cache as well
+var checkpointFlag string
+
+// bytes read for hashing and when the scan started, for the budget
+var hashedBytes int64
+var scanStart time.Time
+
+// guards hashedBytes, knownHashes and progress while -workers hash in parallel
+var statsMu sync.Mutex
+
+// count n bytes read for hashing
+func addHashed(n int64) {
+	statsMu.Lock()
+	hashedBytes += n
+	progressTick()
+	statsMu.Unlock()
+}
+
+var errBudget = errors.New("scan budget exhausted")
+
+// errBudget once -max-duration or -max-bytes-hashed is used up
+func budgetLeft() error {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	if maxDurationFlag > 0 && time.Since(scanStart) >= maxDurationFlag {
+		return fmt.Errorf("%w: ran for %v", errBudget, time.Since(scanStart).Round(time.Second))
+	}
+	if maxHashedFlag > 0 && hashedBytes >= int64(maxHashedFlag) {
+		return fmt.Errorf("%w: hashed %s", errBudget, formatSize(hashedBytes))
+	}
+	return nil
+}
+
+// hashes saved by -checkpoint, a file's hash is reused while its size and mtime are unchanged,
+// files are keyed by absolute path
+type checkpointFile struct {
+	ADS       bool                       `json:"ads"` // hashes include alternate data streams
+	Algorithm string                     `json:"algorithm"`
+	Hashes    map[string]checkpointEntry `json:"hashes"`
+}
+
+type checkpointEntry struct {
+	Size  int64     `json:"size"`
+	Mtime time.Time `json:"mtime"`
+	Hash  string    `json:"hash"`
+	// -strong-hash as algorithm:hex, once the file was in a confirmed group
+	Strong string `json:"strong,omitempty"`
+}
+
+// full hashes known from the checkpoint or computed in this run, nil without -checkpoint
+var knownHashes map[string]checkpointEntry
+
+// read the checkpoint, a missing one starts empty
+func loadCheckpoint(path string) error {
+	knownHashes = make(map[string]checkpointEntry)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var c checkpointFile
+	if err = json.Unmarshal(b, &c); err != nil {
+		return fmt.Errorf("checkpoint %s: %v", path, err)
+	}
+	if c.ADS == adsFlag && c.Algorithm == hashFlag && c.Hashes != nil {
+		knownHashes = c.Hashes
+	}
+	return nil
+}
+
+// key of path in the checkpoint
+func checkpointKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// set hashes of unchanged files from the checkpoint
+func applyCheckpoint(fds []FileDetail) int {
+	var n int
+	for i := range fds {
+		if e, ok := knownHashes[checkpointKey(fds[i].path)]; ok && e.Size == fds[i].size && e.Mtime.Equal(fds[i].mtime) && !ruled(fds[i].path) {
+			fds[i].hash = e.Hash
+			n++
+		}
+	}
+	return n
+}
+
+// write hashes of the files still found under dir, hashes of files elsewhere
+// are kept, so that one cache serves scans of different dirs
+func saveCheckpoint(path, dir string, fds []FileDetail) error {
+	c := checkpointFile{ADS: adsFlag, Algorithm: hashFlag, Hashes: make(map[string]checkpointEntry)}
+	root := checkpointKey(dir)
+	for k, e := range knownHashes {
+		if rel, err := filepath.Rel(root, k); err != nil || strings.HasPrefix(rel, "..") {
+			c.Hashes[k] = e
+		}
+	}
+	for _, f := range fds {
+		k := checkpointKey(f.path)
+		if e, ok := knownHashes[k]; ok && e.Size == f.size && e.Mtime.Equal(f.mtime) {
+			c.Hashes[k] = e
+		}
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".dup-tmp"
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// group files of a size by comparing their bytes instead of hashing them
+var noHashFlag bool
+
+// how groups of files with matching samples are confirmed: hash or bytes
+var confirmFlag string
+
+// algorithm of results and checkpoints of -no-hash and -confirm bytes scans, files were compared instead of hashed
+const noHash = "bytes"
+
+// bytes read from every file of a class at a time
+const compareBlock = 64 * KB
+
+// files compareMany has open at a time, well below even tight limits of open fds
+const compareFiles = 16
+
+// split files into classes of identical content like compareBytes, with at most
+// compareFiles of them open at a time: larger classes are split by a hash of their
+// content first, then each part is compared in batches against one file of every
+// class found so far; only parts with more distinct contents than compareFiles
+// under one hash, which takes crafted files, open more
+func compareMany(files []FileDetail) ([][]FileDetail, error) {
+	if len(files) <= compareFiles {
+		return compareBytes(files)
+	}
+	byHash := make(map[string][]FileDetail)
+	var sums []string
+	for _, f := range files {
+		if err := budgetLeft(); err != nil {
+			return nil, err
+		}
+		sum, err := contentSum(f.path)
+		if err != nil {
+			return nil, err
+		}
+		if byHash[sum] == nil {
+			sums = append(sums, sum)
+		}
+		byHash[sum] = append(byHash[sum], f)
+	}
+	var result [][]FileDetail
+	for _, sum := range sums {
+		part := byHash[sum]
+		if len(part) == 1 {
+			progressFile()
+			continue
+		}
+		// classes of the part, each compared by its first file
+		var classes [][]FileDetail
+		for len(part) > 0 {
+			n := compareFiles - len(classes)
+			if n < 1 {
+				n = 1
+			}
+			if n > len(part) {
+				n = len(part)
+			}
+			batch := make([]FileDetail, 0, len(classes)+n)
+			reps := make(map[string]int)
+			for i, c := range classes {
+				batch = append(batch, c[0])
+				reps[c[0].path] = i
+			}
+			batch = append(batch, part[:n]...)
+			compared, err := compareBytes(batch)
+			if err != nil {
+				return nil, err
+			}
+			// a compared class holds at most one first file, as classes differ
+			placed := make(map[string]bool)
+			for _, c := range compared {
+				class := -1
+				for _, f := range c {
+					if i, ok := reps[f.path]; ok {
+						class = i
+					}
+				}
+				if class < 0 {
+					classes = append(classes, nil)
+					class = len(classes) - 1
+				}
+				for _, f := range c {
+					if _, ok := reps[f.path]; !ok {
+						classes[class] = append(classes[class], f)
+						placed[f.path] = true
+					}
+				}
+			}
+			for _, f := range part[:n] {
+				if !placed[f.path] {
+					classes = append(classes, []FileDetail{f})
+				}
+			}
+			part = part[n:]
+		}
+		for _, c := range classes {
+			if len(c) > 1 {
+				result = append(result, c)
+			}
+		}
+	}
+	return result, nil
+}
+
+// content hash of the file at path, only to split large classes for compareMany
+func contentSum(path string) (string, error) {
+	f, err := openContent(path)
+	if err != nil {
+		return empty, err
+	}
+	defer f.Close()
+	h := newHash()
+	if _, err = io.Copy(countingWriter{h}, f); err != nil {
+		return empty, err
+	}
+	return string(h.Sum(nil)), nil
+}
+
+// split files into classes of identical content by reading them block by block in
+// lockstep, a file stops being read as soon as it differs from all others, classes
+// of a single file are dropped; content left out by -ignore-rules is not compared
+func compareBytes(files []FileDetail) ([][]FileDetail, error) {
+	readers := make([]io.ReadCloser, len(files))
+	defer func() {
+		for _, r := range readers {
+			if r != nil {
+				r.Close()
+			}
+		}
+	}()
+	for i, f := range files {
+		r, err := openContent(f.path)
+		if err != nil {
+			return nil, err
+		}
+		readers[i] = r
+	}
+	bufs := make([][]byte, len(files))
+	for i := range bufs {
+		bufs[i] = make([]byte, compareBlock)
+	}
+	n := make([]int, len(files))
+	classes := [][]int{make([]int, len(files))}
+	for i := range files {
+		classes[0][i] = i
+	}
+	var done [][]int
+	for len(classes) > 0 {
+		if err := budgetLeft(); err != nil {
+			return nil, err
+		}
+		var next [][]int
+		for _, c := range classes {
+			for _, i := range c {
+				var err error
+				n[i], err = io.ReadFull(readers[i], bufs[i])
+				if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+					return nil, &fs.PathError{Op: "read", Path: files[i].path, Err: err}
+				}
+				addHashed(int64(n[i]))
+			}
+			// members equal to the first of a split class stay with it
+			var split [][]int
+			for _, i := range c {
+				placed := false
+				for s := range split {
+					if j := split[s][0]; bytes.Equal(bufs[i][:n[i]], bufs[j][:n[j]]) {
+						split[s] = append(split[s], i)
+						placed = true
+						break
+					}
+				}
+				if !placed {
+					split = append(split, []int{i})
+				}
+			}
+			for _, s := range split {
+				switch {
+				case len(s) == 1:
+					readers[s[0]].Close()
+					readers[s[0]] = nil
+					progressFile()
+				case int64(n[s[0]]) < compareBlock:
+					done = append(done, s)
+				default:
+					next = append(next, s)
+				}
+			}
+		}
+		classes = next
+	}
+	result := make([][]FileDetail, 0, len(done))
+	for _, c := range done {
+		var class []FileDetail
+		for _, i := range c {
+			class = append(class, files[i])
+			progressFile()
+		}
+		result = append(result, class)
+	}
+	return result, nil
+}
+
+// files of every size split by samples of their beginning, middle and end where the
+// quick pass would sample them, for -confirm bytes to compare only files whose samples
+// match; the others are compared right away
+func filterBySamples(sizeMap map[string][]FileDetail) (map[string][]FileDetail, error) {
+	result := make(map[string][]FileDetail)
+	for size, files := range sizeMap {
+		for i := range files {
+			key := size
+			if sampled(&files[i]) {
+				if err := budgetLeft(); err != nil {
+					return nil, err
+				}
+				var s string
+				err := retried(files[i].path, func() (err error) {
+					s, err = hash(&files[i], true)
+					return err
+				})
+				if err != nil {
+					if noteReadError(files[i].path, err) {
+						continue
+					}
+					return nil, err
+				}
+				key += "-" + s
+			}
+			result[key] = append(result[key], files[i])
+		}
+	}
+	for k, v := range result {
+		if len(v) <= 1 {
+			delete(result, k)
+			progressFile()
+		}
+	}
+	return result, nil
+}
+
+// groups of identical files by comparing the files of every key, starting with their size,
+// with each other; as there is no hash, the groups of a size are numbered in the order of
+// their first paths
+func filterByBytes(sizeMap map[string][]FileDetail) (map[string][]FileDetail, error) {
+	bySize := make(map[string][][]FileDetail)
+	for key, files := range sizeMap {
+		var classes [][]FileDetail
+		for len(files) > 1 {
+			err := retried(files[0].path, func() (err error) {
+				classes, err = compareMany(files)
+				return err
+			})
+			var pe *fs.PathError
+			if err != nil && errors.As(err, &pe) && len(without(files, pe.Path)) < len(files) && noteReadError(pe.Path, err) {
+				// the others are compared again without the file that can't be read
+				files, classes = without(files, pe.Path), nil
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+		size, _, _ := strings.Cut(key, "-")
+		bySize[size] = append(bySize[size], classes...)
+	}
+	result := make(map[string][]FileDetail)
+	for size, classes := range bySize {
+		for _, c := range classes {
+			sort.Slice(c, func(i, j int) bool { return c[i].path < c[j].path })
+		}
+		sort.Slice(classes, func(i, j int) bool { return classes[i][0].path < classes[j][0].path })
+		for i, c := range classes {
+			result[size+"-"+strconv.Itoa(i+1)] = c
+		}
+	}
+	return result, nil
+}
+
+// files other than the one at path
+func without(files []FileDetail, path string) []FileDetail {
+	var result []FileDetail
+	for _, f := range files {
+		if f.path != path {
+			result = append(result, f)
+		}
+	}
+	return result
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// labels of cataloged drives whose files join the scan as offline copies, all for every one
+var catalogFlag stringList
+
+// sizes of the offline files of the scan, local files of these sizes are hashed fully
+// right away, as there are no samples of the offline ones to compare with
+var offlineSizes map[int64]bool
+
+// catalog of the files of a removable or offline drive, to find copies on it while it isn't plugged in
+type driveCatalog struct {
+	Label     string         `json:"label"`
+	Serial    string         `json:"serial,omitempty"` // filesystem UUID or volume serial number
+	Root      string         `json:"root"`             // where the drive was mounted when cataloged
+	Time      time.Time      `json:"time"`
+	Algorithm string         `json:"algorithm"`
+	Files     []catalogEntry `json:"files"`
+}
+
+type catalogEntry struct {
+	Path string `json:"path"` // relative to the root
+	Size int64  `json:"size"`
+	Hash string `json:"hash"`
+}
+
+// dup catalog: record the files of drives and look up copies on them while they are offline
+func catalogCmd(args []string) error {
+	flags := flag.NewFlagSet("catalog", flag.ExitOnError)
+	flags.StringVar(&stateDirFlag, "state-dir", empty, "state dir holding the catalogs")
+	label := flags.String("label", empty, "name of the drive, default the name of the dir it is mounted at")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %[1]s catalog add [-label NAME] [flags] DIR\n       %[1]s catalog find [flags] PATH...\n       %[1]s catalog list [flags]\n       %[1]s catalog remove [flags] LABEL...\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "add hashes every file of the drive mounted at DIR into a catalog in the state dir, find lists")
+		fmt.Fprintln(flags.Output(), "which files under the paths have a copy on a cataloged drive, plugged in or not, and fails")
+		fmt.Fprintln(flags.Output(), "when none has, list shows the catalogs and remove deletes them. dup -catalog LABEL adds the")
+		fmt.Fprintln(flags.Output(), "files of a catalog to a scan as offline copies.")
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 || (args[0] != "add" && args[0] != "find" && args[0] != "list" && args[0] != "remove") {
+		flags.Usage()
+		return errors.New("unknown catalog command, must be add, find, list or remove")
+	}
+	var out string
+	if args[0] == "add" {
+		flags.StringVar(&hashFlag, "hash", "sha256", "content hash of the catalog: "+strings.Join(hashNames(), ", "))
+		flags.StringVar(&out, "o", empty, "write the catalog to this file instead of the state dir, as a manifest of the machine for dup merge-manifests")
+	}
+	parseFlags(flags, args[1:])
+	switch args[0] {
+	case "add":
+		if flags.NArg() != 1 {
+			flags.Usage()
+			return errors.New("one dir must be given")
+		}
+		if err := validHash(hashFlag); err != nil {
+			return err
+		}
+		return addCatalog(flags.Arg(0), *label, out)
+	case "find":
+		if flags.NArg() == 0 {
+			flags.Usage()
+			return errors.New("a path to look up must be given")
+		}
+		return findInCatalogs(flags.Args())
+	case "remove":
+		if flags.NArg() == 0 {
+			flags.Usage()
+			return errors.New("a label must be given")
+		}
+		return removeCatalogs(flags.Args())
+	}
+	catalogs, err := loadCatalogs()
+	if err != nil {
+		return err
+	}
+	for _, c := range catalogs {
+		var size int64
+		for _, f := range c.Files {
+			size += f.Size
+		}
+		fmt.Printf("%s\t%s\t%s\t%d files, %s\t%s\n", c.Label, c.Serial, c.Time.Format(time.RFC3339), len(c.Files), formatSize(size), c.Root)
+	}
+	return nil
+}
+
+// dir of the catalogs in the state dir
+func catalogDir() (string, error) {
+	state, err := stateDir()
+	if err != nil {
+		return empty, err
+	}
+	return makeDir(filepath.Join(state, "catalogs"))
+}
+
+// hash every file under root into the catalog of label, replacing an earlier one,
+// in the state dir or the file out
+func addCatalog(root, label, out string) error {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	if label == empty {
+		label = filepath.Base(abs)
+	}
+	c := driveCatalog{Label: label, Serial: volumeSerial(abs), Root: abs, Time: time.Now(), Algorithm: hashFlag, Files: []catalogEntry{}}
+	log.Printf("Cataloging %s as %s\n", abs, label)
+	fds, err := listFiles(abs)
+	if err != nil {
+		return err
+	}
+	for i := range fds {
+		h, err := hash(&fds[i], false)
+		if err != nil {
+			log.Printf("skip %s: %v\n", fds[i].path, err)
+			continue
+		}
+		rel, err := filepath.Rel(abs, fds[i].path)
+		if err != nil {
+			return err
+		}
+		c.Files = append(c.Files, catalogEntry{Path: filepath.ToSlash(rel), Size: fds[i].size, Hash: h})
+	}
+	b, err := json.MarshalIndent(c, empty, "  ")
+	if err != nil {
+		return err
+	}
+	path := out
+	if path == empty {
+		dir, err := catalogDir()
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(dir, safeName(label)+".json")
+	}
+	tmp := path + ".dup-tmp"
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+	log.Printf("%d files of %s cataloged in %s\n", len(c.Files), label, path)
+	return nil
+}
+
+// every catalog in the state dir, by label
+func loadCatalogs() ([]driveCatalog, error) {
+	dir, err := catalogDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var catalogs []driveCatalog
+	for _, f := range files {
+		c, err := readCatalog(f)
+		if err != nil {
+			return nil, err
+		}
+		catalogs = append(catalogs, c)
+	}
+	sort.Slice(catalogs, func(i, j int) bool { return catalogs[i].Label < catalogs[j].Label })
+	return catalogs, nil
+}
+
+// read a catalog, from the state dir or written with dup catalog add -o
+func readCatalog(path string) (driveCatalog, error) {
+	var c driveCatalog
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	if err = json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("%s: %v", path, err)
+	}
+	if err = validHash(c.Algorithm); err != nil {
+		return c, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, nil
+}
+
+// catalog of a label in the state dir, or in the file name
+func findCatalog(name string) (driveCatalog, error) {
+	if _, err := os.Stat(name); err == nil {
+		return readCatalog(name)
+	}
+	dir, err := catalogDir()
+	if err != nil {
+		return driveCatalog{}, err
+	}
+	c, err := readCatalog(filepath.Join(dir, safeName(name)+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return c, fmt.Errorf("no catalog of %s, see dup catalog list", name)
+	}
+	return c, err
+}
+
+// list the files under paths with a copy on a cataloged drive, files are only
+// hashed, by the algorithm of each catalog, when a cataloged file has their size
+func findInCatalogs(paths []string) error {
+	catalogs, err := loadCatalogs()
+	if err != nil {
+		return err
+	}
+	if len(catalogs) == 0 {
+		return errors.New("no drives cataloged yet, use dup catalog add")
+	}
+	bySize := make(map[int64]bool)
+	for _, c := range catalogs {
+		for _, f := range c.Files {
+			bySize[f.Size] = true
+		}
+	}
+	var checked, found int
+	for _, p := range paths {
+		fds, err := listFiles(p)
+		if err != nil {
+			return err
+		}
+		for _, f := range fds {
+			checked++
+			if !bySize[f.size] {
+				continue
+			}
+			// hash of f by each algorithm used by the catalogs
+			sums := make(map[string]string)
+			var copies []string
+			for _, c := range catalogs {
+				for _, e := range c.Files {
+					if e.Size != f.size {
+						continue
+					}
+					if _, ok := sums[c.Algorithm]; !ok {
+						hashFlag = c.Algorithm
+						fresh := FileDetail{path: f.path, size: f.size}
+						if sums[c.Algorithm], err = hash(&fresh, false); err != nil {
+							log.Printf("skip %s: %v\n", f.path, err)
+						}
+					}
+					if sums[c.Algorithm] == e.Hash {
+						copies = append(copies, c.Label+":"+e.Path)
+					}
+				}
+			}
+			if len(copies) > 0 {
+				fmt.Printf("%s\t%s\n", f.path, strings.Join(copies, "\t"))
+				found++
+			}
+		}
+	}
+	log.Printf("%d of %d files have a copy on a cataloged drive\n", found, checked)
+	if found == 0 {
+		return errors.New("no file has a copy on a cataloged drive")
+	}
+	return nil
+}
+
+// delete the catalogs of labels
+func removeCatalogs(labels []string) error {
+	dir, err := catalogDir()
+	if err != nil {
+		return err
+	}
+	for _, l := range labels {
+		if err = os.Remove(filepath.Join(dir, safeName(l)+".json")); errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no catalog of %s", l)
+		} else if err != nil {
+			return err
+		}
+		log.Printf("catalog of %s removed\n", l)
+	}
+	return nil
+}
+
+// files of the -catalog drives as offline files, LABEL:PATH, with their hashes
+func offlineFiles() ([]FileDetail, error) {
+	catalogs, err := loadCatalogs()
+	if err != nil {
+		return nil, err
+	}
+	wanted := make(map[string]bool)
+	for _, l := range catalogFlag {
+		wanted[l] = true
+	}
+	offlineSizes = make(map[int64]bool)
+	var fds []FileDetail
+	for _, c := range catalogs {
+		if !wanted[c.Label] && !wanted["all"] {
+			continue
+		}
+		delete(wanted, c.Label)
+		if c.Algorithm != hashFlag {
+			return nil, fmt.Errorf("catalog of %s was hashed with %s, scan with -hash %s to compare with it", c.Label, c.Algorithm, c.Algorithm)
+		}
+		for _, f := range c.Files {
+			fds = append(fds, FileDetail{path: c.Label + ":" + f.Path, size: f.Size, hash: f.Hash, offline: c.Label})
+			offlineSizes[f.Size] = true
+		}
+	}
+	delete(wanted, "all")
+	for l := range wanted {
+		return nil, fmt.Errorf("no catalog of %s, see dup catalog list", l)
+	}
+	log.Printf("%d offline files of cataloged drives added\n", len(fds))
+	return fds, nil
+}
+
+// files of a group that are on disk, without the offline ones
+func localFiles(files []FileDetail) []FileDetail {
+	var local []FileDetail
+	for _, f := range files {
+		if f.offline == empty {
+			local = append(local, f)
+		}
+	}
+	return local
+}
+
+// groups with a local file, groups of offline files only are of no use
+func withLocal(dups []FileGroup) []FileGroup {
+	var result []FileGroup
+	for _, g := range dups {
+		if len(localFiles(g.files)) > 0 {
+			result = append(result, g)
+		}
+	}
+	if len(result) < len(dups) {
+		log.Printf("%d groups of offline files only left out\n", len(dups)-len(result))
+	}
+	return result
+}
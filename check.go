@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// dup check: fail when a tree holds more duplication than allowed, for CI and scheduled policies
+func checkCmd(args []string) error {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	from := flags.String("from", empty, "take the groups from a result written with -o instead of scanning")
+	var maxWaste byteSize
+	flags.Var(&maxWaste, "max-waste", "most reclaimable bytes allowed, e.g. 1GB")
+	maxGroups := flags.Int("max-groups", -1, "most duplicate groups allowed")
+	maxFiles := flags.Int("max-files", -1, "most removable duplicate files allowed")
+	flags.StringVar(&keepFlag, "keep", "first", "which file of a group is kept, as for dup -keep, the others are reclaimable")
+	flags.Var(&excludeFlag, "exclude", "skip files and directories matching this glob pattern, as for dup -exclude, can be repeated")
+	flags.Var(&minSizeFlag, "min-size", "ignore files smaller than this, as for dup -min-size")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s check [flags] [dir]\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Prints the duplication found and exits with status 1 when it exceeds any of the limits given.")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return errors.New("only one dir can be checked")
+	}
+	if maxWaste == 0 && *maxGroups < 0 && *maxFiles < 0 {
+		flags.Usage()
+		return errors.New("at least one of -max-waste, -max-groups and -max-files must be given")
+	}
+	if err := validPolicy(keepFlag); err != nil {
+		return err
+	}
+	var dups []FileGroup
+	var err error
+	if *from != empty {
+		if basedir, dups, err = readResult(*from); err != nil {
+			return err
+		}
+	} else {
+		basedir = "."
+		if flags.NArg() == 1 {
+			basedir = flags.Arg(0)
+		}
+		if dups, err = findDup(basedir); err != nil {
+			return err
+		}
+	}
+
+	var files int
+	var waste int64
+	for _, g := range dups {
+		n, b := reclaimable(keepFiles(g, keepFlag))
+		files += n
+		waste += b
+	}
+	fmt.Printf("%s: %d groups, %d removable files, %s reclaimable\n", basedir, len(dups), files, formatSize(waste))
+	var exceeded []string
+	if maxWaste > 0 && waste > int64(maxWaste) {
+		exceeded = append(exceeded, fmt.Sprintf("%s reclaimable, at most %s allowed", formatSize(waste), formatSize(int64(maxWaste))))
+	}
+	if *maxGroups >= 0 && len(dups) > *maxGroups {
+		exceeded = append(exceeded, fmt.Sprintf("%d groups, at most %d allowed", len(dups), *maxGroups))
+	}
+	if *maxFiles >= 0 && files > *maxFiles {
+		exceeded = append(exceeded, fmt.Sprintf("%d removable files, at most %d allowed", files, *maxFiles))
+	}
+	if len(exceeded) > 0 {
+		return errors.New("duplication over the limits: " + strings.Join(exceeded, "; "))
+	}
+	return nil
+}
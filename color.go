@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// color the output: auto (on a terminal, unless NO_COLOR is set), always or never
+var colorFlag string
+
+// whether output is colored, decided by setupColor
+var useColor bool
+
+// ANSI SGR codes
+const (
+	colorBold   = "1"
+	colorRed    = "31"
+	colorGreen  = "32"
+	colorYellow = "33"
+	colorCyan   = "1;36"
+)
+
+// decide by -color, NO_COLOR (https://no-color.org) and whether stdout is a terminal
+func setupColor() error {
+	switch colorFlag {
+	case "never":
+		useColor = false
+	case "always":
+		useColor = true
+	case "auto":
+		useColor = os.Getenv("NO_COLOR") == empty && os.Getenv("TERM") != "dumb" && isTerminal(os.Stdout)
+	default:
+		return fmt.Errorf("unknown -color %s, use auto, always or never", colorFlag)
+	}
+	if useColor {
+		// consoles without escape sequences get no color, even with always
+		useColor = enableColor(os.Stdout)
+	}
+	return nil
+}
+
+// s in the color given by an SGR code, or s when output isn't colored
+func paint(code, s string) string {
+	if !useColor {
+		return s
+	}
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// terminals understand ANSI escape sequences
+func enableColor(f *os.File) bool {
+	return true
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+const enableVirtualTerminalProcessing = 0x0004
+
+var procSetConsoleMode = modkernel32.NewProc("SetConsoleMode")
+
+// turn on escape sequences of the console, Windows 10 and later have them
+func enableColor(f *os.File) bool {
+	h := syscall.Handle(f.Fd())
+	var mode uint32
+	if syscall.GetConsoleMode(h, &mode) != nil {
+		// redirected with -color always, leave the sequences to the reader
+		return true
+	}
+	if mode&enableVirtualTerminalProcessing != 0 {
+		return true
+	}
+	r, _, _ := procSetConsoleMode.Call(uintptr(h), uintptr(mode|enableVirtualTerminalProcessing))
+	return r != 0
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// POSIX ACLs are stored as extended attributes with this prefix
+const aclPrefix = "system.posix_acl_"
+
+// compares extended attributes, or ACLs only, for -compare-xattr/-compare-acl split
+type xattrComparator struct {
+	acl bool
+}
+
+func (c xattrComparator) Name() string {
+	if c.acl {
+		return "acl"
+	}
+	return "xattr"
+}
+
+func (c xattrComparator) Key(f FileDetail) (string, error) {
+	xattrs, err := listXattrs(f.path)
+	if err != nil {
+		return empty, err
+	}
+	return xattrKey(xattrs, c.acl), nil
+}
+
+// compares modification times, for -match-mtime
+type mtimeComparator struct{}
+
+func (mtimeComparator) Name() string {
+	return "mtime"
+}
+
+func (mtimeComparator) Key(f FileDetail) (string, error) {
+	return strconv.FormatInt(f.mtime.UnixNano(), 10), nil
+}
+
+// with -match-mtime, leave out files of each size whose mtime no other file
+// has, they can't be grouped and don't need to be hashed
+func filterByMtime(sizeMap map[string][]FileDetail) {
+	for k, files := range sizeMap {
+		count := make(map[int64]int)
+		for _, f := range files {
+			count[f.mtime.UnixNano()]++
+		}
+		var left []FileDetail
+		for _, f := range files {
+			if count[f.mtime.UnixNano()] > 1 {
+				left = append(left, f)
+			}
+		}
+		if len(left) > 1 {
+			sizeMap[k] = left
+		} else {
+			delete(sizeMap, k)
+		}
+	}
+}
+
+// groups with at least n files, for -min-copies
+func withCopies(dups []FileGroup, n int) []FileGroup {
+	var result []FileGroup
+	for _, g := range dups {
+		if len(g.files) >= n {
+			result = append(result, g)
+		}
+	}
+	log.Printf("%d groups with fewer than %d copies left out\n", len(dups)-len(result), n)
+	return result
+}
+
+// groups whose removed files would free at least n bytes, for -min-waste
+func withWaste(dups []FileGroup, n int64) []FileGroup {
+	var result []FileGroup
+	for _, g := range dups {
+		if _, b := reclaimable(keepFiles(g, keepFlag)); b >= n {
+			result = append(result, g)
+		}
+	}
+	log.Printf("%d groups freeing less than %s left out\n", len(dups)-len(result), formatSize(n))
+	return result
+}
+
+// split groups so that files only stay together when every comparator gives them the same key
+func refine(dups []FileGroup, cs []Comparator) ([]FileGroup, error) {
+	if len(cs) == 0 {
+		return dups, nil
+	}
+	var result []FileGroup
+	for _, g := range dups {
+		split := make(map[string][]FileDetail)
+		var keys []string
+		for _, f := range g.files {
+			var key strings.Builder
+			for _, c := range cs {
+				k, err := c.Key(f)
+				if err != nil {
+					return nil, fmt.Errorf("%s comparator on %s: %v", c.Name(), f.path, err)
+				}
+				key.WriteString(k)
+				key.WriteByte(0)
+			}
+			if _, ok := split[key.String()]; !ok {
+				keys = append(keys, key.String())
+			}
+			split[key.String()] = append(split[key.String()], f)
+		}
+		for _, key := range keys {
+			if files := split[key]; len(files) > 1 {
+				result = append(result, FileGroup{size: g.size, hash: g.hash, files: files, notes: g.notes})
+			}
+		}
+	}
+	return result, nil
+}
+
+// note files with differing extended attributes and ACLs on their groups, for
+// -compare-xattr/-compare-acl warn
+func noteMetadata(dups []FileGroup) error {
+	var cs []xattrComparator
+	if compareXattrFlag == "warn" {
+		cs = append(cs, xattrComparator{})
+	}
+	if compareACLFlag == "warn" {
+		cs = append(cs, xattrComparator{acl: true})
+	}
+	for i := range dups {
+		for _, c := range cs {
+			notes, err := differences(c, dups[i].files)
+			if err != nil {
+				return err
+			}
+			dups[i].notes = append(dups[i].notes, notes...)
+		}
+	}
+	return nil
+}
+
+// canonical string of the extended attributes, either ACLs only or everything but ACLs
+func xattrKey(xattrs map[string][]byte, acl bool) string {
+	var attrs []string
+	for name, value := range xattrs {
+		if strings.HasPrefix(name, aclPrefix) == acl {
+			attrs = append(attrs, fmt.Sprintf("%s=%x", name, value))
+		}
+	}
+	sort.Strings(attrs)
+	return strings.Join(attrs, ",")
+}
+
+// describe which files have which variant of the compared metadata, nothing when all files agree
+func differences(c Comparator, files []FileDetail) ([]string, error) {
+	variants := make(map[string][]string)
+	var order []string
+	for _, f := range files {
+		k, err := c.Key(f)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := variants[k]; !ok {
+			order = append(order, k)
+		}
+		variants[k] = append(variants[k], f.path)
+	}
+	if len(order) <= 1 {
+		return nil, nil
+	}
+	var notes []string
+	for i, k := range order {
+		notes = append(notes, fmt.Sprintf("%s variant %d: %s", c.Name(), i+1, strings.Join(variants[k], ", ")))
+	}
+	return notes, nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// compression of the text outputs, gzip or zstd, taken from a .gz or .zst name when not given
+var compressFlag string
+
+// extensions of the compressions, reading them back goes by content
+var compressExts = map[string]string{".gz": "gzip", ".zst": "zstd"}
+
+func validCompress(name string) error {
+	if name != empty && name != "gzip" && name != "zstd" {
+		return fmt.Errorf("unknown -compress %q, must be gzip or zstd", name)
+	}
+	return nil
+}
+
+// compression path gets written with
+func compression(path string) string {
+	if compressFlag != empty {
+		return compressFlag
+	}
+	return compressExts[strings.ToLower(filepath.Ext(path))]
+}
+
+// name of path without a compression extension, to tell its format by
+func uncompressedName(path string) string {
+	if _, ok := compressExts[strings.ToLower(filepath.Ext(path))]; ok {
+		return strings.TrimSuffix(path, filepath.Ext(path))
+	}
+	return path
+}
+
+// file to write an output to, compressed as -compress or its name says;
+// zstd runs the zstd command, the standard library has no encoder
+func createOutput(path string) (io.WriteCloser, error) {
+	c := compression(path)
+	if c == "zstd" {
+		if _, err := exec.LookPath("zstd"); err != nil {
+			return nil, fmt.Errorf("zstd: %v", err)
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	switch c {
+	case "gzip":
+		return &gzipFile{gzip.NewWriter(f), f}, nil
+	case "zstd":
+		cmd := exec.Command("zstd", "-q", "-c")
+		cmd.Stdout = f
+		in, err := cmd.StdinPipe()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("zstd: %v", err)
+		}
+		return &zstdPipe{w: in, cmd: cmd, f: f}, nil
+	}
+	return f, nil
+}
+
+// write an output at once, as os.WriteFile
+func writeOutput(path string, b []byte) error {
+	w, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(b); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// file to read an input from, gzip and zstd compressed files are recognized by their magic
+func openInput(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(f)
+	magic, _ := r.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		z, err := gzip.NewReader(r)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return &gzipInput{z, f}, nil
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		cmd := exec.Command("zstd", "-q", "-d", "-c")
+		cmd.Stdin = r
+		out, err := cmd.StdoutPipe()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("zstd: %v", err)
+		}
+		return &zstdPipe{r: out, cmd: cmd, f: f}, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, f}, nil
+}
+
+// read an input at once, as os.ReadFile
+func readInput(path string) ([]byte, error) {
+	r, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(r)
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+	return b, err
+}
+
+type gzipFile struct {
+	*gzip.Writer
+	f *os.File
+}
+
+func (g *gzipFile) Close() error {
+	err := g.Writer.Close()
+	if cerr := g.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+type gzipInput struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (g *gzipInput) Close() error {
+	g.Reader.Close()
+	return g.f.Close()
+}
+
+// zstd command with its input or output piped to us
+type zstdPipe struct {
+	r   io.ReadCloser
+	w   io.WriteCloser
+	cmd *exec.Cmd
+	f   *os.File
+}
+
+func (z *zstdPipe) Read(b []byte) (int, error) {
+	return z.r.Read(b)
+}
+
+func (z *zstdPipe) Write(b []byte) (int, error) {
+	return z.w.Write(b)
+}
+
+func (z *zstdPipe) Close() error {
+	if z.w != nil {
+		z.w.Close()
+	} else {
+		z.r.Close()
+	}
+	err := z.cmd.Wait()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		err = fmt.Errorf("zstd: %v", err)
+	}
+	if cerr := z.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// dup cp: copy a tree, verifying every copy and skipping files already there
+func cpCmd(args []string) error {
+	flags := flag.NewFlagSet("cp", flag.ExitOnError)
+	overwrite := flags.Bool("overwrite", false, "replace destination files having different content")
+	dryRun := flags.Bool("n", false, "only tell what would be done")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s cp [flags] SRC DST\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Copies regular files of SRC to DST, hashing source and destination to verify every copy, and skipping files that already exist with identical content.")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("SRC and DST must be given")
+	}
+	src, dst := flags.Arg(0), flags.Arg(1)
+	fds, err := listFiles(src)
+	if err != nil {
+		return err
+	}
+	var copied, identical, conflicts int
+	var bytes int64
+	for i := range fds {
+		f := &fds[i]
+		rel, err := filepath.Rel(src, f.path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if ti, err := os.Stat(target); err == nil {
+			same := ti.Size() == f.size
+			if same {
+				if same, err = sameContent(f, target); err != nil {
+					return err
+				}
+			}
+			if same {
+				identical++
+				continue
+			}
+			if !*overwrite {
+				fmt.Printf("conflict %s, %s has different content\n", f.path, target)
+				conflicts++
+				continue
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		fmt.Printf("copy %s -> %s\n", f.path, target)
+		if !*dryRun {
+			if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if _, err = verifiedCopy(f.path, target); err != nil {
+				return err
+			}
+		}
+		copied++
+		bytes += f.size
+	}
+	log.Printf("%d files (%d bytes) copied, %d identical skipped, %d conflicts\n", copied, bytes, identical, conflicts)
+	return nil
+}
+
+// whether file at path has the same content as f, byte by byte
+func sameContent(f *FileDetail, path string) (bool, error) {
+	off, err := firstDifference(f.path, path)
+	return off < 0, err
+}
+
+// copy src to dst, hashing the data while copying and reading dst back to verify it,
+// dst is replaced atomically and keeps permissions and mtime of src, return the hash
+func verifiedCopy(src, dst string) (string, error) {
+	s, err := os.Open(src)
+	if err != nil {
+		return empty, err
+	}
+	defer s.Close()
+	fi, err := s.Stat()
+	if err != nil {
+		return empty, err
+	}
+	tmp := dst + ".dup-tmp"
+	d, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return empty, err
+	}
+	sh := crc32.New(table)
+	if _, err = io.Copy(d, io.TeeReader(s, sh)); err == nil {
+		err = d.Sync()
+	}
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = verify(tmp, sh.Sum32())
+	}
+	if err == nil {
+		err = os.Chtimes(tmp, fi.ModTime(), fi.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return empty, err
+	}
+	return fmt.Sprintf("%x", sh.Sum32()), nil
+}
+
+// read file back and compare its CRC32
+func verify(path string, crc uint32) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := crc32.New(table)
+	if _, err = io.Copy(h, f); err != nil {
+		return err
+	}
+	if h.Sum32() != crc {
+		return fmt.Errorf("verification of %s failed, copy differs from source", path)
+	}
+	return nil
+}
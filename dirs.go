@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// keep the hash cache here instead of $XDG_CACHE_HOME/dup
+var cacheDirFlag string
+
+// keep checkpoints and the audit log here instead of $XDG_STATE_HOME/dup
+var stateDirFlag string
+
+// reuse hashes of unchanged files from earlier runs, kept in the cache dir
+var cacheFlag bool
+
+// keep a checkpoint of this dir in the state dir and continue from it
+var resumeFlag bool
+
+// dir for data that can be rebuilt, like hashes: $XDG_CACHE_HOME/dup, or
+// ~/.cache/dup, ~/Library/Caches/dup and %LocalAppData%\dup\cache
+func cacheDir() (string, error) {
+	if cacheDirFlag != empty {
+		return makeDir(cacheDirFlag)
+	}
+	if x := os.Getenv("XDG_CACHE_HOME"); x != empty {
+		return makeDir(filepath.Join(x, "dup"))
+	}
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return empty, err
+	}
+	if runtime.GOOS == "windows" {
+		return makeDir(filepath.Join(base, "dup", "cache"))
+	}
+	return makeDir(filepath.Join(base, "dup"))
+}
+
+// dir for data worth keeping, like checkpoints and the audit log: $XDG_STATE_HOME/dup,
+// or ~/.local/state/dup, ~/Library/Application Support/dup and %LocalAppData%\dup\state
+func stateDir() (string, error) {
+	if stateDirFlag != empty {
+		return makeDir(stateDirFlag)
+	}
+	if x := os.Getenv("XDG_STATE_HOME"); x != empty {
+		return makeDir(filepath.Join(x, "dup"))
+	}
+	switch runtime.GOOS {
+	case "windows":
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return empty, err
+		}
+		return makeDir(filepath.Join(base, "dup", "state"))
+	case "darwin":
+		base, err := os.UserConfigDir()
+		if err != nil {
+			return empty, err
+		}
+		return makeDir(filepath.Join(base, "dup"))
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return empty, err
+	}
+	return makeDir(filepath.Join(home, ".local", "state", "dup"))
+}
+
+func makeDir(dir string) (string, error) {
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+// hash cache file, one per algorithm so that switching -hash keeps the others
+func hashCachePath() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return empty, err
+	}
+	name := "hashes-" + hashFlag
+	if adsFlag {
+		name += "-ads"
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// checkpoint file of -resume for dir
+func resumePath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return empty, err
+	}
+	state, err := stateDir()
+	if err != nil {
+		return empty, err
+	}
+	if err = os.MkdirAll(filepath.Join(state, "checkpoints"), 0700); err != nil {
+		return empty, err
+	}
+	name := fmt.Sprintf("%s-%08x.json", safeName(filepath.Base(abs)), crc32.ChecksumIEEE([]byte(abs)))
+	return filepath.Join(state, "checkpoints", name), nil
+}
+
+// choose the checkpoint of -checkpoint, -resume or -cache and load it
+func setupCheckpoint(dir string) error {
+	var n int
+	for _, set := range []bool{checkpointFlag != empty, resumeFlag, cacheFlag} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 {
+		return errors.New("only one of -checkpoint, -resume and -cache can be given")
+	}
+	var err error
+	switch {
+	case resumeFlag:
+		checkpointFlag, err = resumePath(dir)
+	case cacheFlag:
+		checkpointFlag, err = hashCachePath()
+	}
+	if err != nil || checkpointFlag == empty {
+		return err
+	}
+	return loadCheckpoint(checkpointFlag)
+}
+
+// audit log used unless -audit-log says otherwise
+func defaultAuditLog() (string, error) {
+	state, err := stateDir()
+	if err != nil {
+		return empty, err
+	}
+	return filepath.Join(state, "audit.jsonl"), nil
+}
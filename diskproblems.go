@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// a read that failed partway through a file, where a bad sector or bit rot may be
+type diskProblem struct {
+	path   string
+	offset int64
+	err    string
+}
+
+// files of this scan whose content couldn't be read at some offset, of the scanErrors
+var diskProblems []diskProblem
+
+// error of a read of a file's content, with the offset it failed at
+type readError struct {
+	offset int64
+	err    error
+}
+
+func (e *readError) Error() string {
+	return fmt.Sprintf("%v at byte %d", e.err, e.offset)
+}
+
+func (e *readError) Unwrap() error {
+	return e.err
+}
+
+// the possible disk problems section of reports, nothing when every read went through
+func printDiskProblems(w io.Writer) {
+	if len(diskProblems) == 0 {
+		return
+	}
+	fmt.Fprintf(w, tr("possible disk problems, %d files failed to read partway:\n"), len(diskProblems))
+	for _, p := range diskProblems {
+		fmt.Fprintf(w, "  %s at byte %d: %s\n", p.path, p.offset, p.err)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+)
+
+// dup estimate: how much a file or chunk deduplicating backup would save
+func estimateCmd(args []string) error {
+	flags := flag.NewFlagSet("estimate", flag.ExitOnError)
+	chunked := flags.Bool("chunked", false, "also split files into content-defined chunks, like restic and borg do")
+	avg := byteSize(1 * MB)
+	flags.Var(&avg, "chunk-size", "average chunk size, a power of two, chunks are between half and 8 times of it")
+	blocks := flags.Bool("blocks", false, "also report large files sharing many fixed-size blocks, like VM images or database dumps")
+	blockSize, blockMin := byteSize(128*KB), byteSize(16*MB)
+	flags.Var(&blockSize, "block-size", "block size for -blocks")
+	flags.Var(&blockMin, "block-min-size", "only compare files of at least this size with -blocks")
+	shared := flags.Float64("min-shared", 0.5, "report files with -blocks sharing at least this fraction of the smaller file's blocks")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s estimate [flags] [dir]\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Reports how much space whole-file deduplication, and with -chunked chunk-based deduplication, would save under dir.")
+		fmt.Fprintln(flags.Output(), "With -blocks it also lists large files that are mostly but not exactly identical.")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return errors.New("at most one dir can be given")
+	}
+	if avg < 64 || avg&(avg-1) != 0 {
+		return errors.New("-chunk-size must be a power of two of at least 64")
+	}
+	if blockSize <= 0 {
+		return errors.New("-block-size must be positive")
+	}
+	basedir = "."
+	if flags.NArg() == 1 {
+		basedir = flags.Arg(0)
+	}
+
+	var fds []FileDetail
+	if err := recursiveReadDir(basedir, &fds); err != nil {
+		return err
+	}
+	var total int64
+	for _, f := range fds {
+		total += f.size
+	}
+	dups, err := findDup(basedir)
+	if err != nil {
+		return err
+	}
+	var waste int64
+	for _, g := range dups {
+		_, b := reclaimable(keepFiles(g, keepFlag))
+		waste += b
+	}
+	fmt.Printf("%d files, %d bytes\n", len(fds), total)
+	fmt.Printf("whole files: %d bytes unique, %d bytes saved, ratio %.2f\n", total-waste, waste, ratio(total, total-waste))
+	if *blocks {
+		if err = sharedBlocks(fds, int64(blockSize), int64(blockMin), *shared); err != nil {
+			return err
+		}
+	}
+	if !*chunked {
+		return nil
+	}
+
+	log.Printf("Chunking %d files\n", len(fds))
+	c := newChunker(int64(avg))
+	seen := make(map[[sha256.Size]byte]bool)
+	var chunks, unique int
+	var stored int64
+	// only bytes chunked count, a file that fails midway would look saved otherwise
+	counted := total
+	for _, f := range fds {
+		var read int64
+		err := c.chunks(f.path, func(chunk []byte) {
+			chunks++
+			read += int64(len(chunk))
+			sum := sha256.Sum256(chunk)
+			if !seen[sum] {
+				seen[sum] = true
+				unique++
+				stored += int64(len(chunk))
+			}
+		})
+		if err != nil {
+			log.Printf("skip rest of %s: %v\n", f.path, err)
+			counted -= f.size - read
+		}
+	}
+	fmt.Printf("chunks: %d chunks, %d unique, %d bytes unique, %d bytes saved, ratio %.2f\n", chunks, unique, stored, counted-stored, ratio(counted, stored))
+	return nil
+}
+
+// hash blocks of files of at least min bytes and report pairs sharing at least
+// fraction of the blocks of the smaller one
+func sharedBlocks(fds []FileDetail, size, min int64, fraction float64) error {
+	var large []FileDetail
+	for _, f := range fds {
+		if f.size >= min {
+			large = append(large, f)
+		}
+	}
+	log.Printf("Hashing %d byte blocks of %d files\n", size, len(large))
+	// files holding each block, in the order of large
+	owners := make(map[[sha256.Size]byte][]int)
+	blocks := make([][][sha256.Size]byte, len(large))
+	zero := sha256.Sum256(make([]byte, size))
+	buf := make([]byte, size)
+	for i, f := range large {
+		sums, err := blockSums(f.path, buf)
+		if err != nil {
+			// a file read in part would share too few blocks with the rest
+			log.Printf("skip %s: %v\n", f.path, err)
+			continue
+		}
+		for _, sum := range sums {
+			// zero blocks, e.g. unwritten parts of images, say nothing about content
+			if sum != zero {
+				owners[sum] = append(owners[sum], i)
+				blocks[i] = append(blocks[i], sum)
+			}
+		}
+	}
+
+	type similar struct {
+		a, b   int
+		shared int
+		frac   float64
+	}
+	var found []similar
+	// blocks shared with later files are counted file by file, so that only the
+	// counts of one file are held at a time
+	for a, sums := range blocks {
+		common := make(map[int]int)
+		for _, sum := range sums {
+			files := owners[sum]
+			for _, b := range files[sort.SearchInts(files, a+1):] {
+				common[b]++
+			}
+		}
+		for b, n := range common {
+			smaller := len(blocks[a])
+			if len(blocks[b]) < smaller {
+				smaller = len(blocks[b])
+			}
+			if frac := float64(n) / float64(smaller); frac >= fraction {
+				found = append(found, similar{a, b, n, frac})
+			}
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].frac != found[j].frac {
+			return found[i].frac > found[j].frac
+		}
+		return found[i].shared > found[j].shared
+	})
+	fmt.Printf("blocks: %d pairs of files share at least %.0f%% of their blocks\n", len(found), fraction*100)
+	for _, s := range found {
+		fmt.Printf("  %3.0f%%  %d bytes shared  %s  %s\n", s.frac*100, int64(s.shared)*size, large[s.a].path, large[s.b].path)
+	}
+	return nil
+}
+
+// distinct hashes of the blocks of the file at path, read with buf, in order
+func blockSums(path string, buf []byte) ([][sha256.Size]byte, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	var sums [][sha256.Size]byte
+	seen := make(map[[sha256.Size]byte]bool)
+	for {
+		n, err := io.ReadFull(fh, buf)
+		if n > 0 {
+			sum := sha256.Sum256(buf[:n])
+			if !seen[sum] {
+				seen[sum] = true
+				sums = append(sums, sum)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sums, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func ratio(total, stored int64) float64 {
+	if stored == 0 {
+		return 1
+	}
+	return float64(total) / float64(stored)
+}
+
+// content-defined chunking with a gear hash: a chunk ends where the hash of
+// the last 64 bytes has its top bits clear, so inserting data only changes
+// the chunks around it. Over the average size a mask with fewer bits makes
+// cuts likelier, which keeps chunk sizes close to the average as FastCDC does
+type chunker struct {
+	min, avg, max int
+	maskS, maskL  uint64
+	buf           []byte
+}
+
+// gear table, fixed so that estimates are repeatable
+var gear = func() (g [256]uint64) {
+	x := uint64(0x9e3779b97f4a7c15)
+	for i := range g {
+		// splitmix64
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+		z = (z ^ z>>27) * 0x94d049bb133111eb
+		g[i] = z ^ z>>31
+	}
+	return g
+}()
+
+func newChunker(avg int64) *chunker {
+	bits := 0
+	for 1<<bits < avg {
+		bits++
+	}
+	return &chunker{
+		min:   int(avg / 2),
+		avg:   int(avg),
+		max:   int(avg * 8),
+		maskS: ^uint64(0) << (64 - bits - 2),
+		maskL: ^uint64(0) << (64 - bits + 2),
+		buf:   make([]byte, 0, avg*8),
+	}
+}
+
+// call fn with every chunk of the file at path, the slice is only valid during the call
+func (c *chunker) chunks(path string, fn func(chunk []byte)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReaderSize(f, int(1*MB))
+	var h uint64
+	c.buf = c.buf[:0]
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		c.buf = append(c.buf, b)
+		h = h<<1 + gear[b]
+		n := len(c.buf)
+		if n < c.min {
+			continue
+		}
+		mask := c.maskS
+		if n >= c.avg {
+			mask = c.maskL
+		}
+		if h&mask == 0 || n >= c.max {
+			fn(c.buf)
+			c.buf, h = c.buf[:0], 0
+		}
+	}
+	if len(c.buf) > 0 {
+		fn(c.buf)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// run the -exec command for every group, placeholders are replaced per group:
+// {kept} by the (first) kept file, {dups...} by the files -keep doesn't keep as separate arguments,
+// {size} and {hash} by the group's size and hash; groups only reported or with no
+// duplicates beyond -keep-n are left out
+func execOnDups(template string, dups []FileGroup) error {
+	words, err := execWords(template)
+	if err != nil {
+		return err
+	}
+	var failed int
+	for _, g := range dups {
+		kept, removed, ok := resolveExtra(g)
+		if !ok || len(removed) == 0 {
+			continue
+		}
+		var args []string
+		for _, w := range words {
+			if w == "{dups...}" {
+				for _, f := range removed {
+					args = append(args, f.path)
+				}
+				continue
+			}
+			w = strings.ReplaceAll(w, "{kept}", kept[0].path)
+			w = strings.ReplaceAll(w, "{size}", g.size)
+			w = strings.ReplaceAll(w, "{hash}", g.hash)
+			args = append(args, w)
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err = cmd.Run(); err != nil {
+			log.Printf("exec failed for group %s-%s: %v\n", g.size, g.hash, err)
+			failed++
+			continue
+		}
+		for _, f := range removed {
+			if err = audit("exec", f.path, kept[0].path, f); err != nil {
+				return fmt.Errorf("can't write audit log: %v", err)
+			}
+		}
+	}
+	if failed > 0 {
+		return errors.New(strconv.Itoa(failed) + " of " + strconv.Itoa(len(dups)) + " exec commands failed")
+	}
+	return nil
+}
+
+// words of the -exec template, which must name a command of its own
+func execWords(template string) ([]string, error) {
+	words, err := splitCommand(template)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, errors.New("empty -exec command")
+	}
+	if words[0] == "{dups...}" {
+		return nil, errors.New("-exec command can't start with {dups...}, the first duplicate would be run")
+	}
+	return words, nil
+}
+
+// split command line into words, honoring single and double quotes and backslash escapes
+func splitCommand(s string) ([]string, error) {
+	var words []string
+	var b strings.Builder
+	var quote rune
+	inWord, escaped := false, false
+	for _, r := range s {
+		switch {
+		case escaped:
+			b.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				b.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, b.String())
+				b.Reset()
+				inWord = false
+			}
+		default:
+			b.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape in command")
+	}
+	if inWord {
+		words = append(words, b.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dup export-links: hardlink every duplicate into one folder per group
+func exportLinksCmd(args []string) error {
+	flags := flag.NewFlagSet("export-links", flag.ExitOnError)
+	from := flags.String("from", empty, "take the groups from a result written with -o instead of scanning")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s export-links [flags] OUT [dir]\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Creates folder OUT with one subfolder per duplicate group, holding hardlinks to all files of the group.")
+		fmt.Fprintln(flags.Output(), "Link names are the paths relative to the scanned directory, with / replaced by __.")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		return errors.New("OUT must be given")
+	}
+	out := flags.Arg(0)
+	if entries, err := os.ReadDir(out); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s is not empty", out)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	var dups []FileGroup
+	var err error
+	if *from != empty {
+		if basedir, dups, err = readResult(*from); err != nil {
+			return err
+		}
+	} else {
+		basedir = "."
+		if flags.NArg() == 2 {
+			basedir = flags.Arg(1)
+		}
+		// don't find the links of an earlier export as duplicates
+		if quarantineDir, err = filepath.Abs(out); err != nil {
+			return err
+		}
+		if dups, err = findDup(basedir); err != nil {
+			return err
+		}
+	}
+
+	var links int
+	for i, g := range dups {
+		dir := filepath.Join(out, fmt.Sprintf("%04d-%s-%s", i+1, g.size, safeName(g.hash)))
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		for _, f := range g.files {
+			rel, err := filepath.Rel(basedir, f.path)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				rel = filepath.Base(f.path)
+			}
+			name, err := freeName(filepath.Join(dir, strings.ReplaceAll(rel, string(filepath.Separator), "__")))
+			if err != nil {
+				return err
+			}
+			if err = os.Link(f.path, name); err != nil {
+				return fmt.Errorf("can't link %s, OUT must be on the same filesystem: %v", f.path, err)
+			}
+			links++
+		}
+	}
+	log.Printf("%d links to %d groups created under %s\n", links, len(dups), out)
+	return nil
+}
+
+// name with everything but letters, digits, dot, dash and underscore replaced by _
+func safeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
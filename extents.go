@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// find files of every group that already share their storage, e.g. after an
+// earlier reflink deduplication, and note them
+func noteExtents(dups []FileGroup) {
+	for i := range dups {
+		g := &dups[i]
+		byKey := make(map[string][]string)
+		var keys []string
+		for j := range g.files {
+			f := &g.files[j]
+			if f.offline != empty {
+				continue
+			}
+			var err error
+			if f.extents, err = extentKey(f.path); err != nil {
+				log.Printf("can't get extents of %s: %v\n", f.path, err)
+				continue
+			}
+			if f.extents == empty {
+				continue
+			}
+			if _, ok := byKey[f.extents]; !ok {
+				keys = append(keys, f.extents)
+			}
+			byKey[f.extents] = append(byKey[f.extents], f.path)
+		}
+		for _, k := range keys {
+			if paths := byKey[k]; len(paths) > 1 {
+				g.notes = append(g.notes, fmt.Sprintf("already deduplicated, sharing extents: %s", strings.Join(paths, ", ")))
+			}
+		}
+	}
+}
+
+// number and bytes of removed files whose space would really be freed
+func reclaimable(kept, removed []FileDetail) (int, int64) {
+	freed := freedFiles(kept, removed)
+	var bytes int64
+	for _, f := range freed {
+		bytes += f.onDisk()
+	}
+	return len(freed), bytes
+}
+
+// removed files whose space would really be freed, files sharing extents with
+// a kept file or an earlier removed one free nothing and sparse files only
+// what is allocated
+func freedFiles(kept, removed []FileDetail) []FileDetail {
+	seen := make(map[string]bool)
+	for _, f := range kept {
+		seen[f.extents] = true
+	}
+	var freed []FileDetail
+	for _, f := range removed {
+		if f.extents != empty && seen[f.extents] {
+			continue
+		}
+		seen[f.extents] = true
+		freed = append(freed, f)
+	}
+	return freed
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// FS_IOC_FIEMAP ioctl and its flags, see linux/fiemap.h
+const (
+	fiemap             = 0xc020660b
+	fiemapFlagSync     = 0x1
+	fiemapExtentLast   = 0x1
+	fiemapExtentNoLoc  = 0x2 | 0x4 | 0x8 | 0x80 // unknown, delayed allocation, encoded, inline
+	fiemapExtentShared = 0x2000
+	fiemapHeaderSize   = 32
+	fiemapExtentSize   = 56
+	fiemapBatch        = 64
+)
+
+// physical extents of path as "offset+length,...", empty when none of them is
+// shared with another file or the filesystem can't tell
+func extentKey(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return empty, err
+	}
+	defer f.Close()
+	// uint64s keep the buffer aligned for the kernel
+	words := make([]uint64, (fiemapHeaderSize+fiemapBatch*fiemapExtentSize)/8)
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(&words[0])), len(words)*8)
+	var key []string
+	var start uint64
+	shared := false
+	for {
+		for i := range words {
+			words[i] = 0
+		}
+		native.PutUint64(buf[0:], start)
+		native.PutUint64(buf[8:], ^uint64(0)-start)
+		native.PutUint32(buf[16:], fiemapFlagSync)
+		native.PutUint32(buf[24:], fiemapBatch)
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), fiemap, uintptr(unsafe.Pointer(&words[0]))); errno != 0 {
+			if unsupported(errno) {
+				return empty, nil
+			}
+			return empty, errno
+		}
+		n := int(native.Uint32(buf[20:]))
+		if n == 0 {
+			break
+		}
+		last := false
+		for i := 0; i < n; i++ {
+			e := buf[fiemapHeaderSize+i*fiemapExtentSize:]
+			logical, physical, length := native.Uint64(e[0:]), native.Uint64(e[8:]), native.Uint64(e[16:])
+			flags := native.Uint32(e[40:])
+			if flags&fiemapExtentNoLoc != 0 {
+				return empty, nil
+			}
+			shared = shared || flags&fiemapExtentShared != 0
+			key = append(key, strconv.FormatUint(physical, 10)+"+"+strconv.FormatUint(length, 10))
+			start = logical + length
+			last = flags&fiemapExtentLast != 0
+		}
+		if last {
+			break
+		}
+	}
+	if !shared {
+		return empty, nil
+	}
+	return strings.Join(key, ","), nil
+}
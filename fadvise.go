@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// leave the files read in the page cache instead of asking the kernel to drop them after reading
+var keepCacheFlag bool
+
+// bytes at the start of a file the kernel is asked to read ahead as it is opened
+const readAhead = 1 * MB
+
+// file opened for hashing or comparing, which tells the kernel its pages aren't
+// needed any more when closed, so that a big scan doesn't evict the page cache of
+// the programs actually using it
+type hintedFile struct {
+	*os.File
+	off int64 // of the next Read
+}
+
+// open path for reading from its start to its end if sequential, or at a few
+// places otherwise, with hints for the kernel where the platform takes them
+func openHinted(path string, sequential bool) (*hintedFile, error) {
+	f, err := openWithHints(path, sequential)
+	if err != nil {
+		return nil, err
+	}
+	return &hintedFile{File: f}, nil
+}
+
+// reads failing partway give the offset they failed at, see diskProblems
+func (f *hintedFile) Read(b []byte) (int, error) {
+	n, err := f.File.Read(b)
+	if err != nil && err != io.EOF {
+		err = &readError{f.off + int64(n), err}
+	}
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *hintedFile) ReadAt(b []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(b, off)
+	if err != nil && err != io.EOF {
+		err = &readError{off + int64(n), err}
+	}
+	return n, err
+}
+
+// copies go through Read too, instead of what the file would do on its own
+func (f *hintedFile) WriteTo(w io.Writer) (int64, error) {
+	return io.Copy(w, struct{ io.Reader }{f})
+}
+
+func (f *hintedFile) Close() error {
+	if !keepCacheFlag {
+		dropCache(f.File)
+	}
+	return f.File.Close()
+}
@@ -0,0 +1,36 @@
+//go:build linux && (amd64 || arm64 || loong64 || ppc64le || riscv64)
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// posix_fadvise advice, the same on these architectures
+const (
+	fadvSequential = 2
+	fadvWillNeed   = 3
+	fadvDontNeed   = 4
+)
+
+func fadvise(f *os.File, off, n int64, advice int) {
+	// only a hint, errors change nothing
+	syscall.Syscall6(syscall.SYS_FADVISE64, f.Fd(), uintptr(off), uintptr(n), uintptr(advice), 0, 0)
+}
+
+// open path, telling the kernel a sequential read of it is about to start
+func openWithHints(path string, sequential bool) (*os.File, error) {
+	f, err := os.Open(path)
+	if err != nil || !sequential {
+		return f, err
+	}
+	fadvise(f, 0, 0, fadvSequential)
+	fadvise(f, 0, readAhead, fadvWillNeed)
+	return f, nil
+}
+
+// tell the kernel the cached pages of f can go
+func dropCache(f *os.File) {
+	fadvise(f, 0, 0, fadvDontNeed)
+}
@@ -0,0 +1,12 @@
+//go:build !windows && !(linux && (amd64 || arm64 || loong64 || ppc64le || riscv64))
+
+package main
+
+import "os"
+
+// the kernel only gets hints on Linux and Windows
+func openWithHints(path string, sequential bool) (*os.File, error) {
+	return os.Open(path)
+}
+
+func dropCache(f *os.File) {}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+const fileFlagSequentialScan = 0x08000000
+
+// open path with FILE_FLAG_SEQUENTIAL_SCAN, which makes the cache manager read ahead
+// further and reuse the pages of the file early; os.Open is the fallback
+func openWithHints(path string, sequential bool) (*os.File, error) {
+	if !sequential {
+		return os.Open(path)
+	}
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(p, syscall.GENERIC_READ, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL|fileFlagSequentialScan, 0)
+	if err != nil {
+		return os.Open(path)
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
+
+// windows has no hint for pages that can go, sequential scans reuse them early anyway
+func dropCache(f *os.File) {}
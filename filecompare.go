@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// dup compare: whether two files are identical, and if not, how much they share
+func compareCmd(args []string) error {
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	block := byteSize(compareBlock)
+	flags.Var(&block, "block", "size of the blocks shared content is counted in, content shared at offsets apart by other than a multiple of it isn't found")
+	flags.StringVar(&hashFlag, "hash", "crc32", "content hash to compare blocks by: "+strings.Join(hashNames(), ", "))
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s compare [flags] FILE_A FILE_B\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Tells whether the files are identical, otherwise where they first differ and how much")
+		fmt.Fprintln(flags.Output(), "of their content they share in blocks, and fails.")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("FILE_A and FILE_B must be given")
+	}
+	if err := validHash(hashFlag); err != nil {
+		return err
+	}
+	if block <= 0 {
+		return errors.New("-block must be more than 0")
+	}
+	a, b := flags.Arg(0), flags.Arg(1)
+	offset, err := firstDifference(a, b)
+	if err != nil {
+		return err
+	}
+	if offset < 0 {
+		fmt.Printf("%s and %s are identical\n", a, b)
+		return nil
+	}
+	aBlocks, aSize, err := blockHashes(a, int64(block))
+	if err != nil {
+		return err
+	}
+	bBlocks, bSize, err := blockHashes(b, int64(block))
+	if err != nil {
+		return err
+	}
+	// every block of B matches one block of A with the same content at most
+	left := make(map[blockHash]int)
+	for _, h := range aBlocks {
+		left[h]++
+	}
+	var shared int64
+	for _, h := range bBlocks {
+		if left[h] > 0 {
+			left[h]--
+			shared += h.size
+		}
+	}
+	total := aSize
+	if bSize > total {
+		total = bSize
+	}
+	fmt.Printf("%s and %s differ from byte %d on\n", a, b, offset)
+	fmt.Printf("%s of %s shared in blocks of %s, %.1f%%\n", formatSize(shared), formatSize(total), block.String(), 100*float64(shared)/float64(total))
+	return errors.New("files differ")
+}
+
+// offset of the first byte where files a and b differ, or where the shorter one ends, -1 if identical
+func firstDifference(a, b string) (int64, error) {
+	fa, err := openHinted(a, true)
+	if err != nil {
+		return 0, err
+	}
+	defer fa.Close()
+	fb, err := openHinted(b, true)
+	if err != nil {
+		return 0, err
+	}
+	defer fb.Close()
+	ba, bb := make([]byte, compareBlock), make([]byte, compareBlock)
+	var off int64
+	for {
+		na, err := io.ReadFull(fa, ba)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		nb, err := io.ReadFull(fb, bb)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		n := na
+		if nb < n {
+			n = nb
+		}
+		if !bytes.Equal(ba[:n], bb[:n]) {
+			for i := 0; ba[i] == bb[i]; i++ {
+				off++
+			}
+			return off, nil
+		}
+		if na != nb {
+			return off + int64(n), nil
+		}
+		if int64(na) < compareBlock {
+			return -1, nil
+		}
+		off += int64(n)
+	}
+}
+
+// content hash and length of a block of a file
+type blockHash struct {
+	sum  string
+	size int64
+}
+
+// hashes of the blocks of file in order, with the size of the file
+func blockHashes(file string, size int64) ([]blockHash, int64, error) {
+	f, err := openHinted(file, true)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	var blocks []blockHash
+	var total int64
+	buf := make([]byte, size)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			h := newHash()
+			h.Write(buf[:n])
+			blocks = append(blocks, blockHash{sum: fmt.Sprintf("%x", h.Sum(nil)), size: int64(n)})
+			total += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return blocks, total, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// dup find-copies: where else a file's content is, in trees or the hash cache
+func findCopiesCmd(args []string) error {
+	flags := flag.NewFlagSet("find-copies", flag.ExitOnError)
+	flags.StringVar(&hashFlag, "hash", "crc32", "content hash to compare by: "+strings.Join(hashNames(), ", "))
+	flags.BoolVar(&cacheFlag, "cache", false, "reuse and update the hashes of the -cache, without dirs the copies are looked up in it alone")
+	flags.StringVar(&cacheDirFlag, "cache-dir", empty, "dir of the -cache hashes")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s find-copies [flags] FILE [DIR...]\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Lists the files under the dirs with the same content as FILE, or with -cache and no dirs")
+		fmt.Fprintln(flags.Output(), "the cached files that still have it, and fails when there are none.")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() == 0 || (flags.NArg() == 1 && !cacheFlag) {
+		flags.Usage()
+		return errors.New("FILE and a dir to search, or -cache, must be given")
+	}
+	if err := validHash(hashFlag); err != nil {
+		return err
+	}
+	target := flags.Arg(0)
+	fi, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", target)
+	}
+	if cacheFlag {
+		if checkpointFlag, err = hashCachePath(); err != nil {
+			return err
+		}
+		if err = loadCheckpoint(checkpointFlag); err != nil {
+			return err
+		}
+	}
+	ts := []FileDetail{{path: target, size: fi.Size(), mtime: fi.ModTime()}}
+	applyCheckpoint(ts)
+	t := ts[0]
+	if _, err = hash(&t, false); err != nil {
+		return err
+	}
+	var copies []string
+	if flags.NArg() == 1 {
+		copies = cachedCopies(t)
+	}
+	for _, dir := range flags.Args()[1:] {
+		fds, err := listFiles(dir)
+		if err != nil {
+			return err
+		}
+		applyCheckpoint(fds)
+		for i := range fds {
+			f := &fds[i]
+			if f.size != t.size || checkpointKey(f.path) == checkpointKey(t.path) {
+				continue
+			}
+			h, err := hash(f, false)
+			if err != nil {
+				log.Printf("skip %s: %v\n", f.path, err)
+				continue
+			}
+			if h == t.hash {
+				copies = append(copies, f.path)
+			}
+		}
+		if cacheFlag {
+			if err = saveCheckpoint(checkpointFlag, dir, fds); err != nil {
+				return err
+			}
+		}
+	}
+	for _, c := range copies {
+		fmt.Println(c)
+	}
+	log.Printf("%d copies of %s found, %s\n", len(copies), target, formatSize(int64(len(copies))*t.size))
+	if len(copies) == 0 {
+		return fmt.Errorf("no copies of %s found", target)
+	}
+	return nil
+}
+
+// cached files other than t with its size and hash, which are unchanged since they were hashed
+func cachedCopies(t FileDetail) []string {
+	var copies []string
+	for path, e := range knownHashes {
+		if e.Size != t.size || e.Hash != t.hash || path == checkpointKey(t.path) {
+			continue
+		}
+		if fi, err := os.Stat(path); err == nil && fi.Size() == e.Size && fi.ModTime().Equal(e.Mtime) {
+			copies = append(copies, path)
+		}
+	}
+	sort.Strings(copies)
+	return copies
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// skip files and directories matching these glob patterns, by name or by path relative to the base dir
+var excludeFlag stringList
+
+// ignore files smaller than this
+var minSizeFlag byteSize
+
+// files hashed in parallel, more than one pays off on SSDs and RAID
+var workersFlag = 1
+
+// environment variables setting flags are named DUP_ and the flag name in
+// upper case with - as _, e.g. DUP_MIN_SIZE for -min-size; see flagEnvNames for
+// those of subcommands
+const envPrefix = "DUP_"
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// variables of top-level flags that subcommand flags set too, by the top-level flag name
+var sharedFlags = map[string]any{
+	"allow-root":        &allowRootFlag,
+	"audit-log":         &auditFlag,
+	"cache":             &cacheFlag,
+	"cache-dir":         &cacheDirFlag,
+	"exclude":           &excludeFlag,
+	"finder-tag":        &tagFlag,
+	"force":             &forceFlag,
+	"hash":              &hashFlag,
+	"keep":              &keepFlag,
+	"keep-n":            &keepNFlag,
+	"min-size":          &minSizeFlag,
+	"move-to":           &moveToFlag,
+	"policy-file":       &policyFileFlag,
+	"preserve-metadata": &preserveFlag,
+	"quarantine-keep":   &quarantineKeepFlag,
+	"skip-open":         &skipOpenFlag,
+	"state-dir":         &stateDirFlag,
+	"verify":            &verifyFlag,
+}
+
+// environment variables of a flag of flags, in the order they are looked up: a
+// subcommand flag setting the variable of a top-level flag goes by that flag's
+// variable, e.g. DUP_QUARANTINE_KEEP for quarantine -keep; others by the subcommand
+// and their name, e.g. DUP_REPORT_GREP for report -grep, then by their name alone
+func flagEnvNames(flags *flag.FlagSet, f *flag.Flag) []string {
+	if flags == flag.CommandLine {
+		return []string{envName(f.Name)}
+	}
+	v := reflect.ValueOf(f.Value)
+	for name, p := range sharedFlags {
+		if v.Kind() == reflect.Pointer && v.Pointer() == reflect.ValueOf(p).Pointer() {
+			return []string{envName(name)}
+		}
+	}
+	return []string{envName(flags.Name() + "-" + f.Name), envName(f.Name)}
+}
+
+// parse args into flags GNU style: --name works as -name does, long names
+// can be shortened to any unambiguous prefix, and flags missing on the command
+// line are taken from the environment, values of repeatable flags separated by
+// commas there. Errors exit like flag.ExitOnError does
+func parseFlags(flags *flag.FlagSet, args []string) {
+	args, err := expandFlags(flags, args)
+	if err == nil {
+		err = flags.Parse(args)
+	}
+	if err == nil {
+		err = flagsFromEnv(flags)
+	}
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(flags.Output(), err)
+		flags.Usage()
+		os.Exit(2)
+	}
+}
+
+// args with abbreviated --flags replaced by their full name
+func expandFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	out := append([]string(nil), args...)
+	for i := 0; i < len(out); i++ {
+		a := out[i]
+		if a == "--" || !strings.HasPrefix(a, "-") || a == "-" {
+			// flags end at the first other argument
+			break
+		}
+		dashes := "-"
+		if strings.HasPrefix(a, "--") {
+			dashes = "--"
+		}
+		name, value, hasValue := strings.Cut(a[len(dashes):], "=")
+		f := flags.Lookup(name)
+		if f == nil && dashes == "--" {
+			var matches []string
+			flags.VisitAll(func(c *flag.Flag) {
+				if strings.HasPrefix(c.Name, name) {
+					matches = append(matches, c.Name)
+				}
+			})
+			if len(matches) > 1 {
+				sort.Strings(matches)
+				return nil, fmt.Errorf("flag --%s is ambiguous: --%s", name, strings.Join(matches, ", --"))
+			}
+			if len(matches) == 1 {
+				f = flags.Lookup(matches[0])
+				out[i] = dashes + f.Name
+				if hasValue {
+					out[i] += "=" + value
+				}
+			}
+		}
+		// the value of a flag given apart is no flag itself, even when it starts with -
+		if f != nil && !hasValue && !isBoolFlag(f) {
+			i++
+		}
+	}
+	return out, nil
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// set flags not given on the command line from their DUP_ environment variables,
+// see flagEnvNames
+func flagsFromEnv(flags *flag.FlagSet) error {
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if given[f.Name] || err != nil {
+			return
+		}
+		var name, v string
+		ok := false
+		for _, name = range flagEnvNames(flags, f) {
+			if v, ok = os.LookupEnv(name); ok {
+				break
+			}
+		}
+		if !ok {
+			return
+		}
+		values := []string{v}
+		if _, repeated := f.Value.(*stringList); repeated {
+			values = strings.Split(v, ",")
+		}
+		for _, v := range values {
+			if serr := flags.Set(f.Name, v); serr != nil {
+				err = fmt.Errorf("invalid value %q for %s: %v", v, name, serr)
+				return
+			}
+		}
+	})
+	return err
+}
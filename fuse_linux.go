@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"unsafe"
+)
+
+// FUSE opcodes answered, see linux/fuse.h
+const (
+	fuseLookup      = 1
+	fuseForget      = 2
+	fuseGetattr     = 3
+	fuseOpen        = 14
+	fuseRead        = 15
+	fuseStatfs      = 17
+	fuseRelease     = 18
+	fuseFlush       = 25
+	fuseInit        = 26
+	fuseOpendir     = 27
+	fuseReaddir     = 28
+	fuseReleasedir  = 29
+	fuseAccess      = 34
+	fuseInterrupt   = 36
+	fuseDestroy     = 38
+	fuseBatchForget = 42
+)
+
+const (
+	fuseInHeaderSize = 40
+	fuseMaxWrite     = 128 * KB
+	fuseKeepCache    = 2    // FOPEN_KEEP_CACHE
+	fuseValid        = 3600 // seconds the kernel may cache entries and attributes, the view never changes
+)
+
+// FUSE speaks host byte order
+var native binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+type fuseServer struct {
+	dev    int
+	nodes  []*viewNode // by inode, 0 is unused
+	files  map[uint64]*os.File
+	nextFh uint64
+	uid    uint32
+	gid    uint32
+}
+
+// mount a FUSE filesystem at mnt and serve root until it is unmounted
+func serveFUSE(mnt string, root *viewNode) error {
+	dev, unmount, err := mountFUSE(mnt)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(dev)
+	s := &fuseServer{dev: dev, files: make(map[uint64]*os.File), uid: uint32(os.Getuid()), gid: uint32(os.Getgid())}
+	var collect func(n *viewNode)
+	collect = func(n *viewNode) {
+		s.nodes = append(s.nodes, n)
+		for _, name := range n.names {
+			collect(n.children[name])
+		}
+	}
+	s.nodes = append(s.nodes, nil)
+	collect(root)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		log.Printf("Unmounting %s\n", mnt)
+		if err := unmount(); err != nil {
+			log.Printf("can't unmount %s: %v\n", mnt, err)
+		}
+	}()
+
+	buf := make([]byte, fuseMaxWrite+4*KB)
+	for {
+		n, err := syscall.Read(dev, buf)
+		switch {
+		case err == syscall.EINTR || err == syscall.EAGAIN || err == syscall.ENOENT:
+			// ENOENT: request was interrupted before we got it
+			continue
+		case err == syscall.ENODEV:
+			// unmounted
+			return nil
+		case err != nil:
+			return err
+		}
+		if n < fuseInHeaderSize {
+			return fmt.Errorf("short FUSE request of %d bytes", n)
+		}
+		if err = s.handle(buf[:n]); err != nil {
+			return err
+		}
+	}
+}
+
+// mount directly when root, else through fusermount which hands back the device
+func mountFUSE(mnt string) (int, func() error, error) {
+	if os.Geteuid() == 0 {
+		dev, err := syscall.Open("/dev/fuse", syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			return -1, nil, err
+		}
+		opts := fmt.Sprintf("fd=%d,rootmode=40000,user_id=0,group_id=0", dev)
+		if err = syscall.Mount("dup", mnt, "fuse.dup", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_RDONLY, opts); err != nil {
+			syscall.Close(dev)
+			return -1, nil, err
+		}
+		return dev, func() error { return syscall.Unmount(mnt, syscall.MNT_DETACH) }, nil
+	}
+	bin, err := exec.LookPath("fusermount3")
+	if err != nil {
+		if bin, err = exec.LookPath("fusermount"); err != nil {
+			return -1, nil, errors.New("fusermount not found, install fuse or run as root")
+		}
+	}
+	pair, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		return -1, nil, err
+	}
+	local := os.NewFile(uintptr(pair[0]), "fuse-local")
+	remote := os.NewFile(uintptr(pair[1]), "fuse-remote")
+	defer local.Close()
+	defer remote.Close()
+	cmd := exec.Command(bin, "-o", "ro,nosuid,nodev,fsname=dup,subtype=dup", "--", mnt)
+	cmd.ExtraFiles = []*os.File{remote}
+	cmd.Env = append(os.Environ(), "_FUSE_COMMFD=3")
+	cmd.Stderr = os.Stderr
+	if err = cmd.Run(); err != nil {
+		return -1, nil, fmt.Errorf("%s: %v", bin, err)
+	}
+	oob := make([]byte, syscall.CmsgSpace(4))
+	_, oobn, _, _, err := syscall.Recvmsg(pair[0], make([]byte, 1), oob, 0)
+	if err != nil {
+		return -1, nil, err
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) == 0 {
+		return -1, nil, errors.New("fusermount didn't pass the FUSE device")
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) == 0 {
+		return -1, nil, errors.New("fusermount didn't pass the FUSE device")
+	}
+	return fds[0], func() error { return exec.Command(bin, "-u", "-z", mnt).Run() }, nil
+}
+
+// answer one request, errors only when the device is unusable
+func (s *fuseServer) handle(req []byte) error {
+	op := native.Uint32(req[4:])
+	unique := native.Uint64(req[8:])
+	nodeid := native.Uint64(req[16:])
+	body := req[fuseInHeaderSize:]
+	if op == fuseForget || op == fuseBatchForget || op == fuseInterrupt {
+		// no reply expected, inodes live as long as the mount
+		return nil
+	}
+	var n *viewNode
+	if nodeid > 0 && nodeid < uint64(len(s.nodes)) {
+		n = s.nodes[nodeid]
+	}
+	if n == nil && op != fuseInit && op != fuseDestroy && op != fuseStatfs {
+		return s.reply(unique, syscall.ENOENT, nil)
+	}
+	switch op {
+	case fuseInit:
+		return s.init(unique, body)
+	case fuseDestroy, fuseFlush, fuseAccess, fuseReleasedir:
+		return s.reply(unique, 0, nil)
+	case fuseLookup:
+		name := body
+		for i, c := range body {
+			if c == 0 {
+				name = body[:i]
+				break
+			}
+		}
+		c := n.children[string(name)]
+		if c == nil {
+			return s.reply(unique, syscall.ENOENT, nil)
+		}
+		out := make([]byte, 40, 128)
+		native.PutUint64(out[0:], c.ino)
+		native.PutUint64(out[16:], fuseValid)
+		native.PutUint64(out[24:], fuseValid)
+		return s.reply(unique, 0, s.attr(out, c))
+	case fuseGetattr:
+		out := make([]byte, 16, 104)
+		native.PutUint64(out[0:], fuseValid)
+		return s.reply(unique, 0, s.attr(out, n))
+	case fuseOpen:
+		if n.isDir() {
+			return s.reply(unique, syscall.EISDIR, nil)
+		}
+		if native.Uint32(body)&syscall.O_ACCMODE != syscall.O_RDONLY {
+			return s.reply(unique, syscall.EROFS, nil)
+		}
+		f, err := os.Open(n.path)
+		if err != nil {
+			log.Printf("can't open %s: %v\n", n.path, err)
+			return s.reply(unique, syscall.EIO, nil)
+		}
+		s.nextFh++
+		s.files[s.nextFh] = f
+		return s.reply(unique, 0, s.open(s.nextFh, fuseKeepCache))
+	case fuseOpendir:
+		if !n.isDir() {
+			return s.reply(unique, syscall.ENOTDIR, nil)
+		}
+		return s.reply(unique, 0, s.open(0, 0))
+	case fuseRead:
+		f := s.files[native.Uint64(body)]
+		if f == nil {
+			return s.reply(unique, syscall.EBADF, nil)
+		}
+		b := make([]byte, native.Uint32(body[16:]))
+		read, err := f.ReadAt(b, int64(native.Uint64(body[8:])))
+		if err != nil && err != io.EOF {
+			log.Printf("can't read %s: %v\n", n.path, err)
+			return s.reply(unique, syscall.EIO, nil)
+		}
+		return s.reply(unique, 0, b[:read])
+	case fuseRelease:
+		fh := native.Uint64(body)
+		if f := s.files[fh]; f != nil {
+			f.Close()
+			delete(s.files, fh)
+		}
+		return s.reply(unique, 0, nil)
+	case fuseReaddir:
+		return s.reply(unique, 0, s.readdir(n, native.Uint64(body[8:]), int(native.Uint32(body[16:]))))
+	case fuseStatfs:
+		out := make([]byte, 80)
+		native.PutUint64(out[24:], uint64(len(s.nodes)-1))
+		native.PutUint32(out[40:], 4096)
+		native.PutUint32(out[44:], 255)
+		native.PutUint32(out[48:], 4096)
+		return s.reply(unique, 0, out)
+	}
+	return s.reply(unique, syscall.ENOSYS, nil)
+}
+
+// negotiate the protocol: 7.12 is the oldest version with the structures used here
+func (s *fuseServer) init(unique uint64, body []byte) error {
+	major, minor := native.Uint32(body), native.Uint32(body[4:])
+	if major < 7 || major == 7 && minor < 12 {
+		return s.reply(unique, syscall.EPROTO, nil)
+	}
+	if major > 7 || minor > 31 {
+		minor = 31
+	}
+	out := make([]byte, 64)
+	native.PutUint32(out[0:], 7)
+	native.PutUint32(out[4:], minor)
+	native.PutUint32(out[8:], native.Uint32(body[8:])) // max_readahead
+	native.PutUint16(out[16:], 16)                     // max_background
+	native.PutUint16(out[18:], 12)                     // congestion_threshold
+	native.PutUint32(out[20:], uint32(fuseMaxWrite))
+	native.PutUint32(out[24:], 1) // time_gran
+	if minor < 23 {
+		out = out[:24]
+	}
+	return s.reply(unique, 0, out)
+}
+
+// append fuse_attr of n to out
+func (s *fuseServer) attr(out []byte, n *viewNode) []byte {
+	a := make([]byte, 88)
+	mode, nlink := uint32(syscall.S_IFREG|0444), uint32(1)
+	if n.isDir() {
+		mode, nlink = syscall.S_IFDIR|0555, 2
+	}
+	sec, nsec := uint64(n.mtime.Unix()), uint32(n.mtime.Nanosecond())
+	native.PutUint64(a[0:], n.ino)
+	native.PutUint64(a[8:], uint64(n.size))
+	native.PutUint64(a[16:], uint64(n.size+511)/512)
+	for i := 0; i < 3; i++ {
+		native.PutUint64(a[24+8*i:], sec)
+		native.PutUint32(a[48+4*i:], nsec)
+	}
+	native.PutUint32(a[60:], mode)
+	native.PutUint32(a[64:], nlink)
+	native.PutUint32(a[68:], s.uid)
+	native.PutUint32(a[72:], s.gid)
+	native.PutUint32(a[80:], 4096)
+	return append(out, a...)
+}
+
+// fuse_open_out
+func (s *fuseServer) open(fh uint64, flags uint32) []byte {
+	out := make([]byte, 16)
+	native.PutUint64(out[0:], fh)
+	native.PutUint32(out[8:], flags)
+	return out
+}
+
+// fuse_dirents of n from entry offset on, as many as fit into size bytes
+func (s *fuseServer) readdir(n *viewNode, offset uint64, size int) []byte {
+	names := append([]string{".", ".."}, n.names...)
+	var out []byte
+	for i := offset; i < uint64(len(names)); i++ {
+		c := n
+		switch names[i] {
+		case ".":
+		case "..":
+			c = n.parent
+		default:
+			c = n.children[names[i]]
+		}
+		typ := uint32(syscall.DT_REG)
+		if c.isDir() {
+			typ = syscall.DT_DIR
+		}
+		l := 24 + (len(names[i])+7)&^7
+		if len(out)+l > size {
+			break
+		}
+		ent := make([]byte, l)
+		native.PutUint64(ent[0:], c.ino)
+		native.PutUint64(ent[8:], i+1)
+		native.PutUint32(ent[16:], uint32(len(names[i])))
+		native.PutUint32(ent[20:], typ)
+		copy(ent[24:], names[i])
+		out = append(out, ent...)
+	}
+	return out
+}
+
+// send the answer to request unique, errno 0 for success
+func (s *fuseServer) reply(unique uint64, errno syscall.Errno, data []byte) error {
+	out := make([]byte, 16+len(data))
+	native.PutUint32(out[0:], uint32(len(out)))
+	native.PutUint32(out[4:], uint32(-int32(errno)))
+	native.PutUint64(out[8:], unique)
+	copy(out[16:], data)
+	if _, err := syscall.Write(s.dev, out); err != nil && err != syscall.ENOENT {
+		// ENOENT: the request was interrupted meanwhile
+		return err
+	}
+	return nil
+}
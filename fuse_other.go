@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// FUSE is only spoken on Linux
+func serveFUSE(mnt string, root *viewNode) error {
+	return errors.New("dup mount is only supported on Linux")
+}
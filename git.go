@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// take hashes of tracked files from the git index instead of reading them
+var gitFlag bool
+
+// leave out tracked files identical to their committed version
+var gitCommittedFlag bool
+
+// -hash of -git: the blob id git gives content, the SHA-1 of "blob <size>\0" and the bytes
+const gitHash = "git"
+
+// blob ids of tracked files under the scanned dir unchanged since they were staged, by absolute path
+var gitBlobs map[string]string
+
+// tracked files identical to HEAD, by absolute path
+var gitCommitted map[string]bool
+
+// check dir is in a git work tree and read blob ids of its unmodified files
+func setupGit(dir string) error {
+	if !gitFlag && !gitCommittedFlag {
+		return nil
+	}
+	top, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return fmt.Errorf("-git needs dir in a git work tree: %v", err)
+	}
+	top = strings.TrimSpace(top)
+	// git names the real paths, files are found under dir as given
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return err
+	}
+	under := func(p string) (string, bool) {
+		rel, err := filepath.Rel(real, filepath.Join(top, filepath.FromSlash(p)))
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return empty, false
+		}
+		return filepath.Join(abs, rel), true
+	}
+	if format, err := git(top, "rev-parse", "--show-object-format"); err == nil && strings.TrimSpace(format) != "sha1" {
+		return fmt.Errorf("%s uses %s object ids, -git only knows sha1", top, strings.TrimSpace(format))
+	}
+
+	// mode, blob id, stage and path of every index entry
+	index, err := git(top, "ls-files", "-s", "-z")
+	if err != nil {
+		return err
+	}
+	modified, err := git(top, "ls-files", "-m", "-z")
+	if err != nil {
+		return err
+	}
+	changed := make(map[string]bool)
+	for _, p := range strings.Split(modified, "\x00") {
+		changed[p] = true
+	}
+	gitBlobs = make(map[string]string)
+	for _, e := range strings.Split(index, "\x00") {
+		info, p, ok := strings.Cut(e, "\t")
+		fields := strings.Fields(info)
+		// symlinks and submodules have no file content of their own, conflicted files no single blob
+		if !ok || len(fields) != 3 || (fields[0] != "100644" && fields[0] != "100755") || fields[2] != "0" || changed[p] {
+			continue
+		}
+		if file, ok := under(p); ok {
+			gitBlobs[file] = fields[1]
+		}
+	}
+
+	if gitCommittedFlag {
+		gitCommitted = make(map[string]bool)
+		// an unborn branch has nothing committed yet
+		tree, _ := git(top, "ls-tree", "-r", "-z", "HEAD")
+		for _, e := range strings.Split(tree, "\x00") {
+			info, p, ok := strings.Cut(e, "\t")
+			fields := strings.Fields(info)
+			if !ok || len(fields) != 3 {
+				continue
+			}
+			if file, ok := under(p); ok && gitBlobs[file] == fields[2] {
+				gitCommitted[file] = true
+			}
+		}
+		log.Printf("%d tracked files identical to HEAD left out\n", len(gitCommitted))
+	}
+	if gitFlag {
+		hashFlag = gitHash
+		log.Printf("%d unmodified files tracked by git in %s\n", len(gitBlobs), top)
+	}
+	return nil
+}
+
+// output of git run in dir
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exit *exec.ExitError
+		if errors.As(err, &exit) && stderr.Len() > 0 {
+			return empty, errors.New(strings.TrimSpace(stderr.String()))
+		}
+		return empty, err
+	}
+	return string(out), nil
+}
+
+// set hashes of files git has the blob id of, return how many
+func applyGit(fds []FileDetail) int {
+	var n int
+	for i := range fds {
+		if id, ok := gitBlobs[checkpointKey(fds[i].path)]; ok && fds[i].hash == empty && !ruled(fds[i].path) {
+			fds[i].hash = id
+			n++
+		}
+	}
+	return n
+}
+
+// whether file is tracked and identical to its committed version, with -git-exclude-committed
+func committed(file string) bool {
+	return gitCommitted != nil && gitCommitted[checkpointKey(file)]
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+	"sort"
+)
+
+// count hardlinks of one file once, for snapshot trees of rsync --link-dest
+// and the like, where every generation links the unchanged files
+var collapseLinksFlag bool
+
+// replace the hardlinks of every file by one of them, the first by path, with
+// the other paths in its links, so that only distinct files can be duplicates
+func collapseLinks(fds []FileDetail) []FileDetail {
+	sort.Slice(fds, func(i, j int) bool { return fds[i].path < fds[j].path })
+	first := make(map[string]int)
+	result := fds[:0]
+	var collapsed int
+	for _, f := range fds {
+		id, n, err := fileID(f.path)
+		if err != nil || n < 2 {
+			result = append(result, f)
+			continue
+		}
+		if i, ok := first[id]; ok {
+			result[i].links = append(result[i].links, f.path)
+			collapsed++
+			continue
+		}
+		first[id] = len(result)
+		result = append(result, f)
+	}
+	log.Printf("%d hardlinks of %d files collapsed\n", collapsed, len(first))
+	return result
+}
+
+// files with each of their collapsed hardlinks as a file of its own: the
+// content of a removed file only goes when all its links go
+func withLinks(files []FileDetail) []FileDetail {
+	var result []FileDetail
+	for _, f := range files {
+		result = append(result, f)
+		for _, l := range f.links {
+			c := f
+			c.path, c.links = l, nil
+			result = append(result, c)
+		}
+	}
+	return result
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	gohash "hash"
+	"hash/crc32"
+	"sort"
+	"strings"
+)
+
+// content hashes files can be grouped by, -hash picks one,
+// the package is renamed as hash() is the file hash of the scan
+var hashers = map[string]func() gohash.Hash{
+	"crc32":  func() gohash.Hash { return crc32.New(table) },
+	"crc32c": func() gohash.Hash { return crc32.New(castagnoli) },
+	"xxhash": func() gohash.Hash { return newXXHash64() },
+	"sha256": sha256.New,
+	"blake3": func() gohash.Hash { return newBlake3() },
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// hash files are grouped by, subcommands use the default
+var hashFlag = "crc32"
+
+// new hash of the -hash algorithm
+func newHash() gohash.Hash {
+	if hashFlag == gitHash {
+		return sha1.New()
+	}
+	// only samples are hashed when files are compared
+	if hashFlag == noHash {
+		return crc32.NewIEEE()
+	}
+	return hashers[hashFlag]()
+}
+
+func validHash(name string) error {
+	if _, ok := hashers[name]; !ok {
+		return fmt.Errorf("unknown -hash %q, must be one of %s", name, strings.Join(hashNames(), ", "))
+	}
+	return nil
+}
+
+func hashNames() []string {
+	var names []string
+	for name := range hashers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
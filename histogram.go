@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// dup histogram: file sizes and the hashing they would take, before a long scan
+func histogramCmd(args []string) error {
+	flags := flag.NewFlagSet("histogram", flag.ExitOnError)
+	rate := byteSize(200 * MB)
+	flags.Var(&rate, "read-rate", "read throughput per second to project the hashing time with, dup bench measures it")
+	flags.Var(&excludeFlag, "exclude", "skip files and directories matching this glob pattern, as for dup -exclude, can be repeated")
+	flags.Var(&minSizeFlag, "min-size", "ignore files smaller than this, as for dup -min-size")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s histogram [flags] DIR\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Walks DIR and prints how many files and bytes there are by size, how many of them share their size")
+		fmt.Fprintln(flags.Output(), "with another file and would be hashed, and how long that would take, to tune -min-size and -exclude.")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("DIR must be given")
+	}
+	if rate <= 0 {
+		return errors.New("-read-rate must be positive")
+	}
+	basedir = flags.Arg(0)
+
+	start := time.Now()
+	var fds []FileDetail
+	if err := recursiveReadDir(basedir, &fds); err != nil {
+		return err
+	}
+	walk := time.Since(start)
+	perSize := make(map[int64]int)
+	for _, f := range fds {
+		perSize[f.size]++
+	}
+
+	// buckets grow by 4, from below 1KB up
+	type bucket struct {
+		files, candidates int
+		bytes, hashed     int64
+	}
+	var buckets []bucket
+	var min, max int64 // hash workload when samples rule out every large file, and when they rule out none
+	var files, candidates int
+	var total, hashed int64
+	for _, f := range fds {
+		i := 0
+		for limit := KB; f.size >= limit; limit *= 4 {
+			i++
+		}
+		for len(buckets) <= i {
+			buckets = append(buckets, bucket{})
+		}
+		b := &buckets[i]
+		b.files++
+		b.bytes += f.size
+		files++
+		total += f.size
+		if perSize[f.size] < 2 {
+			continue
+		}
+		b.candidates++
+		b.hashed += f.size
+		candidates++
+		hashed += f.size
+		max += f.size
+		if f.size > int64(sampleThresholdFlag) && !f.sparse {
+			min += 3 * samplesize
+		} else {
+			min += f.size
+		}
+	}
+
+	fmt.Printf("%-15s %10s %10s %10s %10s\n", "size", "files", "bytes", "same size", "to hash")
+	var limit int64 = KB
+	for i, b := range buckets {
+		label := "< " + formatSize(KB)
+		if i > 0 {
+			label = formatSize(limit) + " - " + formatSize(limit*4)
+			limit *= 4
+		}
+		if b.files == 0 {
+			continue
+		}
+		fmt.Printf("%-15s %10d %10s %10d %10s  %s\n", label, b.files, formatSize(b.bytes), b.candidates, formatSize(b.hashed), bar(b.hashed, hashed, 30))
+	}
+	fmt.Printf("%-15s %10d %10s %10d %10s\n", "total", files, formatSize(total), candidates, formatSize(hashed))
+	fmt.Printf("\nwalk took %v, hashing would read %s to %s, about %v to %v at %s/s\n",
+		walk.Round(time.Millisecond), formatSize(min), formatSize(max),
+		projected(min, int64(rate)), projected(max, int64(rate)), formatSize(int64(rate)))
+	return nil
+}
+
+// time to read n bytes at rate bytes per second
+func projected(n, rate int64) time.Duration {
+	d := time.Duration(float64(n) / float64(rate) * float64(time.Second))
+	if d < time.Minute {
+		return d.Round(10 * time.Millisecond)
+	}
+	return d.Round(time.Second)
+}
+
+// bar of width characters at most, filled by the share of n in total
+func bar(n, total int64, width int) string {
+	if total == 0 {
+		return empty
+	}
+	return strings.Repeat("#", int(float64(width)*float64(n)/float64(total)+0.5))
+}
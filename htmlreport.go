@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"sort"
+)
+
+// write a self-contained HTML page of the groups, largest waste first, with the
+// files -keep keeps and the ones it would remove, for people to look through
+func writeHTMLReport(path, dir string, dups []FileGroup) error {
+	out, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	waste := make([]int64, len(dups))
+	var files int
+	var total int64
+	for i, g := range dups {
+		kept, removed := keepFiles(g, keepFlag)
+		_, waste[i] = reclaimable(kept, removed)
+		files += len(removed)
+		total += waste[i]
+	}
+	order := make([]int, len(dups))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return waste[order[i]] > waste[order[j]] })
+
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>dup: %s</title>\n", html.EscapeString(dir))
+	fmt.Fprint(w, "<style>body{font-family:sans-serif;margin:2em}table{border-collapse:collapse;margin-bottom:1.5em}td,th{padding:2px 8px;text-align:left}.keep{color:#080}.remove{color:#b00}</style>\n</head><body>\n")
+	fmt.Fprintf(w, "<h1>%s</h1>\n<p>%d duplicate groups, %d redundant files, %d bytes reclaimable</p>\n",
+		html.EscapeString(dir), len(dups), files, total)
+	for _, i := range order {
+		g := dups[i]
+		kept, removed := keepFiles(g, keepFlag)
+		var owner string
+		if g.owner != empty {
+			owner = ", owned by " + g.owner
+		}
+		fmt.Fprintf(w, "<table>\n<tr><th colspan=\"2\">%s bytes, %s %s, %d copies, %s, %d bytes reclaimable%s</th></tr>\n",
+			html.EscapeString(g.size), html.EscapeString(hashFlag), html.EscapeString(g.hash), len(g.files), html.EscapeString(g.tier), waste[i], html.EscapeString(owner))
+		for _, f := range kept {
+			fmt.Fprintf(w, "<tr class=\"keep\"><td>keep</td><td>%s</td></tr>\n", html.EscapeString(f.path))
+		}
+		for _, f := range removed {
+			fmt.Fprintf(w, "<tr class=\"remove\"><td>remove</td><td>%s</td></tr>\n", html.EscapeString(f.path))
+		}
+		for _, n := range g.notes {
+			fmt.Fprintf(w, "<tr><td></td><td><em>%s</em></td></tr>\n", html.EscapeString(n))
+		}
+		fmt.Fprint(w, "</table>\n")
+	}
+	if len(diskProblems) > 0 {
+		fmt.Fprintf(w, "<h2>Possible disk problems</h2>\n<p>%d files failed to read partway, where a bad sector or bit rot may be</p>\n<table>\n", len(diskProblems))
+		for _, p := range diskProblems {
+			fmt.Fprintf(w, "<tr class=\"remove\"><td>%s</td><td>byte %d</td><td>%s</td></tr>\n", html.EscapeString(p.path), p.offset, html.EscapeString(p.err))
+		}
+		fmt.Fprint(w, "</table>\n")
+	}
+	fmt.Fprint(w, "</body></html>\n")
+	if err = w.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// language of progress text, prompts and report headings: auto (from LC_ALL, LC_MESSAGES or LANG), en, de, zh or ja
+var langFlag string
+
+// catalog of the chosen language, nil for English
+var catalog map[string]string
+
+// translations by language, keyed by the English format, they must take the same verbs in the same
+// order or name them with explicit argument indexes, missing ones are printed in English
+var catalogs = map[string]map[string]string{
+	"de": {
+		"Looking for duplicated files under %s\n": "Suche doppelte Dateien unter %s\n",
+		"Found %d files\n":                        "%d Dateien gefunden\n",
+		"%d possible duplication groups left\n":   "%d mögliche Duplikatgruppen übrig\n",
+		"%d duplication groups found":             "%d Duplikatgruppen gefunden",
+		"No duplication found!":                   "Keine Duplikate gefunden!",
+		"About to %s %d files in %d groups, %s bytes under %s\nType yes to continue: ":  "%[1]s: %[2]d Dateien in %[3]d Gruppen, %[4]s Bytes unter %[5]s\nZum Fortfahren yes eingeben: ",
+		"About to act on %d files in %d groups under %s\nType yes to continue: ":        "Aktion auf %d Dateien in %d Gruppen unter %s\nZum Fortfahren yes eingeben: ",
+		"dup: %d duplicate groups under %s, %d redundant files, %s bytes reclaimable\n": "dup: %d Duplikatgruppen unter %s, %d überzählige Dateien, %s Bytes freizugeben\n",
+		"  ... and %d more groups\n":                                 "  ... und %d weitere Gruppen\n",
+		"  %s bytes  %d copies of %s\n":                              "  %s Bytes  %d Kopien von %s\n",
+		"waste by extension":                                         "Verschwendung nach Endung",
+		"waste by type":                                              "Verschwendung nach Typ",
+		"  %5.1f%%  %s bytes  %s\n":                                  "  %5.1f%%  %s Bytes  %s\n",
+		"  %5.1f%%  %s bytes  %d others\n":                           "  %5.1f%%  %s Bytes  %d weitere\n",
+		"possible disk problems, %d files failed to read partway:\n": "mögliche Plattenprobleme, %d Dateien ließen sich nur teilweise lesen:\n",
+	},
+	"zh": {
+		"Looking for duplicated files under %s\n": "正在查找 %s 下的重复文件\n",
+		"Found %d files\n":                        "找到 %d 个文件\n",
+		"%d possible duplication groups left\n":   "剩余 %d 个可能的重复组\n",
+		"%d duplication groups found":             "找到 %d 个重复组",
+		"No duplication found!":                   "未找到重复文件！",
+		"About to %s %d files in %d groups, %s bytes under %s\nType yes to continue: ":  "即将对 %[5]s 下 %[3]d 个组中的 %[2]d 个文件（%[4]s 字节）执行 %[1]s\n输入 yes 继续：",
+		"About to act on %d files in %d groups under %s\nType yes to continue: ":        "即将处理 %[3]s 下 %[2]d 个组中的 %[1]d 个文件\n输入 yes 继续：",
+		"dup: %d duplicate groups under %s, %d redundant files, %s bytes reclaimable\n": "dup：%[2]s 下有 %[1]d 个重复组，%[3]d 个多余文件，可释放 %[4]s 字节\n",
+		"  ... and %d more groups\n":                                 "  ……另有 %d 个组\n",
+		"  %s bytes  %d copies of %s\n":                              "  %[1]s 字节  %[3]s 的 %[2]d 个副本\n",
+		"waste by extension":                                         "按扩展名统计的浪费",
+		"waste by type":                                              "按类型统计的浪费",
+		"  %5.1f%%  %s bytes  %s\n":                                  "  %5.1f%%  %s 字节  %s\n",
+		"  %5.1f%%  %s bytes  %d others\n":                           "  %5.1f%%  %s 字节  其他 %d 项\n",
+		"possible disk problems, %d files failed to read partway:\n": "可能的磁盘问题，%d 个文件读取到中途失败：\n",
+	},
+	"ja": {
+		"Looking for duplicated files under %s\n": "%s 以下の重複ファイルを検索しています\n",
+		"Found %d files\n":                        "%d 個のファイルが見つかりました\n",
+		"%d possible duplication groups left\n":   "重複の可能性があるグループが %d 個残っています\n",
+		"%d duplication groups found":             "%d 個の重複グループが見つかりました",
+		"No duplication found!":                   "重複は見つかりませんでした！",
+		"About to %s %d files in %d groups, %s bytes under %s\nType yes to continue: ":  "%[5]s 以下の %[3]d グループ、%[2]d 個のファイル（%[4]s バイト）に %[1]s を実行します\n続行するには yes と入力してください: ",
+		"About to act on %d files in %d groups under %s\nType yes to continue: ":        "%[3]s 以下の %[2]d グループ、%[1]d 個のファイルを処理します\n続行するには yes と入力してください: ",
+		"dup: %d duplicate groups under %s, %d redundant files, %s bytes reclaimable\n": "dup: %[2]s 以下に %[1]d 個の重複グループ、%[3]d 個の余分なファイル、%[4]s バイト解放可能\n",
+		"  ... and %d more groups\n":                                 "  ... ほか %d グループ\n",
+		"  %s bytes  %d copies of %s\n":                              "  %s バイト  %[3]s のコピー %[2]d 個\n",
+		"waste by extension":                                         "拡張子別の無駄",
+		"waste by type":                                              "種類別の無駄",
+		"  %5.1f%%  %s bytes  %s\n":                                  "  %5.1f%%  %s バイト  %s\n",
+		"  %5.1f%%  %s bytes  %d others\n":                           "  %5.1f%%  %s バイト  その他 %d 件\n",
+		"possible disk problems, %d files failed to read partway:\n": "ディスクの問題の可能性、%d 個のファイルが途中で読み取れませんでした:\n",
+	},
+}
+
+// pick the catalog by -lang, or by the locale environment variables with auto
+func setupLang() error {
+	lang := langFlag
+	if lang == "auto" {
+		lang = "en"
+		for _, v := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+			// like de_DE.UTF-8, C and POSIX mean English
+			if l := os.Getenv(v); l != empty {
+				lang, _, _ = strings.Cut(strings.ToLower(l), "_")
+				lang, _, _ = strings.Cut(lang, ".")
+				break
+			}
+		}
+		if catalogs[lang] == nil {
+			lang = "en"
+		}
+	}
+	if lang == "en" {
+		catalog = nil
+		return nil
+	}
+	if catalog = catalogs[lang]; catalog == nil {
+		return fmt.Errorf("unknown -lang %s, use auto, en, de, zh or ja", langFlag)
+	}
+	return nil
+}
+
+// the message s in the chosen language, s itself when it has no translation
+func tr(s string) string {
+	if t, ok := catalog[s]; ok {
+		return t
+	}
+	return s
+}
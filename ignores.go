@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// groups to mark as intentional, by id, remembered in the state dir for later scans
+var ignoreGroupFlag stringList
+
+// groups to take the mark off again
+var unignoreGroupFlag stringList
+
+// also report groups marked as intentional
+var showIgnoredFlag bool
+
+// a group marked as intentional, its id is only meaningful with the hash it was made with
+type ignoredGroup struct {
+	Algorithm string    `json:"algorithm"`
+	Since     time.Time `json:"since"`
+}
+
+// id of a group as given to -ignore-group, its size and hash as in log messages
+func (fg FileGroup) id() string {
+	return fg.size + "-" + fg.hash
+}
+
+// file of groups marked as intentional
+func ignoredPath() (string, error) {
+	state, err := stateDir()
+	if err != nil {
+		return empty, err
+	}
+	return filepath.Join(state, "ignored-groups.json"), nil
+}
+
+// groups marked as intentional by id, after adding -ignore-group and removing -unignore-group ones
+func loadIgnored() (map[string]ignoredGroup, error) {
+	path, err := ignoredPath()
+	if err != nil {
+		return nil, err
+	}
+	ignored := make(map[string]ignoredGroup)
+	b, err := os.ReadFile(path)
+	if err == nil {
+		if err = json.Unmarshal(b, &ignored); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if len(ignoreGroupFlag) == 0 && len(unignoreGroupFlag) == 0 {
+		return ignored, nil
+	}
+	for _, id := range ignoreGroupFlag {
+		ignored[id] = ignoredGroup{Algorithm: hashFlag, Since: time.Now()}
+	}
+	for _, id := range unignoreGroupFlag {
+		delete(ignored, id)
+	}
+	if b, err = json.MarshalIndent(ignored, empty, "  "); err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(path, append(b, '\n'), 0644); err != nil {
+		return nil, err
+	}
+	log.Printf("%d groups marked as intentional in %s\n", len(ignored), path)
+	return ignored, nil
+}
+
+// leave out the groups marked as intentional, unless -show-ignored
+func suppressIgnored(dups []FileGroup) ([]FileGroup, error) {
+	ignored, err := loadIgnored()
+	if err != nil || showIgnoredFlag || len(ignored) == 0 {
+		return dups, err
+	}
+	result := dups[:0]
+	for _, g := range dups {
+		if e, ok := ignored[g.id()]; ok && e.Algorithm == hashFlag {
+			continue
+		}
+		result = append(result, g)
+	}
+	if n := len(dups) - len(result); n > 0 {
+		log.Printf("%d groups marked as intentional left out, -show-ignored reports them\n", n)
+	}
+	return result, nil
+}
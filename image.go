@@ -0,0 +1,184 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// scan sources read from docker save, and from an OCI image layout dir
+const (
+	dockerPrefix = "docker://"
+	ociPrefix    = "oci:"
+)
+
+// layers hashed so far by id or digest, with the image they were read from:
+// images with a common base share those layers, which are stored only once
+var seenLayers = make(map[string]string)
+
+func isOCILayout(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "oci-layout"))
+	return err == nil
+}
+
+// first 12 hex digits of a layer id or digest, as docker shows them
+func shortID(id string) string {
+	id = id[strings.Index(id, ":")+1:]
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// hash files in all layers of image ref, streamed from docker save
+func readDockerImage(ref string) ([]FileDetail, error) {
+	cmd := exec.Command("docker", "save", ref)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	files, err := readImageArchive(bufio.NewReaderSize(out, int(1*MB)), dockerPrefix+ref)
+	if err != nil {
+		// let docker finish writing, it won't exit otherwise
+		io.Copy(io.Discard, out)
+	}
+	if werr := cmd.Wait(); err == nil && werr != nil {
+		err = fmt.Errorf("docker save: %v", werr)
+	}
+	return files, err
+}
+
+// hash files of the layers in a docker save archive, which holds them as
+// <id>/layer.tar, or as blobs/sha256/<digest> next to configs and manifests
+func readImageArchive(in *bufio.Reader, source string) ([]FileDetail, error) {
+	tr := tar.NewReader(in)
+	var files []FileDetail
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var id string
+		if dir, name := path.Split(hdr.Name); name == "layer.tar" {
+			id = strings.TrimSuffix(dir, "/")
+		} else if strings.HasPrefix(hdr.Name, "blobs/") {
+			id = strings.Replace(strings.TrimPrefix(hdr.Name, "blobs/"), "/", ":", 1)
+		}
+		if hdr.Typeflag != tar.TypeReg || id == empty {
+			continue
+		}
+		br := bufio.NewReaderSize(tr, 64*int(KB))
+		if !isTarLayer(br) {
+			continue
+		}
+		layer, err := readLayer(br, source, id)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, layer...)
+	}
+}
+
+// whether r starts with a tar header or gzip data, the formats of layers
+func isTarLayer(r *bufio.Reader) bool {
+	b, err := r.Peek(512)
+	if len(b) >= 2 && b[0] == 0x1f && b[1] == 0x8b {
+		return true
+	}
+	return err == nil && string(b[257:262]) == "ustar"
+}
+
+// hash files of layer id unless another image had it already
+func readLayer(r *bufio.Reader, source, id string) ([]FileDetail, error) {
+	if owner, ok := seenLayers[id]; ok {
+		log.Printf("layer %s of %s is shared with %s\n", shortID(id), source, owner)
+		return nil, nil
+	}
+	seenLayers[id] = source
+	files, err := readTarStream(r, fmt.Sprintf("%s@%s:", source, shortID(id)))
+	if err != nil {
+		return nil, fmt.Errorf("layer %s: %v", shortID(id), err)
+	}
+	return files, nil
+}
+
+// index.json, image indexes and image manifests of an OCI layout, one struct reads them all
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+type ociIndex struct {
+	Manifests []ociDescriptor `json:"manifests"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+// hash files in the layers of every image of the OCI image layout dir
+func readOCILayout(dir string) ([]FileDetail, error) {
+	b, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	return readOCIIndex(dir, ociPrefix+dir, b)
+}
+
+func readOCIIndex(dir, source string, b []byte) ([]FileDetail, error) {
+	var idx ociIndex
+	if err := json.Unmarshal(b, &idx); err != nil {
+		return nil, err
+	}
+	var files []FileDetail
+	for _, m := range idx.Manifests {
+		mb, err := os.ReadFile(ociBlob(dir, m.Digest))
+		if err != nil {
+			return nil, err
+		}
+		src := source
+		if ref := m.Annotations["org.opencontainers.image.ref.name"]; ref != empty {
+			src += "#" + ref
+		}
+		more, err := readOCIIndex(dir, src, mb)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, more...)
+	}
+	for _, l := range idx.Layers {
+		if strings.HasSuffix(l.MediaType, "+zstd") {
+			log.Printf("skip layer %s of %s: zstd compression is not supported\n", shortID(l.Digest), source)
+			continue
+		}
+		f, err := os.Open(ociBlob(dir, l.Digest))
+		if err != nil {
+			return nil, err
+		}
+		layer, err := readLayer(bufio.NewReaderSize(f, int(1*MB)), source, l.Digest)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, layer...)
+	}
+	return files, nil
+}
+
+// path of the blob with digest algorithm:hex
+func ociBlob(dir, digest string) string {
+	return filepath.Join(dir, "blobs", strings.Replace(digest, ":", string(filepath.Separator), 1))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// dup import: copy files into a library unless their content is already there
+func importCmd(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	into := flags.String("into", empty, "library dir to import into")
+	dryRun := flags.Bool("n", false, "only tell what would be done")
+	auditLog := flags.String("audit-log", empty, "append every copy to this JSON lines file")
+	flags.BoolVar(&cacheFlag, "cache", false, "reuse and update the hashes of library files kept in the cache dir, as dup -cache does")
+	flags.StringVar(&cacheDirFlag, "cache-dir", empty, "dir of the -cache hashes")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s import -into LIBRARY [flags] SRC...\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Copies files of SRC to the same relative path in LIBRARY, skipping files whose content already exists anywhere in LIBRARY.")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if *into == empty || flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("-into and at least one SRC must be given")
+	}
+	if *auditLog != empty && !*dryRun {
+		if err := openAudit(*auditLog); err != nil {
+			return err
+		}
+		defer auditFile.Close()
+	}
+
+	if err := setupCheckpoint(*into); err != nil {
+		return err
+	}
+	log.Printf("Indexing %s\n", *into)
+	ix, err := indexTree(*into)
+	if err != nil {
+		return err
+	}
+	var copied, existing int
+	var bytes int64
+	for _, src := range flags.Args() {
+		fds, err := listFiles(src)
+		if err != nil {
+			return err
+		}
+		for i := range fds {
+			f := &fds[i]
+			same, err := ix.find(f)
+			if err != nil {
+				return err
+			}
+			if same != nil {
+				existing++
+				continue
+			}
+			rel, err := filepath.Rel(src, f.path)
+			if err != nil {
+				return err
+			}
+			target, err := freeName(filepath.Join(*into, rel))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("copy %s -> %s\n", f.path, target)
+			added := *f
+			if !*dryRun {
+				if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+					return err
+				}
+				if _, err = verifiedCopy(f.path, target); err != nil {
+					return err
+				}
+				if err = audit("copy", f.path, target, *f); err != nil {
+					return err
+				}
+				added.path = target
+			}
+			// a second copy on the card is then found as existing
+			ix.add(added)
+			copied++
+			bytes += f.size
+		}
+	}
+	log.Printf("%d files (%d bytes) imported, %d already in %s\n", copied, bytes, existing, *into)
+	if cacheFlag {
+		return saveCheckpoint(checkpointFlag, *into, ix.files())
+	}
+	return nil
+}
+
+// path itself when nothing is there, otherwise the first free "name-N.ext" next to it
+func freeName(path string) (string, error) {
+	ext := filepath.Ext(path)
+	base := path[:len(path)-len(ext)]
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(path); errors.Is(err, os.ErrNotExist) {
+			return path, nil
+		} else if err != nil {
+			return empty, err
+		}
+		path = base + "-" + strconv.Itoa(i) + ext
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+// content index of a tree, files are only hashed when a file of the same size is looked up
+type treeIndex struct {
+	bySize map[int64][]*FileDetail
+}
+
+// list every regular file under dir, empty ones included
+func listFiles(dir string) ([]FileDetail, error) {
+	var fds []FileDetail
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fds = append(fds, FileDetail{path: path, size: fi.Size(), mtime: fi.ModTime()})
+		return nil
+	})
+	return fds, err
+}
+
+// index every regular file under dir, with the hashes of the loaded cache
+func indexTree(dir string) (*treeIndex, error) {
+	fds, err := listFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	applyCheckpoint(fds)
+	ix := &treeIndex{bySize: make(map[int64][]*FileDetail)}
+	for _, f := range fds {
+		ix.add(f)
+	}
+	return ix, nil
+}
+
+func (ix *treeIndex) add(f FileDetail) {
+	ix.bySize[f.size] = append(ix.bySize[f.size], &f)
+}
+
+// files of the index
+func (ix *treeIndex) files() []FileDetail {
+	var fds []FileDetail
+	for _, same := range ix.bySize {
+		for _, f := range same {
+			fds = append(fds, *f)
+		}
+	}
+	return fds
+}
+
+// a file of the index with the same content as f, nil if there is none; equal hashes
+// are confirmed byte by byte, so that a collision never passes for a copy
+func (ix *treeIndex) find(f *FileDetail) (*FileDetail, error) {
+	candidates := ix.bySize[f.size]
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	h, err := hash(f, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range candidates {
+		ch, err := hash(c, false)
+		if err != nil {
+			return nil, err
+		}
+		if ch != h {
+			continue
+		}
+		if off, err := firstDifference(f.path, c.path); err != nil {
+			return nil, err
+		} else if off < 0 {
+			return c, nil
+		}
+	}
+	return nil, nil
+}
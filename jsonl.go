@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// -o file of -format jsonl, groups are written to it by the scan as they are confirmed
+var (
+	streamFile io.WriteCloser
+	streamEnc  *json.Encoder
+)
+
+// open the JSON lines file groups found by findDup go to right away
+func startStream(path string) error {
+	f, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	streamFile, streamEnc = f, json.NewEncoder(f)
+	return nil
+}
+
+// write a line for each of the groups just hashed, after the checks the
+// complete result gets later: comparators, notes, and the groups left out
+func streamGroups(groups []FileGroup) error {
+	if streamEnc == nil || len(groups) == 0 {
+		return nil
+	}
+	// notes are added to the files in place, the result keeps its own
+	copies := make([]FileGroup, len(groups))
+	for i, g := range groups {
+		copies[i] = g
+		copies[i].files = append([]FileDetail(nil), g.files...)
+	}
+	copies, err := refine(copies, comparators)
+	if err != nil {
+		return err
+	}
+	if strongFlag != empty {
+		noteStrong(copies)
+	}
+	setTiers(copies)
+	noteExtents(copies)
+	if compareXattrFlag == "warn" || compareACLFlag == "warn" {
+		if err = noteMetadata(copies); err != nil {
+			return err
+		}
+	}
+	if copies, err = suppressIgnored(copies); err != nil {
+		return err
+	}
+	if copies, err = suppressMirrors(copies); err != nil {
+		return err
+	}
+	if len(referenceDirs) > 0 {
+		copies = withReference(copies)
+	}
+	if len(catalogFlag) > 0 {
+		copies = withLocal(copies)
+	}
+	for _, g := range copies {
+		if len(g.files) < minCopiesFlag || (reportTiers != nil && !reportTiers[g.tier]) {
+			continue
+		}
+		if _, b := reclaimable(keepFiles(g, keepFlag)); b < int64(minWasteFlag) {
+			continue
+		}
+		// one write per line, so that readers following the file never see half a group
+		if err = streamEnc.Encode(newResultGroup(g)); err != nil {
+			return err
+		}
+	}
+	// compressed, what is there so far is readable too
+	if z, ok := streamFile.(*gzipFile); ok {
+		return z.Flush()
+	}
+	return nil
+}
+
+// finish the JSON lines file: close it after a scan streamed into it, or
+// write all groups when they were read with -from
+func writeJSONL(path string, dups []FileGroup) error {
+	if streamFile == nil {
+		if err := startStream(path); err != nil {
+			return err
+		}
+		for _, g := range dups {
+			if err := streamEnc.Encode(newResultGroup(g)); err != nil {
+				return err
+			}
+		}
+	}
+	return streamFile.Close()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// ways to replace a duplicate, in fallback order
+type linkMode int
+
+const (
+	reportOnly linkMode = iota
+	hardlinkMode
+	reflinkMode
+)
+
+func (m linkMode) String() string {
+	switch m {
+	case hardlinkMode:
+		return "hardlink"
+	case reflinkMode:
+		return "reflink"
+	}
+	return "report-only"
+}
+
+var errNotSupported = errors.New("operation not supported")
+
+// atomically replace dst with a link of src, dst is left untouched on failure
+func replaceWithLink(src, dst string, mode linkMode) error {
+	tmp := dst + ".dup-tmp"
+	var err error
+	switch mode {
+	case reflinkMode:
+		err = reflink(src, tmp)
+	case hardlinkMode:
+		err = os.Link(src, tmp)
+	default:
+		return errNotSupported
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// FICLONE ioctl, supported by btrfs, XFS and others
+const ficlone = 0x40049409
+
+// create dst as copy-on-write clone of src
+func reflink(src, dst string) error {
+	s, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	fi, err := s.Stat()
+	if err != nil {
+		return err
+	}
+	d, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, d.Fd(), ficlone, s.Fd())
+	if err = d.Close(); errno != 0 {
+		return errno
+	}
+	return err
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// reflink is only implemented with the Linux FICLONE ioctl
+func reflink(src, dst string) error {
+	return errNotSupported
+}
@@ -0,0 +1,49 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// whether path a and b are on the same device, links can't cross devices
+func sameDevice(a, b string) (bool, error) {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	as, aok := ai.Sys().(*syscall.Stat_t)
+	bs, bok := bi.Sys().(*syscall.Stat_t)
+	return aok && bok && as.Dev == bs.Dev, nil
+}
+
+// error telling the filesystem can't do the link operation
+func unsupported(err error) bool {
+	for _, e := range []syscall.Errno{syscall.EXDEV, syscall.EOPNOTSUPP, syscall.ENOTSUP,
+		syscall.EINVAL, syscall.ENOTTY, syscall.EPERM, syscall.EMLINK} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// identity of the file at path shared by all its hardlinks, and its number of links
+func fileID(path string) (string, uint64, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return empty, 0, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return empty, 0, errNotSupported
+	}
+	return fmt.Sprintf("%d:%d", st.Dev, st.Ino), uint64(st.Nlink), nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// whether path a and b are on the same volume, links can't cross volumes
+func sameDevice(a, b string) (bool, error) {
+	aa, err := filepath.Abs(a)
+	if err != nil {
+		return false, err
+	}
+	ab, err := filepath.Abs(b)
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(filepath.VolumeName(aa), filepath.VolumeName(ab)), nil
+}
+
+// windows error codes of operations the filesystem can't do
+const (
+	errorInvalidFunction syscall.Errno = 1
+	errorNotSameDevice   syscall.Errno = 17
+	errorNotSupported    syscall.Errno = 50
+	errorTooManyLinks    syscall.Errno = 1142
+)
+
+// error telling the filesystem can't do the link operation
+func unsupported(err error) bool {
+	for _, e := range []syscall.Errno{errorInvalidFunction, errorNotSameDevice, errorNotSupported, errorTooManyLinks} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// identity of the file at path shared by all its hardlinks, and its number of links
+func fileID(path string) (string, uint64, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return empty, 0, err
+	}
+	h, err := syscall.CreateFile(p, 0, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return empty, 0, err
+	}
+	defer syscall.CloseHandle(h)
+	var info syscall.ByHandleFileInformation
+	if err = syscall.GetFileInformationByHandle(h, &info); err != nil {
+		return empty, 0, err
+	}
+	return fmt.Sprintf("%x:%x%08x", info.VolumeSerialNumber, info.FileIndexHigh, info.FileIndexLow), uint64(info.NumberOfLinks), nil
+}
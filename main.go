@@ -1,6 +1,8 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"hash/crc32"
 	"io"
@@ -8,20 +10,15 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
-)
-
-const (
-	_        = iota // ignore first value by assigning to blank identifier
-	KB int64 = 1 << (10 * iota)
-	MB
-	GB
-	TB
+	"sync"
+	"time"
 )
 
 // file larger than this size will be considered as large file, will hash by samples instead of whole file
-const samplethreshold int64 = 10 * MB
+var sampleThresholdFlag = byteSize(10 * MB)
 
 // sample piece size
 const samplesize int64 = 4 * KB
@@ -33,51 +30,632 @@ var basedir string
 
 var table = crc32.MakeTable(crc32.IEEE)
 
+// include NTFS alternate data streams in file hash (Windows only)
+var adsFlag bool
+
+// also look into filesystem snapshot directories
+var snapshotsFlag bool
+
+// comma separated backup structures to skip, see backupPresets
+var presetsFlag string
+
+// enumerate files from the NTFS change journal instead of listing directories (Windows only)
+var usnFlag bool
+
+// replace duplicates with hardlinks to the kept file
+var hardlinkFlag bool
+
+// replace duplicates with reflinks (copy-on-write clones) of the kept file
+var reflinkFlag bool
+
+// delete duplicates, keeping one file per group
+var deleteFlag bool
+
+// how files with different extended attributes or ACLs are treated: split or warn
+var compareXattrFlag string
+var compareACLFlag string
+
+// JSON lines file every delete and link is recorded to
+var auditFlag string
+
+// act without asking for confirmation
+var forceFlag bool
+
+// allow acting on filesystem roots and the home directory
+var allowRootFlag bool
+
+// move duplicates into this quarantine dir instead of deleting them
+var moveToFlag string
+
+// command to run for every duplicate group
+var execFlag string
+
+// plugin commands, see plugin.go for the protocol
+var pluginFlag stringList
+
+// only report groups of at least this many files
+var minCopiesFlag int
+
+// only report groups freeing at least this many bytes
+var minWasteFlag byteSize
+
+// only group files with identical content and modification time
+var matchMtimeFlag bool
+
+// which files of a group are kept, see keepFiles; first for subcommands without -keep
+var keepFlag = "first"
+
+// how many files of a group are kept at least, for duplicates kept as redundancy on purpose
+var keepNFlag int
+
+// write found groups to this JSON file
+var outputFlag stringList
+
+// act on groups of a saved scan result instead of scanning
+var fromFlag string
+
+// move deleted duplicates to the recycle bin
+var trashFlag bool
+
+// tag duplicates in Finder instead of deleting them
+var tagFlag string
+
+// print a short summary instead of every group
+var summaryFlag bool
+
+// break reclaimable bytes down by extension and content type
+var breakdownFlag bool
+
+// carry newest mtime, ownership, permissions and xattrs of replaced duplicates over to the kept file
+var preserveFlag bool
+
+// subcommands, anything else on the command line is a directory to scan
+var commands = map[string]func(args []string) error{
+	"audit":           auditCmd,
+	"plan":            planCmd,
+	"merge":           mergeCmd,
+	"import":          importCmd,
+	"cp":              cpCmd,
+	"tree-diff":       treeDiffCmd,
+	"export-links":    exportLinksCmd,
+	"mount":           mountCmd,
+	"estimate":        estimateCmd,
+	"report":          reportCmd,
+	"bench":           benchCmd,
+	"scan":            scanCmd,
+	"histogram":       histogramCmd,
+	"apply":           applyCmd,
+	"missing":         missingCmd,
+	"check":           checkCmd,
+	"quarantine":      quarantineCmd,
+	"compare":         compareCmd,
+	"find-copies":     findCopiesCmd,
+	"query":           queryCmd,
+	"catalog":         catalogCmd,
+	"merge-manifests": mergeManifestsCmd,
+	"pack":            packCmd,
+	"unpack":          unpackCmd,
+	"scrub":           scrubCmd,
+}
+
 func main() {
 	var err error
 	var dups []FileGroup
 	if len(os.Args) > 1 {
-		basedir = os.Args[1]
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err = cmd(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+	flag.BoolVar(&adsFlag, "ads", false, "include NTFS alternate data streams in file hash (Windows only)")
+	flag.BoolVar(&usnFlag, "usn", false, "enumerate files from the NTFS change journal instead of listing directories (Windows only, needs admin)")
+	flag.BoolVar(&snapshotsFlag, "include-snapshots", false, "also look into filesystem snapshot directories (.zfs, .snapshot, #snapshot, ...)")
+	flag.StringVar(&presetsFlag, "backup-presets", "none", "comma separated backup structures to skip: timemachine, filehistory, borg, restic, all or none")
+	flag.BoolVar(&hardlinkFlag, "hardlink", false, "replace duplicates with hardlinks to the file -keep keeps")
+	flag.BoolVar(&reflinkFlag, "reflink", false, "replace duplicates with reflinks of the file -keep keeps, falls back to hardlink")
+	flag.BoolVar(&deleteFlag, "delete", false, "delete duplicates, keeping the file -keep keeps")
+	flag.BoolVar(&preserveFlag, "preserve-metadata", false, "apply newest mtime, ownership, permissions and xattrs of removed duplicates to the kept file")
+	flag.BoolVar(&skipOpenFlag, "skip-open", false, "leave duplicates that SMB clients have open, as smbstatus of the local Samba server lists them with their oplocks and leases, or local programs on Linux, as they are instead of replacing them under active sessions")
+	flag.StringVar(&ignoreRulesFlag, "ignore-rules", empty, "file of rules leaving byte ranges or lines of some files out of their hash, e.g. *.log lines ^#timestamp")
+	flag.BoolVar(&collapseLinksFlag, "collapse-hardlinks", false, "treat hardlinks of a file as one file, e.g. in rsync --link-dest snapshots, so only distinct copies are duplicates, actions handle all links")
+	flag.Var(&ignoreGroupFlag, "ignore-group", "mark the group with this id, SIZE-HASH of its header, e.g. 1024-e6c1c582, as intentional, so that this and later scans leave it out, can be repeated")
+	flag.Var(&unignoreGroupFlag, "unignore-group", "report the group with this id again, can be repeated")
+	flag.StringVar(&tiersFlag, "tiers", empty, "only report groups of these comma separated tiers: exact (matched by a collision resistant -hash or -strong-hash), probable (by a fast hash only) and similar (after -ignore-rules or by a plugin), default all")
+	flag.StringVar(&actTiersFlag, "act-tiers", empty, "only act on groups of these comma separated tiers, e.g. exact, the others are only reported, default all")
+	flag.Var(&catalogFlag, "catalog", "add the files of the drive cataloged as this label, see dup catalog, as offline copies to the scan, all for every cataloged drive, can be repeated; offline copies are reported, never acted on")
+	flag.Var(&referenceFlag, "reference", "read-only dir of originals: only files elsewhere with a copy in it are reported, and they are what actions remove, files in it are never touched, can be repeated")
+	flag.Var(&allowMirrorFlag, "allow-mirror", "dirs A"+string(filepath.ListSeparator)+"B mirroring each other on purpose, copies at the same relative path under both aren't duplicates, can be repeated")
+	flag.BoolVar(&showIgnoredFlag, "show-ignored", false, "also report groups marked as intentional")
+	flag.IntVar(&minCopiesFlag, "min-copies", 2, "only report groups of at least this many copies, e.g. 3 to leave out pairs")
+	flag.BoolVar(&scopeByOwnerFlag, "scope-by-owner", false, "split groups by the owners of their files, so that each user gets the copies they can clean up themselves; -o names with {owner} write a report per user")
+	flag.BoolVar(&matchMtimeFlag, "match-mtime", false, "only group files whose modification time is identical too, copies with other mtimes are kept apart")
+	flag.StringVar(&compareXattrFlag, "compare-xattr", empty, "files with different extended attributes are put in separate groups (split) or reported (warn) (Linux only)")
+	flag.StringVar(&compareACLFlag, "compare-acl", empty, "files with different ACLs are put in separate groups (split) or reported (warn) (Linux only)")
+	flag.StringVar(&auditFlag, "audit-log", empty, "append every delete, move and link to this JSON lines file, default audit.jsonl in the state dir, off for none")
+	flag.StringVar(&cacheDirFlag, "cache-dir", empty, "dir of the -cache hashes, default $XDG_CACHE_HOME/dup (~/.cache/dup, ~/Library/Caches/dup, %LocalAppData%\\dup\\cache)")
+	flag.StringVar(&stateDirFlag, "state-dir", empty, "dir of -resume checkpoints and the audit log, default $XDG_STATE_HOME/dup (~/.local/state/dup, ~/Library/Application Support/dup, %LocalAppData%\\dup\\state)")
+	flag.BoolVar(&cacheFlag, "cache", false, "reuse hashes of files unchanged in size and mtime since earlier runs, kept in the cache dir")
+	flag.BoolVar(&resumeFlag, "resume", false, "keep a checkpoint of the scanned dir in the state dir, like -checkpoint without naming a file")
+	flag.BoolVar(&forceFlag, "force", false, "act on duplicates without asking for confirmation, required when not running on a terminal")
+	flag.BoolVar(&allowRootFlag, "allow-root", false, "allow acting on duplicates when the base dir is a filesystem root or the home directory")
+	flag.Var(&quarantineKeepFlag, "quarantine-keep", "with -move-to, purge files quarantined longer ago than this, e.g. 30d, as dup quarantine purge does")
+	flag.StringVar(&moveToFlag, "move-to", empty, "move duplicates into this quarantine dir, keeping their path relative to the base dir")
+	flag.StringVar(&execFlag, "exec", empty, "run command for every group, {kept}, {dups...}, {size} and {hash} are replaced")
+	flag.Var(&pluginFlag, "plugin", "start this plugin command providing comparators or actions, can be repeated")
+	flag.StringVar(&policyFileFlag, "policy-file", empty, "YAML list of rules resolving each group by where its files are, e.g. delete duplicates under /downloads of files under /library, groups no rule matches are only reported")
+	flag.StringVar(&keepFlag, "keep", "first", "which file of a group to keep: first (by path), oldest, newest, shortest-path or under:DIR")
+	flag.IntVar(&keepNFlag, "keep-n", 1, "keep this many files of each group, the first ones by -keep, and only remove further copies")
+	flag.StringVar(&verifyFlag, "verify", "auto", "check files before acting on them: off, size (size and mtime unchanged), hash (rehashed) or auto (hash with -from, size otherwise), groups with changed files are skipped")
+	flag.Var(&outputFlag, "o", "also write found groups to this file, as JSON for dup plan and -from, or as -format or its name says: .jsonl, .parquet, .sqlite or .db, .sarif, .html for a report to read, .txt for the -summary; can be repeated to get several from one scan")
+	flag.StringVar(&formatFlag, "format", "json", "format of -o: json, which -from reads back, parquet with a row per file (path, size, hash, group_id, mtime) for analytics, jsonl with a line per group written as soon as it is confirmed, to follow long scans with jq, sqlite, a database of runs, groups, files and errors that each scan adds a run to and -from reads the latest of, html, a page of the groups to read, or summary, the -summary text; implied by the name of the file, e.g. .sqlite, .html or .txt")
+	flag.StringVar(&compressFlag, "compress", empty, "compress the -o, -sarif and -plan files with gzip or zstd (the zstd command), by default as a .gz or .zst name says; -from, dup report and dup apply read them back")
+	flag.StringVar(&sarifFlag, "sarif", empty, "also write a SARIF warning for every duplicate -keep would remove to this file, for CI code scanning annotations")
+	flag.StringVar(&fromFlag, "from", empty, "use groups of this saved scan result instead of scanning")
+	flag.BoolVar(&trashFlag, "trash", false, "with -delete, move duplicates to the Trash (macOS Finder, Windows Recycle Bin, Synology #recycle) instead of removing them")
+	flag.StringVar(&tagFlag, "finder-tag", empty, "tag duplicates with this Finder tag for review instead of deleting them (macOS only)")
+	flag.BoolVar(&summaryFlag, "summary", false, "print a short summary instead of every group, e.g. for scheduled task notifications")
+	flag.BoolVar(&noHashFlag, "no-hash", false, "compare the files of a size byte by byte in lockstep instead of hashing them, files drop out at their first difference, faster for few candidates and free of collisions")
+	flag.StringVar(&confirmFlag, "confirm", "hash", "how files whose samples match, see -sample-threshold, are confirmed: hash, reading each to the end, or bytes, comparing them block by block in lockstep, groups split at their first differing block and files stop being read once they differ from all others")
+	flag.StringVar(&strongFlag, "strong-hash", empty, "confirm groups with this collision resistant hash, sha256 or blake3, and record it in the output, -o results and the -cache")
+	flag.StringVar(&hashFlag, "hash", "crc32", "content hash to group files by: "+strings.Join(hashNames(), ", "))
+	flag.DurationVar(&maxDurationFlag, "max-duration", 0, "stop hashing after this long, e.g. 2h, and report the groups confirmed so far")
+	flag.Var(&maxHashedFlag, "max-bytes-hashed", "stop hashing after reading this much, e.g. 500GB, and report the groups confirmed so far")
+	flag.StringVar(&checkpointFlag, "checkpoint", empty, "keep file hashes in this file, so that a scan stopped by a budget continues where it stopped")
+	flag.StringVar(&pprofFlag, "pprof", empty, "serve pprof profiles on this address while running, e.g. :6060")
+	flag.StringVar(&tlsCertFlag, "tls-cert", empty, "serve -pprof over HTTPS with this PEM certificate, together with -tls-key")
+	flag.StringVar(&tlsKeyFlag, "tls-key", empty, "PEM private key of -tls-cert")
+	flag.StringVar(&authTokenFlag, "auth-token", empty, "require this bearer token from clients of -pprof, better set as $DUP_AUTH_TOKEN")
+	flag.StringVar(&authBasicFlag, "auth-basic", empty, "require this user:password login from clients of -pprof, better set as $DUP_AUTH_BASIC")
+	flag.StringVar(&traceFlag, "trace", empty, "write a Go execution trace with a region per scan stage to this file, for go tool trace")
+	flag.StringVar(&otlpFlag, "otlp", empty, "send scan stage spans to this OpenTelemetry collector by OTLP/HTTP, e.g. http://localhost:4318, default $OTEL_EXPORTER_OTLP_ENDPOINT")
+	flag.StringVar(&progressFormatFlag, "progress-format", empty, "emit progress events (stage, files, bytes, rate, eta) in this format on stderr: json")
+	flag.StringVar(&progressToFlag, "progress-to", empty, "send progress events to this socket instead of stderr: unix:PATH or tcp:HOST:PORT")
+	flag.DurationVar(&progressIntervalFlag, "progress-interval", time.Second, "time between two progress events")
+	flag.Var(&excludeFlag, "exclude", "skip files and directories matching this glob pattern, by name or path relative to dir, can be repeated")
+	flag.Var(&minSizeFlag, "min-size", "ignore files smaller than this, e.g. 4k, 10MiB or 1.5GB")
+	flag.Var(&minWasteFlag, "min-waste", "only report groups whose removable copies free at least this much, e.g. 100MB")
+	flag.Var(&sampleThresholdFlag, "sample-threshold", "files larger than this are first compared by samples of their beginning, middle and end, then hashed fully")
+	flag.BoolVar(&keepCacheFlag, "keep-cache", false, "leave the files read in the page cache, by default the kernel is told they can go after hashing, so that a scan of a live server doesn't evict what its programs use")
+	flag.IntVar(&retriesFlag, "retries", 3, "times a read failing with a transient error, like EIO or a timeout on SMB or NFS, is tried again, with growing pauses, before the file is left out and noted")
+	flag.BoolVar(&retryUnreadableFlag, "retry-unreadable", false, "try files again that couldn't be read in the last runs and haven't changed since, which are skipped otherwise")
+	flag.DurationVar(&sourceWaitFlag, "source-wait", 5*time.Minute, "when the scanned dir becomes unavailable, e.g. a network share drops, wait this long for it to come back and continue, instead of failing on every file")
+	flag.StringVar(&readOrderFlag, "read-order", "path", "order files are hashed in: path, keeping dirs together, inode, the order files were likely written to disk in, which keeps spinning disks reading sequentially, or size, largest first")
+	flag.IntVar(&workersFlag, "workers", 1, "files hashed in parallel, more than 1 helps on SSDs and RAID, less on single disks")
+	flag.BoolVar(&gitFlag, "git", false, "in a git work tree, take hashes of unmodified tracked files from the index instead of reading them, files are hashed as git blobs")
+	flag.BoolVar(&gitCommittedFlag, "git-exclude-committed", false, "in a git work tree, leave out tracked files identical to their committed version")
+	flag.StringVar(&langFlag, "lang", "auto", "language of progress text, prompts and summaries: auto (from $LC_ALL, $LC_MESSAGES or $LANG), en, de, zh or ja, results files stay as they are")
+	flag.StringVar(&colorFlag, "color", "auto", "color groups, kept and removable files and sizes: auto (on a terminal, unless $NO_COLOR is set), always or never")
+	flag.StringVar(&planFlag, "plan", empty, "write what -delete, -trash, -hardlink or -reflink would do with every file to this plan, as JSON if it ends in .json, for editing and dup apply, instead of acting")
+	flag.BoolVar(&breakdownFlag, "breakdown", false, "show which extensions and file types the reclaimable bytes belong to")
+	flag.BoolVar(&quotaImpactFlag, "quota-impact", false, "show the disk usage of every user and group under the dir and how much of it the -keep policy frees, to see whose quotas shrink most")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %[1]s [flags] [dir]\n       %[1]s audit [-log file] [flags]\n       %[1]s plan [flags] result.json\n       %[1]s merge [flags] SRC DST\n       %[1]s import -into LIBRARY [flags] SRC...\n       %[1]s cp [flags] SRC DST\n       %[1]s tree-diff [flags] A B\n       %[1]s export-links [flags] OUT [dir]\n       %[1]s mount [flags] MOUNTPOINT [dir]\n       %[1]s estimate [flags] [dir]\n       %[1]s report -treemap FILE | -grep PATTERN [flags] [dir]\n       %[1]s bench [flags] DIR\n       %[1]s histogram [flags] DIR\n       %[1]s apply [flags] PLAN\n       %[1]s missing -source DIR -replica DIR [flags]\n       %[1]s check [-max-waste SIZE] [-max-groups N] [-max-files N] [flags] [dir]\n       %[1]s quarantine purge -keep AGE [flags] DIR\n       %[1]s quarantine restore [flags] [PATTERN]\n       %[1]s scan [-stdin-tar|-stdin-zip] [flags] [docker://IMAGE|oci:DIR|dir]...\n       %[1]s compare [flags] FILE_A FILE_B\n       %[1]s find-copies [flags] FILE [DIR...]\n       %[1]s query -hash HASH | -path PREFIX [flags]\n       %[1]s catalog add|find|list|remove [flags] [DIR|PATH...|LABEL...]\n       %[1]s merge-manifests [flags] MANIFEST...\n       %[1]s pack -o STORE [flags] DIR\n       %[1]s unpack MANIFEST [-C DIR] [flags]\n       %[1]s scrub [flags] DIR\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "\nLong flags can be given as --name and shortened to a unique prefix. Flags missing on the\ncommand line are read from %sNAME environment variables, e.g. %s=1MB for -min-size, and\nthose of subcommands from %sCOMMAND_NAME or %sNAME ones, e.g. %s=30d for quarantine -keep.\n", envPrefix, envName("min-size"), envPrefix, envPrefix, envName("quarantine-keep"))
+	}
+	parseFlags(flag.CommandLine, os.Args[1:])
+	if workersFlag < 1 {
+		log.Fatal("-workers must be at least 1")
+	}
+	if err := validReadOrder(readOrderFlag); err != nil {
+		log.Fatal(err)
+	}
+	var n int
+	for _, a := range []bool{deleteFlag, moveToFlag != empty, hardlinkFlag || reflinkFlag, tagFlag != empty} {
+		if a {
+			n++
+		}
+	}
+	if n > 1 && policyFileFlag == empty {
+		log.Fatal("only one of -delete, -move-to, -hardlink/-reflink and -finder-tag can be given")
+	}
+	var planned string
+	if planFlag != empty {
+		if planned, err = plannedAction(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if tagFlag != empty && platformTag == nil {
+		log.Fatal("-finder-tag is only supported on macOS")
+	}
+	if (compareXattrFlag != empty || compareACLFlag != empty) && !xattrSupported {
+		log.Fatal("-compare-xattr and -compare-acl are only supported on Linux")
+	}
+	for _, v := range []string{compareXattrFlag, compareACLFlag} {
+		if v != empty && v != "split" && v != "warn" {
+			log.Fatalf("invalid compare mode %q, must be split or warn", v)
+		}
+	}
+	if err := validCompress(compressFlag); err != nil {
+		log.Fatal(err)
+	}
+	if formatFlag != "json" && formatFlag != "jsonl" && formatFlag != "parquet" && formatFlag != "sqlite" && formatFlag != "html" && formatFlag != "summary" {
+		log.Fatalf("unknown -format %q, must be json, jsonl, parquet, sqlite, html or summary", formatFlag)
+	}
+	if len(outputFlag) > 1 && formatFlag != "json" {
+		log.Fatal("-format is for a single -o, several are written in the format their names say")
+	}
+	var streams int
+	for _, o := range outputFlag {
+		f := outputFormat(o)
+		if compressFlag != empty && (f == "parquet" || f == "sqlite") {
+			log.Fatalf("-compress is for text files, %s is written uncompressed as %s", o, f)
+		}
+		if f == "jsonl" {
+			streams++
+		}
+		if f == "sqlite" {
+			if err = checkSQLiteResult(o); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+	if streams > 1 {
+		log.Fatal("only one -o can be a jsonl stream")
+	}
+	if err = validScoped(); err != nil {
+		log.Fatal(err)
+	}
+	if err = validServer(); err != nil {
+		log.Fatal(err)
+	}
+	if err = setupColor(); err != nil {
+		log.Fatal(err)
+	}
+	if err = setupLang(); err != nil {
+		log.Fatal(err)
+	}
+	if err = validHash(hashFlag); err != nil {
+		log.Fatal(err)
+	}
+	if confirmFlag != "hash" && confirmFlag != "bytes" {
+		log.Fatalf("unknown -confirm %s, use hash or bytes\n", confirmFlag)
+	}
+	if noHashFlag || confirmFlag == "bytes" {
+		if gitFlag || fromFlag != empty {
+			log.Fatal("-no-hash and -confirm bytes compare files while scanning, they can't be combined with -git or -from")
+		}
+		hashFlag = noHash
+	}
+	if err = parsePresets(presetsFlag); err != nil {
+		log.Fatal(err)
+	}
+	if err = validPolicy(keepFlag); err != nil {
+		log.Fatal(err)
+	}
+	if err = parseReferences(); err != nil {
+		log.Fatal(err)
+	}
+	if len(catalogFlag) > 0 && (gitFlag || hashFlag == noHash || strongFlag != empty || matchMtimeFlag || compareXattrFlag != empty || compareACLFlag != empty || len(pluginFlag) > 0) {
+		log.Fatal("offline files of -catalog are only known by their size and hash, they can't be combined with -git, -no-hash, -confirm bytes, -strong-hash, -match-mtime, -compare-xattr, -compare-acl or -plugin")
+	}
+	if execFlag != empty {
+		if _, err = execWords(execFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if reportTiers, err = parseTiers("tiers", tiersFlag); err != nil {
+		log.Fatal(err)
+	}
+	if actTiers, err = parseTiers("act-tiers", actTiersFlag); err != nil {
+		log.Fatal(err)
+	}
+	if ignoreRulesFlag != empty {
+		if err = loadRules(ignoreRulesFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if policyFileFlag != empty {
+		// -move-to and -tag only say where moved duplicates go and how they're tagged
+		if deleteFlag || hardlinkFlag || reflinkFlag || planFlag != empty {
+			log.Fatal("-policy-file decides the action of every group, it can't be combined with -delete, -hardlink, -reflink or -plan")
+		}
+		if err = loadPolicyFile(policyFileFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if minCopiesFlag < 2 {
+		log.Fatal("-min-copies must be at least 2")
+	}
+	if keepNFlag < 1 {
+		log.Fatal("-keep-n must be at least 1")
+	}
+	if err = validVerify(verifyFlag); err != nil {
+		log.Fatal(err)
+	}
+	if trashFlag && (!deleteFlag || trashFunc() == nil) {
+		log.Fatal("-trash needs -delete and a recycle bin, which this system doesn't have")
+	}
+	if strongFlag != empty {
+		if err = validStrong(strongFlag); err != nil {
+			log.Fatal(err)
+		}
+		comparators = append(comparators, strongComparator{})
+	}
+	if matchMtimeFlag {
+		comparators = append(comparators, mtimeComparator{})
+	}
+	if compareXattrFlag == "split" {
+		comparators = append(comparators, xattrComparator{})
+	}
+	if compareACLFlag == "split" {
+		comparators = append(comparators, xattrComparator{acl: true})
+	}
+	for _, p := range pluginFlag {
+		if err = startPlugin(p); err != nil {
+			log.Fatal(err)
+		}
+	}
+	defer closePlugins()
+	stopTelemetry, err := startTelemetry()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer stopTelemetry()
+	stopProgress, err := startProgress()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer stopProgress()
+	if fromFlag != empty {
+		if basedir, dups, err = readResult(fromFlag); err != nil {
+			log.Fatal(err)
+		}
+	} else if flag.NArg() > 0 {
+		basedir = flag.Arg(0)
 	} else {
 		if basedir, err = os.Getwd(); err != nil {
 			log.Fatal(err)
 		}
 	}
-	if dups, err = findDup(basedir); err != nil {
+	if acting() {
+		if err = checkRoot(basedir); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if moveToFlag != empty {
+		if quarantineDir, err = filepath.Abs(moveToFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if fromFlag == empty {
+		if err = setupGit(basedir); err != nil {
+			log.Fatal(err)
+		}
+		if err = setupCheckpoint(basedir); err != nil {
+			log.Fatal(err)
+		}
+		for _, o := range outputFlag {
+			if outputFormat(o) == "jsonl" {
+				if err = startStream(o); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+		if dups, err = findDup(basedir); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if dups, err = suppressIgnored(dups); err != nil {
+		log.Fatal(err)
+	}
+	if dups, err = suppressMirrors(dups); err != nil {
 		log.Fatal(err)
 	}
-	for i, dg := range dups {
-		fmt.Printf("%d: %v", i+1, dg)
+	if len(catalogFlag) > 0 {
+		dups = withLocal(dups)
+	}
+	// split before -reference, so that every owner's group still needs a reference copy
+	if scopeByOwnerFlag {
+		if dups, err = scopeByOwner(dups); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(referenceDirs) > 0 {
+		dups = withReference(dups)
+	}
+	// results written before tiers, or without them like the SQLite database, get theirs by the hashes
+	setTiers(dups)
+	if reportTiers != nil {
+		dups = withTiers(dups)
+	}
+	if minCopiesFlag > 2 {
+		dups = withCopies(dups, minCopiesFlag)
+	}
+	if minWasteFlag > 0 {
+		dups = withWaste(dups, int64(minWasteFlag))
 	}
+	if summaryFlag {
+		printSummary(os.Stdout, basedir, dups)
+	} else {
+		for i, dg := range dups {
+			fmt.Printf("%d: %v", i+1, dg)
+		}
+	}
+	if breakdownFlag && len(dups) > 0 {
+		printBreakdown(dups)
+	}
+	if quotaImpactFlag {
+		if err = printQuotaImpact(basedir, dups); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, o := range outputFlag {
+		if err = writeScoped(o, basedir, dups); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if sarifFlag != empty {
+		if err = writeSARIF(sarifFlag, basedir, dups); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if planFlag != empty {
+		if err = writePlan(planFlag, basedir, dups, planned); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if acting() && len(dups) > 0 {
+		if err = confirmActions(basedir, dups); err != nil {
+			log.Fatal(err)
+		}
+		if moveToFlag != empty {
+			if err = checkQuarantineSpace(dups); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if auditFlag == empty {
+			if auditFlag, err = defaultAuditLog(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if auditFlag != "off" {
+			if err = openAudit(auditFlag); err != nil {
+				log.Fatal(err)
+			}
+			defer auditFile.Close()
+		}
+		// plugin actions and -exec see the duplicates before dup removes them
+		if len(actions) > 0 {
+			if err = applyActions(dups); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if execFlag != empty {
+			if err = execOnDups(execFlag, dups); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if actingBuiltIn() {
+			actOnDups(dups)
+		}
+		if moveToFlag != empty && quarantineKeepFlag > 0 {
+			if auditFile == nil {
+				log.Fatal("-quarantine-keep needs the audit log to know when files were quarantined")
+			}
+			if err = purgeQuarantine(moveToFlag, auditFlag, quarantineKeepFlag, false); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
+
+// write the groups to the -o file path, in the format outputFormat says
+func writeOutputFile(path, dir string, dups []FileGroup) error {
+	switch outputFormat(path) {
+	case "jsonl":
+		return writeJSONL(path, dups)
+	case "parquet":
+		return writeParquet(path, dups)
+	case "sqlite":
+		return writeSQLiteResult(path, dir, dups)
+	case "sarif":
+		return writeSARIF(path, dir, dups)
+	case "html":
+		return writeHTMLReport(path, dir, dups)
+	case "summary":
+		return writeSummary(path, dir, dups)
+	}
+	return writeResult(path, dir, dups)
+}
+
+// flag value collecting every occurrence of a repeated flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
 }
 
 // FileDetail struct to hold file detail info
 type FileDetail struct {
-	path string
-	size int64
-	hash string
+	path  string
+	size  int64
+	mtime time.Time
+	hash  string
+	quick string // hash of samples, only set for large files
+	// physical extents when shared with other files, equal for files already sharing their storage
+	extents string
+	sparse  bool  // fewer bytes allocated than size
+	alloc   int64 // allocated bytes, only set for sparse files
+	// other paths of the file, with -collapse-hardlinks
+	links []string
+	// label of the cataloged drive the file is on, offline files are never read or acted on
+	offline string
+}
+
+// bytes the file takes on disk
+func (f FileDetail) onDisk() int64 {
+	if f.sparse {
+		return f.alloc
+	}
+	return f.size
 }
 
 // FileGroup strct to hold duplicated files together
 type FileGroup struct {
-	size  string
-	hash  string
-	files []FileDetail
+	size   string
+	hash   string
+	files  []FileDetail
+	notes  []string // remarks on the group, e.g. metadata differences
+	strong string   // -strong-hash of the files as algorithm:hex
+	tier   string   // how sure it is the files are the same, exact, probable or similar
+	owner  string   // user owning the files, with -scope-by-owner
 }
 
 // override String() method to print custom format
 func (fg FileGroup) String() string {
 	b := strings.Builder{}
-	b.WriteString("<Size: ")
-	b.WriteString(fg.size)
-	b.WriteString(" Bytes, CRC32: ")
-	b.WriteString(fg.hash)
-	b.WriteString(", Duplication: ")
-	b.WriteString(strconv.Itoa(len(fg.files)))
-	b.WriteString(">\n")
+	b.WriteString(paint(colorCyan, "<Size: "))
+	b.WriteString(paint(colorBold, fg.size))
+	if hashFlag == noHash {
+		b.WriteString(paint(colorCyan, " Bytes, compared byte by byte"))
+	} else {
+		b.WriteString(paint(colorCyan, " Bytes, "+strings.ToUpper(hashFlag)+": "+fg.hash))
+	}
+	if algo, sum, ok := strings.Cut(fg.strong, ":"); ok && algo != hashFlag {
+		b.WriteString(paint(colorCyan, ", "+strings.ToUpper(algo)+": "+sum))
+	}
+	b.WriteString(paint(colorCyan, ", Duplication: "+strconv.Itoa(len(fg.files))))
+	if fg.tier != empty {
+		b.WriteString(paint(colorCyan, ", Tier: "+fg.tier))
+	}
+	if fg.owner != empty {
+		b.WriteString(paint(colorCyan, ", Owner: "+fg.owner))
+	}
+	b.WriteString(paint(colorCyan, ">"))
+	b.WriteString("\n")
+	// with color, kept files are green and the ones the actions remove red
+	kept := make(map[string]bool)
+	if useColor {
+		k, _ := keepFiles(fg, keepFlag)
+		for _, f := range k {
+			kept[f.path] = true
+		}
+	}
 	for _, f := range fg.files {
 		b.WriteString("  ")
-		b.WriteString(f.path)
+		if f.offline != empty {
+			b.WriteString(f.path + " (offline)")
+		} else if kept[f.path] {
+			b.WriteString(paint(colorGreen, f.path))
+		} else {
+			b.WriteString(paint(colorRed, f.path))
+		}
+		if len(f.links) > 0 {
+			fmt.Fprintf(&b, " (+%d hardlinks)", len(f.links))
+		}
+		b.WriteString("\n")
+	}
+	for _, n := range fg.notes {
+		b.WriteString(paint(colorYellow, "  ! "+n))
 		b.WriteString("\n")
 	}
 	b.WriteString("\n")
@@ -86,45 +664,209 @@ func (fg FileGroup) String() string {
 
 // find duplicated files under dir
 func findDup(dir string) ([]FileGroup, error) {
-	log.Printf("Looking for duplicated files under %s\n", dir)
+	log.Printf(tr("Looking for duplicated files under %s\n"), dir)
 	var err error
 	var quickHashMap map[string][]FileDetail
 	var hashMap map[string][]FileDetail
 	var fds = []FileDetail{}
 	var dups = []FileGroup{}
-
-	log.Println("recursiveReadDir")
-	if err = recursiveReadDir(basedir, &fds); err != nil {
+	scanStart = time.Now()
+	if err = loadUnreadable(); err != nil {
 		return nil, err
 	}
-	log.Printf("Found %d files\n", len(fds))
+
+	sp := startSpan("walk")
+	progressStage("walk", 0, 0)
+	if usnFlag {
+		log.Println("enumerateUSN")
+		if err = enumerateUSN(basedir, &fds); err != nil {
+			log.Printf("USN enumeration failed, falling back to directory walk: %v\n", err)
+			fds = fds[:0]
+		}
+	}
+	if !usnFlag || err != nil {
+		log.Println("recursiveReadDir")
+		if err = recursiveReadDir(basedir, &fds); err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range referencesOutside(dir) {
+		if err = recursiveReadDir(r, &fds); err != nil {
+			return nil, err
+		}
+	}
+	if len(catalogFlag) > 0 {
+		offline, err := offlineFiles()
+		if err != nil {
+			return nil, err
+		}
+		fds = append(fds, offline...)
+	}
+	log.Printf(tr("Found %d files\n"), len(fds))
+	sp.finish("files", len(fds))
+
+	if len(contentPlugins) > 0 {
+		log.Println("groupByPlugins")
+		sp = startSpan("plugins")
+		progressStage("plugins", len(fds), 0)
+		if fds, dups, err = groupByPlugins(fds); err != nil {
+			return nil, err
+		}
+		sp.finish("groups", len(dups))
+		log.Printf("%d groups found by plugins\n", len(dups))
+		if err = streamGroups(dups); err != nil {
+			return nil, err
+		}
+	}
+
+	if collapseLinksFlag {
+		fds = collapseLinks(fds)
+	}
+	if gitBlobs != nil {
+		log.Printf("%d hashes taken from the git index\n", applyGit(fds))
+	}
+	if knownHashes != nil {
+		log.Printf("%d hashes reused from checkpoint\n", applyCheckpoint(fds))
+	}
 
 	log.Println("filterBySize")
 	sizeMap := filterBySize(&fds)
-	log.Printf("%d possible duplication groups left\n", len(sizeMap))
+	if matchMtimeFlag {
+		filterByMtime(sizeMap)
+	}
+	log.Printf(tr("%d possible duplication groups left\n"), len(sizeMap))
 
-	log.Println("filterByHash quick")
-	if quickHashMap, err = filterByHash(sizeMap, true); err != nil {
-		return nil, err
+	// largest sizes first, every size is hashed completely before the next one,
+	// so a scan stopped by its budget still reports confirmed groups
+	sizes := make([]int64, 0, len(sizeMap))
+	for k := range sizeMap {
+		size, _ := strconv.ParseInt(k, 10, 64)
+		sizes = append(sizes, size)
 	}
-	log.Printf("%d possible duplication groups left\n", len(quickHashMap))
-	if len(quickHashMap) == 0 {
-		log.Println("No duplication found!")
-		return dups, nil
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] > sizes[j] })
+	log.Println("filterByHash")
+	sp = startSpan("hash")
+	var hashFiles int
+	var hashBytes int64
+	for _, g := range sizeMap {
+		hashFiles += len(g)
+		hashBytes += int64(len(g)) * g[0].size
 	}
-
-	log.Println("filterByHash normal")
-	if hashMap, err = filterByHash(quickHashMap, false); err != nil {
+	progressStage("hash", hashFiles, hashBytes)
+	hashed := hashedBytes
+	var checked int
+	found := len(dups)
+	// with -workers, as many sizes are hashed together to keep the workers busy
+	batch := workersFlag
+	if batch < 1 {
+		batch = 1
+	}
+	for start := 0; start < len(sizes); start += batch {
+		if err = budgetLeft(); err != nil {
+			break
+		}
+		end := start + batch
+		if end > len(sizes) {
+			end = len(sizes)
+		}
+		part := make(map[string][]FileDetail)
+		for _, size := range sizes[start:end] {
+			k := strconv.FormatInt(size, 10)
+			part[k] = sizeMap[k]
+		}
+		if hashFlag == noHash {
+			if !noHashFlag {
+				if part, err = filterBySamples(part); err != nil {
+					break
+				}
+			}
+			if hashMap, err = filterByBytes(part); err != nil {
+				break
+			}
+		} else {
+			if quickHashMap, err = filterByHash(part, true); err != nil {
+				break
+			}
+			if hashMap, err = filterByHash(quickHashMap, false); err != nil {
+				break
+			}
+		}
+		keys := make([]string, 0, len(hashMap))
+		for key := range hashMap {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if hashMap[keys[i]][0].size != hashMap[keys[j]][0].size {
+				return hashMap[keys[i]][0].size > hashMap[keys[j]][0].size
+			}
+			return keys[i] < keys[j]
+		})
+		n := len(dups)
+		for _, key := range keys {
+			s := strings.Split(key, "-")
+			dups = append(dups, FileGroup{size: s[0], hash: s[1], files: hashMap[key]})
+		}
+		if err = streamGroups(dups[n:]); err != nil {
+			break
+		}
+		checked = end
+	}
+	sp.finish("sizes", checked, "groups", len(dups)-found, "bytes", int(hashedBytes-hashed))
+	if readFailures > 0 {
+		log.Printf("%d files left out as they couldn't be read\n", readFailures)
+	}
+	printDiskProblems(log.Writer())
+	if err != nil && !errors.Is(err, errBudget) {
 		return nil, err
 	}
-	log.Printf("%d duplication groups found", len(quickHashMap))
-	if len(hashMap) == 0 {
-		log.Println("No duplication found!")
-		return dups, nil
+	if err != nil {
+		log.Printf("%v, stopping with %d of %d sizes checked\n", err, checked, len(sizes))
+		if checkpointFlag == empty {
+			log.Println("use -resume or -checkpoint to continue from here next time")
+		}
+	}
+	// strong hashes of the comparators below go into the checkpoint too
+	save := func() error {
+		if err := saveUnreadable(basedir); err != nil {
+			return err
+		}
+		if checkpointFlag == empty {
+			return nil
+		}
+		return saveCheckpoint(checkpointFlag, basedir, fds)
+	}
+	log.Printf(tr("%d duplication groups found"), len(dups)-found)
+	if len(dups) == 0 {
+		log.Println(tr("No duplication found!"))
+		return dups, save()
+	}
+	if len(comparators) > 0 {
+		log.Println("refine")
+		sp = startSpan("compare")
+		progressStage("compare", 0, 0)
+		if dups, err = refine(dups, comparators); err != nil {
+			return nil, err
+		}
+		sp.finish("groups", len(dups))
+	}
+	if strongFlag != empty {
+		noteStrong(dups)
+	}
+	setTiers(dups)
+	if err = save(); err != nil {
+		return nil, err
 	}
-	for k, v := range hashMap {
-		s := strings.Split(k, "-")
-		dups = append(dups, FileGroup{size: s[0], hash: s[1], files: v})
+	log.Println("noteExtents")
+	sp = startSpan("extents")
+	noteExtents(dups)
+	sp.finish()
+	if compareXattrFlag == "warn" || compareACLFlag == "warn" {
+		log.Println("noteMetadata")
+		sp = startSpan("metadata")
+		if err = noteMetadata(dups); err != nil {
+			return nil, err
+		}
+		sp.finish()
 	}
 	return dups, nil
 }
@@ -151,22 +893,22 @@ func filterBySize(fds *[]FileDetail) map[string][]FileDetail {
 
 // file size+hash as map key, to remove files with unique hash
 func filterByHash(sizeMap map[string][]FileDetail, quick bool) (map[string][]FileDetail, error) {
-	var hashstr string
-	var key string
-	var err error
-	result := make(map[string][]FileDetail)
+	var files []FileDetail
 	for _, v := range sizeMap {
-		for _, f := range v {
-			if hashstr, err = hash(&f, quick); err != nil {
-				return nil, err
-			}
-			key = fmt.Sprintf("%s-%s", strconv.FormatInt(f.size, 10), hashstr)
-			if g, ok := result[key]; ok {
-				result[key] = append(g, f)
-			} else {
-				result[key] = []FileDetail{f}
-			}
+		files = append(files, v...)
+	}
+	orderReads(files)
+	hashes, err := hashAll(files, quick)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]FileDetail)
+	for i, f := range files {
+		if hashes[i] == empty {
+			continue
 		}
+		key := fmt.Sprintf("%s-%s", strconv.FormatInt(f.size, 10), hashes[i])
+		result[key] = append(result[key], f)
 	}
 	for k, v := range result {
 		if len(v) <= 1 {
@@ -176,72 +918,230 @@ func filterByHash(sizeMap map[string][]FileDetail, quick bool) (map[string][]Fil
 	return result, nil
 }
 
+// hash files with -workers goroutines, the files get their hashes stored as well,
+// files that couldn't be read are noted and get an empty one
+func hashAll(files []FileDetail, quick bool) ([]string, error) {
+	hashes := make([]string, len(files))
+	one := func(i int) error {
+		if err := budgetLeft(); err != nil {
+			return err
+		}
+		err := retried(files[i].path, func() (err error) {
+			hashes[i], err = hash(&files[i], quick)
+			return err
+		})
+		// files that can't be read are left out with an empty hash
+		if err != nil && !noteReadError(files[i].path, err) {
+			return err
+		}
+		if !quick {
+			progressFile()
+		}
+		return nil
+	}
+	if workersFlag <= 1 || len(files) <= 1 {
+		for i := range files {
+			if err := one(i); err != nil {
+				return nil, err
+			}
+		}
+		return hashes, nil
+	}
+	next := make(chan int)
+	errs := make(chan error, workersFlag)
+	var wg sync.WaitGroup
+	for w := 0; w < workersFlag; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if err := one(i); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	var err error
+feed:
+	for i := range files {
+		select {
+		case next <- i:
+		case err = <-errs:
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+	if err == nil && len(errs) > 0 {
+		err = <-errs
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// a file or directory the walk could not read
+type scanError struct {
+	path    string
+	err     string
+	lasting bool // fails the same way next time, see lasting
+}
+
+// errors of the walks so far, skipped files and directories
+var scanErrors []scanError
+
+func noteScanError(path string, err error) {
+	log.Printf("skipping %s: %v\n", path, err)
+	scanErrors = append(scanErrors, scanError{path, err.Error(), lasting(err)})
+}
+
 // recursive read all files under given dir
-func recursiveReadDir(path string, fds *[]FileDetail) error {
-	walkFunc := func(path string, d fs.DirEntry, err error) error {
-		name := d.Name()
-		if d.IsDir() && (name == ".git" || name == "@eaDir") {
+func recursiveReadDir(root string, fds *[]FileDetail) error {
+	var walkFunc fs.WalkDirFunc
+	walkFunc = func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// an unreadable root is fatal, anything below it is skipped and noted
+			if d == nil || path == root {
+				return err
+			}
+			// unless root itself went away: a dir is listed again once it's back
+			switch err = awaitRoot(root, err); {
+			case err == nil:
+				if err = filepath.WalkDir(path, walkFunc); err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			case errors.Is(err, errSourceGone):
+				return err
+			}
+			noteScanError(path, err)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// a dir given to scan is scanned, whatever it looks like
+		if d.IsDir() && path != root && skipDir(path) {
 			return filepath.SkipDir
 		}
-		if !d.IsDir() && name != ".DS_Store" {
-			fi, _ := d.Info()
+		if skipUnreadable(path, d) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && !skipFile(path) {
+			fi, err := d.Info()
+			if err != nil && awaitRoot(root, err) == nil {
+				fi, err = os.Lstat(path)
+			}
+			if err != nil {
+				noteScanError(path, err)
+				return nil
+			}
 			size := fi.Size()
 			// 0 size file is lock file, we don't want to consider it for duplication check
-			if size > 0 {
-				*fds = append(*fds, FileDetail{size: size, path: path})
+			if size > 0 && size >= int64(minSizeFlag) {
+				fd := FileDetail{size: size, path: path, mtime: fi.ModTime()}
+				if alloc, sparse := allocated(path, fi); sparse {
+					fd.sparse, fd.alloc = true, alloc
+				}
+				*fds = append(*fds, fd)
+				progressFile()
 			}
 		}
 		return nil
 	}
-	return filepath.WalkDir(path, walkFunc)
+	return filepath.WalkDir(root, walkFunc)
 }
 
-// create hash(CRC32) string of file
+// create hash string of file with the -hash algorithm, CRC32 by default
 func hash(fd *FileDetail, quick bool) (string, error) {
+	if quick && sampled(fd) {
+		// sample hash is kept apart, so that the normal pass still hashes the whole file
+		if fd.quick == empty {
+			var err error
+			if fd.quick, err = hashWithSampling(fd, fd.size); err != nil {
+				return empty, err
+			}
+			addHashed(3 * samplesize)
+		}
+		return fd.quick, nil
+	}
 	if fd.hash != empty {
 		return fd.hash, nil
 	}
-	fi, err := os.Stat(fd.path)
+	f, err := openContent(fd.path)
 	if err != nil {
 		return empty, err
 	}
-	size := fi.Size()
-	var hashstr string
-	if quick && size > samplethreshold && size > samplesize {
-		if hashstr, err = hashWithSampling(fd, size); err != nil {
-			return empty, err
-		}
-	} else {
-		var b []byte
-		if b, err = os.ReadFile(fd.path); err != nil {
+	defer f.Close()
+	h := newHash()
+	if hashFlag == gitHash {
+		fmt.Fprintf(h, "blob %d\x00", fd.size)
+	}
+	_, err = io.Copy(countingWriter{h}, f)
+	if err != nil {
+		return empty, err
+	}
+	hashstr := fmt.Sprintf("%x", h.Sum(nil))
+	if adsFlag {
+		if hashstr, err = hashStreams(fd.path, hashstr); err != nil {
 			return empty, err
 		}
-		hashstr = fmt.Sprintf("%x", crc32.Checksum(b, table))
 	}
 	fd.hash = hashstr
+	if knownHashes != nil && !ruled(fd.path) {
+		statsMu.Lock()
+		knownHashes[checkpointKey(fd.path)] = checkpointEntry{Size: fd.size, Mtime: fd.mtime, Hash: hashstr}
+		statsMu.Unlock()
+	}
 	return hashstr, nil
 }
 
+// whether the quick pass compares file by samples instead of its whole content, samples
+// of sparse files are likely all zeros and tell nothing, they are hashed fully right away
+func sampled(fd *FileDetail) bool {
+	return fd.size > int64(sampleThresholdFlag) && fd.size > samplesize && !fd.sparse && !ruled(fd.path) && !offlineSizes[fd.size]
+}
+
 // hash large file by sampling for better performance
 func hashWithSampling(fd *FileDetail, size int64) (string, error) {
-	f, err := os.Open(fd.path)
+	f, err := openHinted(fd.path, false)
 	if err != nil {
 		return empty, err
 	}
-	// sample at beginning of the file
-	bb := make([]byte, samplesize)
-	s := io.NewSectionReader(f, 0, samplesize)
-	s.Read(bb)
-
-	// sample at middle of the file
-	bm := make([]byte, samplesize)
-	s.ReadAt(bm, size/2)
-
-	// sample at end of the file
-	be := make([]byte, samplesize)
-	s.ReadAt(be, size-samplesize)
+	defer f.Close()
+	// samples at beginning, middle and end of the file, joined
+	b := make([]byte, 3*samplesize)
+	for i, off := range []int64{0, size / 2, size - samplesize} {
+		if _, err = f.ReadAt(b[int64(i)*samplesize:int64(i+1)*samplesize], off); err != nil {
+			return empty, err
+		}
+	}
+	h := newHash()
+	h.Write(b)
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
 
-	// join 3 samples
-	b := append(append(bb, bm...), be...)
-	return fmt.Sprintf("%x", crc32.Checksum(b, table)), nil
+// fold alternate data streams of file into its hash, streams are visited in name order
+func hashStreams(path string, hashstr string) (string, error) {
+	names, err := altStreams(path)
+	if err != nil || len(names) == 0 {
+		return hashstr, err
+	}
+	sort.Strings(names)
+	h := newHash()
+	h.Write([]byte(hashstr))
+	for _, name := range names {
+		b, err := os.ReadFile(path + name)
+		if err != nil {
+			return empty, err
+		}
+		h.Write([]byte(name))
+		h.Write(b)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// dup merge: move files from SRC into DST unless their content already is in DST
+func mergeCmd(args []string) error {
+	flags := flag.NewFlagSet("merge", flag.ExitOnError)
+	dryRun := flags.Bool("n", false, "only tell what would be done")
+	auditLog := flags.String("audit-log", empty, "append every move to this JSON lines file")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s merge [flags] SRC DST\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Moves files of SRC to the same relative path in DST, skipping files whose content already exists anywhere in DST.")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("SRC and DST must be given")
+	}
+	src, dst := flags.Arg(0), flags.Arg(1)
+	if *auditLog != empty && !*dryRun {
+		if err := openAudit(*auditLog); err != nil {
+			return err
+		}
+		defer auditFile.Close()
+	}
+
+	log.Printf("Indexing %s\n", dst)
+	ix, err := indexTree(dst)
+	if err != nil {
+		return err
+	}
+	fds, err := listFiles(src)
+	if err != nil {
+		return err
+	}
+	var moved, existing, conflicts int
+	for i := range fds {
+		f := &fds[i]
+		rel, err := filepath.Rel(src, f.path)
+		if err != nil {
+			return err
+		}
+		same, err := ix.find(f)
+		if err != nil {
+			return err
+		}
+		if same != nil {
+			fmt.Printf("exists   %s = %s\n", f.path, same.path)
+			existing++
+			continue
+		}
+		target := filepath.Join(dst, rel)
+		if _, err = os.Lstat(target); err == nil {
+			fmt.Printf("conflict %s, %s has different content\n", f.path, target)
+			conflicts++
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		fmt.Printf("move     %s -> %s\n", f.path, target)
+		if !*dryRun {
+			if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err = moveFile(f.path, target, f.size); err != nil {
+				return err
+			}
+			if err = audit("move", f.path, target, *f); err != nil {
+				return err
+			}
+		}
+		moved++
+		// a second copy in SRC is then found as existing
+		added := *f
+		if !*dryRun {
+			added.path = target
+		}
+		ix.add(added)
+	}
+	log.Printf("%d files moved, %d already in %s, %d name conflicts\n", moved, existing, dst, conflicts)
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// dup merge-manifests: duplicate groups across the manifests of several machines
+func mergeManifestsCmd(args []string) error {
+	flags := flag.NewFlagSet("merge-manifests", flag.ExitOnError)
+	all := flags.Bool("all", false, "also list groups of copies within a single manifest")
+	out := flags.String("o", empty, "also write the groups to this file, as JSON like dup -o")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s merge-manifests [flags] MANIFEST...\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Groups the files of manifests written on different machines with dup catalog add -label HOST -o FILE DIR")
+		fmt.Fprintln(flags.Output(), "by size and hash, and lists the groups with copies in more than one manifest, files as HOST:PATH.")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() < 2 {
+		flags.Usage()
+		return errors.New("at least two manifests must be given")
+	}
+	groups := make(map[string][]FileDetail)
+	// labels each group has files of
+	hosts := make(map[string]map[string]bool)
+	for i, m := range flags.Args() {
+		c, err := readCatalog(m)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			hashFlag = c.Algorithm
+		} else if c.Algorithm != hashFlag {
+			return fmt.Errorf("%s was hashed with %s, %s with %s, write the manifests with the same -hash", m, c.Algorithm, flags.Arg(0), hashFlag)
+		}
+		for _, e := range c.Files {
+			key := strconv.FormatInt(e.Size, 10) + "-" + e.Hash
+			groups[key] = append(groups[key], FileDetail{path: c.Label + ":" + path.Join(filepath.ToSlash(c.Root), e.Path), size: e.Size, hash: e.Hash})
+			if hosts[key] == nil {
+				hosts[key] = make(map[string]bool)
+			}
+			hosts[key][c.Label] = true
+		}
+		log.Printf("%d files of %s read from %s\n", len(c.Files), c.Label, m)
+	}
+	var dups []FileGroup
+	var waste int64
+	for key, files := range groups {
+		if len(files) < 2 || len(hosts[key]) < 2 && !*all {
+			continue
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+		dups = append(dups, FileGroup{size: strconv.FormatInt(files[0].size, 10), hash: files[0].hash, files: files})
+		waste += int64(len(files)-1) * files[0].size
+	}
+	sort.Slice(dups, func(i, j int) bool {
+		if dups[i].files[0].size != dups[j].files[0].size {
+			return dups[i].files[0].size > dups[j].files[0].size
+		}
+		return dups[i].hash < dups[j].hash
+	})
+	setTiers(dups)
+	for i, g := range dups {
+		fmt.Printf("%d: %v", i+1, g)
+	}
+	log.Printf("%d groups across the manifests, keeping one copy of each would free %s\n", len(dups), formatSize(waste))
+	if *out != empty {
+		return writeResult(*out, empty, dups)
+	}
+	return nil
+}
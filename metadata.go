@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// file metadata carried over to the kept file by -preserve-metadata
+type metadata struct {
+	path   string
+	mtime  time.Time
+	mode   fs.FileMode
+	uid    int
+	gid    int
+	owned  bool // uid and gid are known
+	xattrs map[string][]byte
+}
+
+// read metadata of file
+func readMetadata(path string) (*metadata, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	md := &metadata{path: path, mtime: fi.ModTime(), mode: fi.Mode().Perm()}
+	md.uid, md.gid, md.owned = owner(fi)
+	if md.xattrs, err = listXattrs(path); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// apply metadata to file at path, as much of it as possible: what fails is
+// reported at the end, after the rest was carried over
+func (md *metadata) apply(path string) error {
+	var problems []string
+	if md.owned {
+		// changing the owner needs privileges, that alone isn't worth a report
+		if err := os.Lchown(path, md.uid, md.gid); err != nil && !os.IsPermission(err) {
+			problems = append(problems, err.Error())
+		}
+	}
+	names := make([]string, 0, len(md.xattrs))
+	for name := range md.xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := setXattr(path, name, md.xattrs[name]); err != nil {
+			problems = append(problems, "xattr "+name+": "+err.Error())
+		}
+	}
+	// xattrs may carry ACLs, the mode goes last so that they can't change it
+	if err := os.Chmod(path, md.mode); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := os.Chtimes(path, md.mtime, md.mtime); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
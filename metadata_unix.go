@@ -0,0 +1,17 @@
+//go:build !windows
+
+package main
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// owner uid and gid of file
+func owner(fi fs.FileInfo) (uid int, gid int, ok bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+)
+
+// pairs of roots mirroring each other on purpose, as A:B (A;B on Windows)
+var allowMirrorFlag stringList
+
+type mirror struct {
+	a, b string
+}
+
+// absolute roots of the -allow-mirror pairs
+func parseMirrors() ([]mirror, error) {
+	var mirrors []mirror
+	for _, v := range allowMirrorFlag {
+		roots := filepath.SplitList(v)
+		if len(roots) != 2 || roots[0] == empty || roots[1] == empty {
+			return nil, fmt.Errorf("invalid -allow-mirror %q, must be two dirs joined by %q", v, filepath.ListSeparator)
+		}
+		a, err := filepath.Abs(roots[0])
+		if err != nil {
+			return nil, err
+		}
+		b, err := filepath.Abs(roots[1])
+		if err != nil {
+			return nil, err
+		}
+		mirrors = append(mirrors, mirror{a, b})
+	}
+	return mirrors, nil
+}
+
+// leave out copies under the mirror side of a pair at the same relative path
+// as a file of the group under the other side, and groups no longer duplicated
+func suppressMirrors(dups []FileGroup) ([]FileGroup, error) {
+	mirrors, err := parseMirrors()
+	if err != nil || len(mirrors) == 0 {
+		return dups, err
+	}
+	var result []FileGroup
+	var suppressed int
+	for _, g := range dups {
+		abs := make(map[string]bool)
+		for _, f := range g.files {
+			p, err := filepath.Abs(f.path)
+			if err != nil {
+				return nil, err
+			}
+			abs[p] = true
+		}
+		var files []FileDetail
+		for _, f := range g.files {
+			p, _ := filepath.Abs(f.path)
+			if !mirrored(p, abs, mirrors) {
+				files = append(files, f)
+			}
+		}
+		if len(files) < 2 {
+			suppressed++
+			continue
+		}
+		g.files = files
+		result = append(result, g)
+	}
+	if suppressed > 0 {
+		log.Printf("%d groups only mirrored as -allow-mirror allows left out\n", suppressed)
+	}
+	return result, nil
+}
+
+// whether path is under the mirror side of a pair and in group at the same place under the other side too
+func mirrored(path string, group map[string]bool, mirrors []mirror) bool {
+	for _, m := range mirrors {
+		rel, err := filepath.Rel(m.b, path)
+		if err != nil || !isUnder(path, m.b) {
+			continue
+		}
+		if group[filepath.Join(m.a, rel)] {
+			return true
+		}
+	}
+	return false
+}
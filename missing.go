@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// dup missing: files of a source tree without a copy in any replica, to check backups cover them
+func missingCmd(args []string) error {
+	var replicas stringList
+	flags := flag.NewFlagSet("missing", flag.ExitOnError)
+	source := flags.String("source", empty, "tree whose files must have a copy")
+	flags.Var(&replicas, "replica", "tree to look for copies in, anywhere and under any name, can be repeated")
+	var indexes stringList
+	flags.Var(&indexes, "index", "catalog of a backup destination to look for copies in instead of reading it, a label of dup catalog or a file of dup catalog add -o, can be repeated")
+	flags.StringVar(&stateDirFlag, "state-dir", empty, "state dir holding the catalogs of -index labels")
+	relative := flags.Bool("relative", false, "list paths relative to the source, a copy list for rsync --files-from or tar -T")
+	flags.StringVar(&hashFlag, "hash", "crc32", "content hash to compare files by, as for dup -hash")
+	flags.Var(&minSizeFlag, "min-size", "ignore source files smaller than this")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s missing -source DIR -replica DIR|-index CATALOG [flags]\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Lists files of the source with no file of the same content in the replicas or indexes, what a")
+		fmt.Fprintln(flags.Output(), "backup still has to copy, and fails when there are any.")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if *source == empty || len(replicas)+len(indexes) == 0 || flags.NArg() > 0 {
+		flags.Usage()
+		return errors.New("-source and -replica or -index must be given")
+	}
+	if err := validHash(hashFlag); err != nil {
+		return err
+	}
+	// hashes of the indexed files by size
+	indexed := make(map[int64]map[string]bool)
+	for i, name := range indexes {
+		c, err := findCatalog(name)
+		if err != nil {
+			return err
+		}
+		if i > 0 && c.Algorithm != hashFlag {
+			return fmt.Errorf("-index %s was hashed with %s, the others with %s", name, c.Algorithm, hashFlag)
+		}
+		// the replicas are hashed like the index
+		hashFlag = c.Algorithm
+		for _, e := range c.Files {
+			if indexed[e.Size] == nil {
+				indexed[e.Size] = make(map[string]bool)
+			}
+			indexed[e.Size][e.Hash] = true
+		}
+		log.Printf("%d files of %s indexed\n", len(c.Files), c.Label)
+	}
+
+	ix := &treeIndex{bySize: make(map[int64][]*FileDetail)}
+	for _, r := range replicas {
+		log.Printf("Indexing %s\n", r)
+		fds, err := listFiles(r)
+		if err != nil {
+			return err
+		}
+		for _, f := range fds {
+			ix.add(f)
+		}
+	}
+	fds, err := listFiles(*source)
+	if err != nil {
+		return err
+	}
+	var checked, missing int
+	var missingBytes int64
+	for i := range fds {
+		f := &fds[i]
+		if f.size < int64(minSizeFlag) {
+			continue
+		}
+		checked++
+		if indexed[f.size] != nil {
+			h, err := hash(f, false)
+			if err != nil {
+				return err
+			}
+			if indexed[f.size][h] {
+				continue
+			}
+		}
+		same, err := ix.find(f)
+		if err != nil {
+			return err
+		}
+		if same == nil {
+			if *relative {
+				rel, err := filepath.Rel(*source, f.path)
+				if err != nil {
+					return err
+				}
+				fmt.Println(rel)
+			} else {
+				fmt.Println(f.path)
+			}
+			missing++
+			missingBytes += f.size
+		}
+	}
+	log.Printf("%d of %d files in %s have no copy in the replicas, %s\n", missing, checked, *source, formatSize(missingBytes))
+	if missing > 0 {
+		return fmt.Errorf("%d files are missing from the replicas", missing)
+	}
+	return nil
+}
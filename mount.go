@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dup mount: read-only view of a tree with every duplicate group present once
+func mountCmd(args []string) error {
+	flags := flag.NewFlagSet("mount", flag.ExitOnError)
+	from := flags.String("from", empty, "take the groups from a result written with -o instead of scanning")
+	flags.StringVar(&keepFlag, "keep", "first", "which file of a group is shown, as for dup -keep")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s mount [flags] MOUNTPOINT [dir]\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Experimental: mounts a read-only FUSE filesystem at MOUNTPOINT showing dir as it would look")
+		fmt.Fprintln(flags.Output(), "with the duplicates removed, until interrupted. Linux only.")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		return errors.New("MOUNTPOINT must be given")
+	}
+	if err := validPolicy(keepFlag); err != nil {
+		return err
+	}
+	mnt := flags.Arg(0)
+	if !isDir(mnt) {
+		return fmt.Errorf("%s is not a directory", mnt)
+	}
+
+	var dups []FileGroup
+	var err error
+	if *from != empty {
+		if basedir, dups, err = readResult(*from); err != nil {
+			return err
+		}
+	} else {
+		basedir = "."
+		if flags.NArg() == 2 {
+			basedir = flags.Arg(1)
+		}
+		if dups, err = findDup(basedir); err != nil {
+			return err
+		}
+	}
+	root, n, err := buildView(basedir, dups)
+	if err != nil {
+		return err
+	}
+	log.Printf("Serving %d files of %s at %s, interrupt to unmount\n", n, basedir, mnt)
+	return serveFUSE(mnt, root)
+}
+
+// file or directory of the deduplicated view
+type viewNode struct {
+	ino      uint64
+	parent   *viewNode
+	path     string // backing file, empty for directories
+	size     int64
+	mtime    time.Time
+	children map[string]*viewNode
+	names    []string // sorted names of children
+}
+
+func (n *viewNode) isDir() bool {
+	return n.children != nil
+}
+
+// tree of the files under dir without the duplicates -keep removes, return the
+// root, numbered from inode 1 on, and the number of files
+func buildView(dir string, dups []FileGroup) (*viewNode, int, error) {
+	removed := make(map[string]bool)
+	for _, g := range dups {
+		_, rm := keepFiles(g, keepFlag)
+		for _, f := range rm {
+			abs, err := filepath.Abs(f.path)
+			if err != nil {
+				return nil, 0, err
+			}
+			removed[abs] = true
+		}
+	}
+	fds, err := listFiles(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+	now := time.Now()
+	root := &viewNode{mtime: now, children: make(map[string]*viewNode)}
+	var files int
+	for _, f := range fds {
+		abs, err := filepath.Abs(f.path)
+		if err != nil {
+			return nil, 0, err
+		}
+		if removed[abs] {
+			continue
+		}
+		rel, err := filepath.Rel(dir, f.path)
+		if err != nil {
+			return nil, 0, err
+		}
+		parts := strings.Split(rel, string(filepath.Separator))
+		n := root
+		for _, p := range parts[:len(parts)-1] {
+			c := n.children[p]
+			if c == nil {
+				c = &viewNode{parent: n, mtime: now, children: make(map[string]*viewNode)}
+				n.children[p] = c
+			}
+			n = c
+		}
+		n.children[parts[len(parts)-1]] = &viewNode{parent: n, path: abs, size: f.size, mtime: f.mtime}
+		files++
+	}
+	var ino uint64
+	var number func(n *viewNode)
+	number = func(n *viewNode) {
+		ino++
+		n.ino = ino
+		for name := range n.children {
+			n.names = append(n.names, name)
+		}
+		sort.Strings(n.names)
+		for _, name := range n.names {
+			number(n.children[name])
+		}
+	}
+	number(root)
+	root.parent = root
+	return root, files, nil
+}
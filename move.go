@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// quarantine location of f under -move-to, mirroring its path relative to the base dir
+func quarantinePath(f FileDetail) (string, error) {
+	abs, err := filepath.Abs(f.path)
+	if err != nil {
+		return empty, err
+	}
+	base, err := filepath.Abs(basedir)
+	if err != nil {
+		return empty, err
+	}
+	rel, err := filepath.Rel(base, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = strings.TrimPrefix(abs, filepath.VolumeName(abs))
+	}
+	dst := filepath.Join(moveToFlag, rel)
+	// never overwrite a file quarantined earlier
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(dst); errors.Is(err, os.ErrNotExist) {
+			return dst, nil
+		}
+		dst = filepath.Join(moveToFlag, rel) + "." + strconv.Itoa(i)
+	}
+}
+
+// move f into the quarantine dir, return where it went
+func quarantine(f FileDetail) (string, error) {
+	dst, err := quarantinePath(f)
+	if err != nil {
+		return empty, err
+	}
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return empty, err
+	}
+	return dst, moveFile(f.path, dst, f.size)
+}
+
+// move file of size bytes from src to dst, copying when they are on different filesystems;
+// a copy replaces an existing dst only once it is complete, so dst is never lost
+func moveFile(src, dst string, size int64) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	// check space right before copying, it may have changed since any precheck
+	if free, err := freeSpace(filepath.Dir(dst)); err == nil && free < uint64(size) {
+		return fmt.Errorf("not enough space left in %s", filepath.Dir(dst))
+	}
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// make sure the quarantine filesystem can take all duplicates that can't simply be renamed there
+func checkQuarantineSpace(dups []FileGroup) error {
+	if err := os.MkdirAll(moveToFlag, 0755); err != nil {
+		return err
+	}
+	var needed uint64
+	for _, g := range dups {
+		r, _, removed := resolve(g)
+		if r.action != "move" {
+			continue
+		}
+		for _, f := range removed {
+			if same, err := sameDevice(moveToFlag, f.path); err != nil || !same {
+				needed += uint64(f.size)
+			}
+		}
+	}
+	if needed == 0 {
+		return nil
+	}
+	free, err := freeSpace(moveToFlag)
+	if errors.Is(err, errNotSupported) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if free < needed {
+		return fmt.Errorf("%s has %d bytes free, quarantining needs %d bytes", moveToFlag, free, needed)
+	}
+	return nil
+}
+
+// copy regular file src to dst, keeping permissions and mtime; the copy is written to
+// a temp file next to dst and renamed over it when synced, nothing is left on failure
+func copyFile(src, dst string) error {
+	s, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	fi, err := s.Stat()
+	if err != nil {
+		return err
+	}
+	d, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.dup-tmp")
+	if err != nil {
+		return err
+	}
+	tmp := d.Name()
+	if _, err = io.Copy(d, s); err == nil {
+		err = d.Sync()
+	}
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, fi.Mode().Perm())
+	}
+	if err == nil {
+		err = os.Chtimes(tmp, fi.ModTime(), fi.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// a dir on another filesystem than t.TempDir, so moves there have to copy
+func otherDeviceDir(t *testing.T) string {
+	base := os.Getenv("DUP_TEST_OTHER_FS")
+	if base == empty {
+		base = "/dev/shm"
+	}
+	dir, err := os.MkdirTemp(base, "dup-test")
+	if err != nil {
+		t.Skipf("no dir on another filesystem: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	if same, err := sameDevice(dir, t.TempDir()); err != nil || same {
+		t.Skipf("%s is on the same filesystem as the temp dir", base)
+	}
+	return dir
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestMoveFileOverwriteCrossDevice(t *testing.T) {
+	src := filepath.Join(otherDeviceDir(t), "quarantined")
+	dst := filepath.Join(t.TempDir(), "original")
+	writeTestFile(t, src, "restored")
+	writeTestFile(t, dst, "taken again")
+	if err := moveFile(src, dst, 8); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, dst); got != "restored" {
+		t.Errorf("dst has %q, want %q", got, "restored")
+	}
+	if _, err := os.Lstat(src); !os.IsNotExist(err) {
+		t.Errorf("src still there after move: %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(dst))
+	if len(entries) != 1 {
+		t.Errorf("%d files next to dst, want only dst", len(entries))
+	}
+}
+
+func TestMoveFileFailureKeepsDst(t *testing.T) {
+	src := filepath.Join(otherDeviceDir(t), "missing")
+	dst := filepath.Join(t.TempDir(), "original")
+	writeTestFile(t, dst, "taken again")
+	if err := moveFile(src, dst, 8); err == nil {
+		t.Fatal("moving a missing file succeeded")
+	}
+	if got := readTestFile(t, dst); got != "taken again" {
+		t.Errorf("dst has %q, want it untouched", got)
+	}
+}
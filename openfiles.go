@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// leave files that SMB clients or local programs have open as they are when acting
+var skipOpenFlag bool
+
+// how long a listing of the open files is trusted before files are listed again
+const openFilesTTL = 10 * time.Second
+
+// open files by real path, with who has them open, as of openFilesAt
+var (
+	openFiles   map[string]string
+	openFilesAt time.Time
+	// smbstatus failed, which is only warned about once
+	smbstatusFailed bool
+)
+
+// who has the file at path open, empty when no one does or without -skip-open
+func heldOpen(path string) string {
+	if !skipOpenFlag {
+		return empty
+	}
+	if openFiles == nil || time.Since(openFilesAt) > openFilesTTL {
+		openFiles = make(map[string]string)
+		smbOpenFiles(openFiles)
+		localOpenFiles(openFiles)
+		openFilesAt = time.Now()
+	}
+	key := checkpointKey(path)
+	if real, err := filepath.EvalSymlinks(key); err == nil {
+		key = real
+	}
+	return openFiles[key]
+}
+
+// add the files SMB clients have open, with an oplock or lease or without, as
+// smbstatus of the local Samba server lists them
+func smbOpenFiles(open map[string]string) {
+	out, err := exec.Command("smbstatus", "-L", "--json").Output()
+	var s struct {
+		OpenFiles map[string]struct {
+			ServicePath string `json:"service_path"`
+			Filename    string `json:"filename"`
+		} `json:"open_files"`
+	}
+	if err == nil {
+		err = json.Unmarshal(out, &s)
+	}
+	if err != nil {
+		if !smbstatusFailed {
+			log.Printf("warning: can't list the files SMB clients have open, only local programs are checked: smbstatus: %v\n", err)
+			smbstatusFailed = true
+		}
+		return
+	}
+	for _, f := range s.OpenFiles {
+		open[filepath.Join(f.ServicePath, f.Filename)] = "an SMB client"
+	}
+}
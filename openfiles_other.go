@@ -0,0 +1,7 @@
+//go:build !linux
+
+package main
+
+// open files of local programs are only listed on Linux, Windows refuses to
+// remove or replace most of them anyway
+func localOpenFiles(open map[string]string) {}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// split groups by the owners of their files, for reports per user
+var scopeByOwnerFlag bool
+
+// placeholder of -o names replaced by the owner, to write one report per user
+const ownerField = "{owner}"
+
+// names of uids looked up so far
+var ownerNames = make(map[int]string)
+
+// user name of the owner of path, its uid when it has no name
+func ownerName(path string) (string, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return empty, err
+	}
+	uid, _, ok := owner(fi)
+	if !ok {
+		return empty, errors.New("-scope-by-owner needs the owners of files, which this platform doesn't give")
+	}
+	return uidName(uid), nil
+}
+
+// the groups split by the owners of their files, as each user can only clean up
+// their own copies; copies of different owners aren't duplicates of either
+func scopeByOwner(dups []FileGroup) ([]FileGroup, error) {
+	var result []FileGroup
+	var shared int
+	for _, g := range dups {
+		byOwner := make(map[string][]FileDetail)
+		for _, f := range localFiles(g.files) {
+			name, err := ownerName(f.path)
+			if err != nil {
+				return nil, err
+			}
+			byOwner[name] = append(byOwner[name], f)
+		}
+		owners := make([]string, 0, len(byOwner))
+		for name := range byOwner {
+			owners = append(owners, name)
+		}
+		sort.Strings(owners)
+		for _, name := range owners {
+			if len(byOwner[name]) < 2 {
+				continue
+			}
+			sg := g
+			sg.files, sg.owner = byOwner[name], name
+			result = append(result, sg)
+		}
+		if len(owners) > 1 {
+			shared++
+		}
+	}
+	log.Printf("%d groups had files of several owners, %d groups of a single owner left\n", shared, len(result))
+	return result, nil
+}
+
+// write the -o file o, one for every owner when its name has the {owner} placeholder
+func writeScoped(o, dir string, dups []FileGroup) error {
+	if !strings.Contains(o, ownerField) {
+		return writeOutputFile(o, dir, dups)
+	}
+	byOwner := make(map[string][]FileGroup)
+	var owners []string
+	for _, g := range dups {
+		if byOwner[g.owner] == nil {
+			owners = append(owners, g.owner)
+		}
+		byOwner[g.owner] = append(byOwner[g.owner], g)
+	}
+	sort.Strings(owners)
+	for _, name := range owners {
+		path := strings.ReplaceAll(o, ownerField, safeName(name))
+		if err := writeOutputFile(path, dir, byOwner[name]); err != nil {
+			return err
+		}
+		log.Printf("%d groups of %s written to %s\n", len(byOwner[name]), name, path)
+	}
+	return nil
+}
+
+// -o names with the {owner} placeholder need -scope-by-owner, and a file per owner
+func validScoped() error {
+	for _, o := range outputFlag {
+		if !strings.Contains(o, ownerField) {
+			continue
+		}
+		if !scopeByOwnerFlag {
+			return fmt.Errorf("-o %s: %s is for -scope-by-owner", o, ownerField)
+		}
+		if f := outputFormat(o); f == "jsonl" || f == "sqlite" {
+			return fmt.Errorf("-o %s: a %s output is written as one file, without %s", o, f, ownerField)
+		}
+	}
+	return nil
+}
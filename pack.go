@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// manifest of a tree packed into a store, the content of every file is the object of its hash
+type packManifest struct {
+	Root      string      `json:"root"`
+	Time      time.Time   `json:"time"`
+	Algorithm string      `json:"algorithm"`
+	Files     []packEntry `json:"files"`
+}
+
+type packEntry struct {
+	Path  string      `json:"path"` // relative to the root, with slashes
+	Size  int64       `json:"size"`
+	Mode  fs.FileMode `json:"mode"`
+	Mtime time.Time   `json:"mtime"`
+	Hash  string      `json:"hash"`
+}
+
+// dup pack: store the files of a tree by content, every content once
+func packCmd(args []string) error {
+	flags := flag.NewFlagSet("pack", flag.ExitOnError)
+	store := flags.String("o", empty, "store dir to pack into, created if missing, other trees packed into it share its objects")
+	name := flags.String("name", empty, "name of the manifest in the store, default the name of DIR")
+	flags.StringVar(&hashFlag, "hash", "sha256", "content hash addressing the objects: sha256 or blake3")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s pack -o STORE [flags] DIR\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Copies the content of the regular files of DIR into STORE/objects, named by its hash, so that")
+		fmt.Fprintln(flags.Output(), "content is stored once however many files have it, and writes STORE/manifests/NAME.json")
+		fmt.Fprintln(flags.Output(), "with their paths, modes and mtimes for dup unpack to restore them from.")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if *store == empty || flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("-o and one dir must be given")
+	}
+	if err := validStrong(hashFlag); err != nil {
+		return fmt.Errorf("-hash: %v", err)
+	}
+	dir := flags.Arg(0)
+	if *name == empty {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		*name = filepath.Base(abs)
+	}
+	fds, err := listFiles(dir)
+	if err != nil {
+		return err
+	}
+	m := packManifest{Root: dir, Time: time.Now(), Algorithm: hashFlag, Files: []packEntry{}}
+	var stored, storedBytes, total int64
+	for _, f := range fds {
+		fi, err := os.Stat(f.path)
+		if err != nil {
+			return err
+		}
+		h, added, err := storeObject(*store, f.path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, f.path)
+		if err != nil {
+			return err
+		}
+		m.Files = append(m.Files, packEntry{Path: filepath.ToSlash(rel), Size: f.size, Mode: fi.Mode().Perm(), Mtime: fi.ModTime(), Hash: h})
+		if added {
+			stored++
+			storedBytes += f.size
+		}
+		total += f.size
+	}
+	b, err := json.MarshalIndent(m, empty, "  ")
+	if err != nil {
+		return err
+	}
+	manifest := filepath.Join(*store, "manifests", safeName(*name)+".json")
+	if err = os.MkdirAll(filepath.Dir(manifest), 0755); err != nil {
+		return err
+	}
+	if err = os.WriteFile(manifest, b, 0644); err != nil {
+		return err
+	}
+	log.Printf("%d files of %s packed into %s, %d new objects, %s of %s stored\n", len(m.Files), formatSize(total), manifest, stored, formatSize(storedBytes), formatSize(total))
+	return nil
+}
+
+// path of the object of hash in store
+func objectPath(store, hash string) string {
+	return filepath.Join(store, "objects", hash[:2], hash[2:])
+}
+
+// copy the content of path into store, hashing it while copying, and return its hash
+// and whether it was new to the store
+func storeObject(store, path string) (string, bool, error) {
+	if err := os.MkdirAll(filepath.Join(store, "objects"), 0755); err != nil {
+		return empty, false, err
+	}
+	s, err := os.Open(path)
+	if err != nil {
+		return empty, false, err
+	}
+	defer s.Close()
+	tmp, err := os.CreateTemp(filepath.Join(store, "objects"), "*.dup-tmp")
+	if err != nil {
+		return empty, false, err
+	}
+	defer os.Remove(tmp.Name())
+	h := newHash()
+	if _, err = io.Copy(tmp, io.TeeReader(s, h)); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return empty, false, err
+	}
+	sum := fmt.Sprintf("%x", h.Sum(nil))
+	obj := objectPath(store, sum)
+	if _, err = os.Stat(obj); err == nil {
+		return sum, false, nil
+	}
+	if err = os.MkdirAll(filepath.Dir(obj), 0755); err != nil {
+		return empty, false, err
+	}
+	if err = os.Chmod(tmp.Name(), 0444); err != nil {
+		return empty, false, err
+	}
+	return sum, true, os.Rename(tmp.Name(), obj)
+}
+
+// dup unpack: restore a tree packed into a store
+func unpackCmd(args []string) error {
+	flags := flag.NewFlagSet("unpack", flag.ExitOnError)
+	dest := flags.String("C", ".", "dir to restore the tree under")
+	store := flags.String("store", empty, "store holding the objects, default the one the manifest is in")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s unpack MANIFEST [-C DIR] [flags]\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Restores the files of a manifest written by dup pack, STORE/manifests/NAME.json, under DIR,")
+		fmt.Fprintln(flags.Output(), "verifying the hash of every file; files already there are left as they are.")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	// flags may follow the manifest too
+	if flags.NArg() > 1 {
+		manifest := flags.Arg(0)
+		parseFlags(flags, flags.Args()[1:])
+		args = append([]string{manifest}, flags.Args()...)
+	} else {
+		args = flags.Args()
+	}
+	if len(args) != 1 {
+		flags.Usage()
+		return errors.New("one manifest must be given")
+	}
+	if *store == empty {
+		*store = filepath.Dir(filepath.Dir(args[0]))
+	}
+	b, err := readInput(args[0])
+	if err != nil {
+		return err
+	}
+	var m packManifest
+	if err = json.Unmarshal(b, &m); err != nil {
+		return fmt.Errorf("manifest %s: %v", args[0], err)
+	}
+	if hashFlag = m.Algorithm; validStrong(hashFlag) != nil {
+		return fmt.Errorf("manifest %s has unknown algorithm %q", args[0], m.Algorithm)
+	}
+	var restored, skipped, failed int
+	for _, e := range m.Files {
+		target := filepath.Join(*dest, filepath.FromSlash(e.Path))
+		if _, err := os.Lstat(target); err == nil {
+			log.Printf("skip %s: exists\n", target)
+			skipped++
+			continue
+		}
+		if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err = restoreObject(objectPath(*store, e.Hash), target, e); err != nil {
+			log.Printf("can't restore %s: %v\n", target, err)
+			failed++
+			continue
+		}
+		restored++
+	}
+	log.Printf("%d files restored to %s, %d skipped as they exist\n", restored, *dest, skipped)
+	if failed > 0 {
+		return fmt.Errorf("%d files couldn't be restored", failed)
+	}
+	return nil
+}
+
+// copy the object obj to target as the file e, checking its hash on the way
+func restoreObject(obj, target string, e packEntry) error {
+	s, err := os.Open(obj)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	tmp := target + ".dup-tmp"
+	d, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, e.Mode)
+	if err != nil {
+		return err
+	}
+	h := newHash()
+	_, err = io.Copy(d, io.TeeReader(s, h))
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && fmt.Sprintf("%x", h.Sum(nil)) != e.Hash {
+		err = fmt.Errorf("object %s is damaged, its content doesn't match its hash", obj)
+	}
+	if err == nil {
+		err = os.Chtimes(tmp, e.Mtime, e.Mtime)
+	}
+	if err == nil {
+		err = os.Rename(tmp, target)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+)
+
+// -o format, json or parquet
+var formatFlag string
+
+// parquet physical types, converted types and the thrift compact types of the
+// file metadata, as far as a file of required, uncompressed PLAIN columns needs them
+const (
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// values of one page at most, so that readers can skip through large columns
+const parquetPageRows = 64 * 1024
+
+// a column of file records, values PLAIN encoded by row
+type parquetColumn struct {
+	name      string
+	typ       int32
+	converted int32 // -1 for none
+	value     func(buf *bytes.Buffer, row int)
+}
+
+// write a record per file of the groups: path, size, hash, group id and mtime,
+// for Spark, DuckDB and the like
+func writeParquet(path string, dups []FileGroup) error {
+	type record struct {
+		f  FileDetail
+		id string
+	}
+	var rows []record
+	for _, g := range dups {
+		for _, f := range g.files {
+			rows = append(rows, record{f, g.id()})
+		}
+	}
+	bytesValue := func(buf *bytes.Buffer, s string) {
+		binary.Write(buf, binary.LittleEndian, uint32(len(s)))
+		buf.WriteString(s)
+	}
+	int64Value := func(buf *bytes.Buffer, v int64) {
+		binary.Write(buf, binary.LittleEndian, v)
+	}
+	columns := []parquetColumn{
+		{"path", parquetByteArray, parquetUTF8, func(buf *bytes.Buffer, i int) { bytesValue(buf, rows[i].f.path) }},
+		{"size", parquetInt64, -1, func(buf *bytes.Buffer, i int) { int64Value(buf, rows[i].f.size) }},
+		{"hash", parquetByteArray, parquetUTF8, func(buf *bytes.Buffer, i int) { bytesValue(buf, rows[i].f.hash) }},
+		{"group_id", parquetByteArray, parquetUTF8, func(buf *bytes.Buffer, i int) { bytesValue(buf, rows[i].id) }},
+		{"mtime", parquetInt64, parquetTimestampMicros, func(buf *bytes.Buffer, i int) {
+			int64Value(buf, rows[i].f.mtime.UnixNano()/1000)
+		}},
+	}
+
+	var out bytes.Buffer
+	out.WriteString("PAR1")
+	// column chunk metadata, written into the footer
+	var chunks [][]byte
+	var total int64
+	for _, c := range columns {
+		start := int64(out.Len())
+		for first := 0; first < len(rows) || first == 0; first += parquetPageRows {
+			last := first + parquetPageRows
+			if last > len(rows) {
+				last = len(rows)
+			}
+			var data bytes.Buffer
+			for i := first; i < last; i++ {
+				c.value(&data, i)
+			}
+			var h thriftWriter
+			h.i32(1, 0) // DATA_PAGE
+			h.i32(2, int32(data.Len()))
+			h.i32(3, int32(data.Len()))
+			h.structBegin(5)
+			h.i32(1, int32(last-first))
+			h.i32(2, 0) // PLAIN
+			h.i32(3, 3) // RLE, no levels with required columns
+			h.i32(4, 3)
+			h.structEnd()
+			h.stop()
+			out.Write(h.buf.Bytes())
+			out.Write(data.Bytes())
+			if len(rows) == 0 {
+				break
+			}
+		}
+		size := int64(out.Len()) - start
+		total += size
+		var m thriftWriter
+		m.i64(2, start)
+		m.structBegin(3)
+		m.i32(1, c.typ)
+		m.listBegin(2, thriftI32, 1)
+		m.rawI32(0)
+		m.listBegin(3, thriftBinary, 1)
+		m.rawBinary(c.name)
+		m.i32(4, 0) // UNCOMPRESSED
+		m.i64(5, int64(len(rows)))
+		m.i64(6, size)
+		m.i64(7, size)
+		m.i64(9, start)
+		m.structEnd()
+		chunks = append(chunks, m.buf.Bytes())
+	}
+
+	var meta thriftWriter
+	meta.i32(1, 1)
+	meta.listBegin(2, thriftStruct, len(columns)+1)
+	meta.elemBegin()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(columns)))
+	meta.elemEnd()
+	for _, c := range columns {
+		meta.elemBegin()
+		meta.i32(1, c.typ)
+		meta.i32(3, 0) // REQUIRED
+		meta.binary(4, c.name)
+		if c.converted >= 0 {
+			meta.i32(6, c.converted)
+		}
+		meta.elemEnd()
+	}
+	meta.i64(3, int64(len(rows)))
+	meta.listBegin(4, thriftStruct, 1)
+	meta.elemBegin()
+	meta.listBegin(1, thriftStruct, len(chunks))
+	for _, c := range chunks {
+		meta.elemBegin()
+		meta.buf.Write(c)
+		meta.elemEnd()
+	}
+	meta.i64(2, total)
+	meta.i64(3, int64(len(rows)))
+	meta.elemEnd()
+	meta.binary(6, "dup")
+	meta.stop()
+
+	out.Write(meta.buf.Bytes())
+	binary.Write(&out, binary.LittleEndian, uint32(meta.buf.Len()))
+	out.WriteString("PAR1")
+	return os.WriteFile(path, out.Bytes(), 0644)
+}
+
+// writer of the thrift compact protocol parquet metadata is encoded in
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16 // last field id of each open struct
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+	if len(w.last) == 0 {
+		w.last = []int16{0}
+	}
+	top := &w.last[len(w.last)-1]
+	if d := id - *top; d > 0 && d <= 15 {
+		w.buf.WriteByte(byte(d)<<4 | typ)
+	} else {
+		w.buf.WriteByte(typ)
+		w.varint(uint64(int64(id)<<1 ^ int64(id)>>15))
+	}
+	*top = id
+}
+
+func (w *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (w *thriftWriter) zigzag(v int64) {
+	w.varint(uint64(v<<1 ^ v>>63))
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.zigzag(int64(v))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.zigzag(v)
+}
+
+func (w *thriftWriter) binary(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.rawBinary(s)
+}
+
+func (w *thriftWriter) rawI32(v int32) {
+	w.zigzag(int64(v))
+}
+
+func (w *thriftWriter) rawBinary(s string) {
+	w.varint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+func (w *thriftWriter) listBegin(id int16, elem byte, n int) {
+	w.field(id, thriftList)
+	if n < 15 {
+		w.buf.WriteByte(byte(n)<<4 | elem)
+	} else {
+		w.buf.WriteByte(0xf0 | elem)
+		w.varint(uint64(n))
+	}
+}
+
+// struct as field id
+func (w *thriftWriter) structBegin(id int16) {
+	w.field(id, thriftStruct)
+	w.elemBegin()
+}
+
+func (w *thriftWriter) structEnd() {
+	w.elemEnd()
+}
+
+// struct as list element
+func (w *thriftWriter) elemBegin() {
+	if len(w.last) == 0 {
+		w.last = []int16{0}
+	}
+	w.last = append(w.last, 0)
+}
+
+func (w *thriftWriter) elemEnd() {
+	w.stop()
+	w.last = w.last[:len(w.last)-1]
+}
+
+// end of the outermost struct
+func (w *thriftWriter) stop() {
+	w.buf.WriteByte(0)
+}
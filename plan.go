@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// dup plan: compare what keep policies would reclaim on a saved scan result
+func planCmd(args []string) error {
+	var policies stringList
+	flags := flag.NewFlagSet("plan", flag.ExitOnError)
+	flags.Var(&policies, "policy", "keep policy to simulate, can be repeated (default first, oldest, newest, shortest-path)")
+	flags.IntVar(&keepNFlag, "keep-n", 1, "files of each group every policy keeps, as for dup -keep-n")
+	showDiff := flags.Bool("show-diff", false, "show a tree of the directories a run would change instead, with files removed, links created and bytes freed, by the -policy-file or as deleted by the one -policy")
+	flags.StringVar(&policyFileFlag, "policy-file", empty, "rules resolving each group, as for dup -policy-file, for -show-diff")
+	flags.StringVar(&moveToFlag, "move-to", empty, "quarantine dir of the -policy-file rules moving duplicates")
+	flags.StringVar(&tagFlag, "finder-tag", empty, "tag of the -policy-file rules tagging duplicates")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s plan [flags] result.json\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("no scan result given")
+	}
+	if *showDiff && policyFileFlag == empty && len(policies) > 1 {
+		return errors.New("-show-diff takes one -policy or a -policy-file")
+	}
+	if len(policies) == 0 {
+		policies = stringList{"first", "oldest", "newest", "shortest-path"}
+	}
+	for _, p := range policies {
+		if err := validPolicy(p); err != nil {
+			return err
+		}
+	}
+	if (policyFileFlag != empty || moveToFlag != empty || tagFlag != empty) && !*showDiff {
+		return errors.New("-policy-file, -move-to and -finder-tag are for -show-diff")
+	}
+	base, dups, err := readResult(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *showDiff {
+		basedir = base
+		keepFlag = policies[0]
+		if policyFileFlag == empty {
+			deleteFlag = true
+		} else if err = loadPolicyFile(policyFileFlag); err != nil {
+			return err
+		}
+		printPlanDiff(base, dups)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "policy\tgroups\tfiles kept\tfiles removed\tbytes reclaimable\t")
+	for _, p := range policies {
+		var kept, removed int
+		var bytes int64
+		for _, g := range dups {
+			k, r := keepFiles(g, p)
+			kept += len(k)
+			removed += len(r)
+			_, b := reclaimable(k, r)
+			bytes += b
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t\n", p, len(dups), kept, removed, bytes)
+	}
+	return w.Flush()
+}
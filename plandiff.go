@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// directory in the diff of a plan, counting what happens in it and below
+type diffDir struct {
+	name    string
+	dirs    map[string]*diffDir
+	lines   []diffLine
+	removed int // deleted or moved away
+	linked  int
+	freed   int64
+}
+
+// file a resolution acts on
+type diffLine struct {
+	name   string
+	mark   string
+	target string
+}
+
+// marks of the actions, removed files red, links green
+var diffMarks = map[string]struct{ mark, color string }{
+	"delete":   {"-", colorRed},
+	"move":     {">", colorRed},
+	"hardlink": {"=", colorGreen},
+	"reflink":  {"=", colorGreen},
+	"tag":      {"#", colorYellow},
+}
+
+// print a tree of the directories under dir the resolution of dups changes, with the
+// files removed, links created and bytes freed in each, so that a run can be reviewed first
+func printPlanDiff(dir string, dups []FileGroup) {
+	root := &diffDir{name: dir, dirs: make(map[string]*diffDir)}
+	for _, g := range dups {
+		r, kept, removed := resolve(g)
+		m, ok := diffMarks[r.action]
+		if !ok {
+			continue
+		}
+		freed := make(map[string]bool)
+		if r.action != "tag" {
+			for _, f := range freedFiles(kept, removed) {
+				freed[f.path] = true
+			}
+		}
+		for _, f := range removed {
+			rel, err := filepath.Rel(dir, f.path)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				rel = f.path
+			}
+			parts := strings.Split(filepath.ToSlash(rel), "/")
+			path := []*diffDir{root}
+			for _, p := range parts[:len(parts)-1] {
+				n := path[len(path)-1]
+				c := n.dirs[p]
+				if c == nil {
+					c = &diffDir{name: p, dirs: make(map[string]*diffDir)}
+					n.dirs[p] = c
+				}
+				path = append(path, c)
+			}
+			l := diffLine{name: parts[len(parts)-1], mark: paint(m.color, m.mark)}
+			switch r.action {
+			case "move":
+				l.target, _ = quarantinePath(f)
+			case "hardlink", "reflink":
+				l.target = kept[0].path
+			}
+			d := path[len(path)-1]
+			d.lines = append(d.lines, l)
+			for _, n := range path {
+				switch r.action {
+				case "delete", "move":
+					n.removed++
+				case "hardlink", "reflink":
+					n.linked++
+				}
+				if freed[f.path] {
+					n.freed += f.onDisk()
+				}
+			}
+		}
+	}
+	root.print(empty)
+	fmt.Printf("%d files removed, %d links created, %s bytes freed\n", root.removed, root.linked, paint(colorBold, fmt.Sprint(root.freed)))
+}
+
+func (d *diffDir) print(indent string) {
+	fmt.Printf("%s%s/  %s\n", indent, paint(colorCyan, strings.TrimSuffix(d.name, "/")), paint(colorBold, d.counts()))
+	names := make([]string, 0, len(d.dirs))
+	for name := range d.dirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		d.dirs[name].print(indent + "  ")
+	}
+	sort.Slice(d.lines, func(i, j int) bool { return d.lines[i].name < d.lines[j].name })
+	for _, l := range d.lines {
+		if l.target != empty {
+			fmt.Printf("%s  %s %s -> %s\n", indent, l.mark, l.name, l.target)
+		} else {
+			fmt.Printf("%s  %s %s\n", indent, l.mark, l.name)
+		}
+	}
+}
+
+// what changes in and below d, like -3 files, +2 links, 4096 bytes freed
+func (d *diffDir) counts() string {
+	var parts []string
+	if d.removed > 0 {
+		parts = append(parts, fmt.Sprintf("-%d files", d.removed))
+	}
+	if d.linked > 0 {
+		parts = append(parts, fmt.Sprintf("+%d links", d.linked))
+	}
+	return strings.Join(append(parts, fmt.Sprintf("%d bytes freed", d.freed)), ", ")
+}
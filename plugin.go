@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Comparator refines duplicate groups: files of a group only stay together when
+// they get the same key
+type Comparator interface {
+	Name() string
+	Key(f FileDetail) (string, error)
+}
+
+// Action resolves a confirmed duplicate group, in favor of kept, which is the
+// first file -keep keeps
+type Action interface {
+	Name() string
+	Apply(g FileGroup, kept FileDetail, removed []FileDetail) error
+}
+
+// comparators refining confirmed groups, from flags and plugins
+var comparators []Comparator
+
+// actions run for every confirmed group, from plugins
+var actions []Action
+
+// plugins grouping files with their extensions by own content key instead of by bytes
+var contentPlugins []*plugin
+
+// request sent to a plugin, one JSON object per line on its stdin
+type pluginRequest struct {
+	Method string       `json:"method"` // describe, key or apply
+	File   *pluginFile  `json:"file,omitempty"`
+	Group  *pluginGroup `json:"group,omitempty"`
+}
+
+type pluginFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	Hash string `json:"hash,omitempty"`
+}
+
+type pluginGroup struct {
+	Size string   `json:"size"`
+	Hash string   `json:"hash"`
+	Kept string   `json:"kept"`
+	Dups []string `json:"dups"`
+}
+
+// response of a plugin, one JSON object per line on its stdout
+type pluginResponse struct {
+	// describe: what the plugin provides, compare is "refine" or "content",
+	// content comparators handle files with the given extensions
+	Name       string   `json:"name,omitempty"`
+	Compare    string   `json:"compare,omitempty"`
+	Extensions []string `json:"extensions,omitempty"`
+	Action     bool     `json:"action,omitempty"`
+	// key: comparison key of the file
+	Key   string `json:"key,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// a plugin subprocess, speaking JSON lines on stdin/stdout
+type plugin struct {
+	name       string
+	extensions map[string]bool
+	cmd        *exec.Cmd
+	in         io.WriteCloser
+	out        *bufio.Scanner
+	mu         sync.Mutex
+}
+
+// start plugin command and register what it provides
+func startPlugin(command string) error {
+	args, err := splitCommand(command)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New("empty -plugin command")
+	}
+	p := &plugin{name: filepath.Base(args[0]), cmd: exec.Command(args[0], args[1:]...)}
+	p.cmd.Stderr = os.Stderr
+	if p.in, err = p.cmd.StdinPipe(); err != nil {
+		return err
+	}
+	out, err := p.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	p.out = bufio.NewScanner(out)
+	p.out.Buffer(make([]byte, 64*KB), int(1*MB))
+	if err = p.cmd.Start(); err != nil {
+		return err
+	}
+	var desc pluginResponse
+	if err = p.call(pluginRequest{Method: "describe"}, &desc); err != nil {
+		p.close()
+		return err
+	}
+	if desc.Name != empty {
+		p.name = desc.Name
+	}
+	switch desc.Compare {
+	case empty:
+	case "refine":
+		comparators = append(comparators, p)
+	case "content":
+		p.extensions = make(map[string]bool)
+		for _, ext := range desc.Extensions {
+			p.extensions[strings.ToLower(ext)] = true
+		}
+		contentPlugins = append(contentPlugins, p)
+	default:
+		p.close()
+		return fmt.Errorf("plugin %s: unknown compare kind %q", p.name, desc.Compare)
+	}
+	if desc.Action {
+		actions = append(actions, p)
+	}
+	plugins = append(plugins, p)
+	return nil
+}
+
+// all started plugins
+var plugins []*plugin
+
+// stop all plugins
+func closePlugins() {
+	for _, p := range plugins {
+		p.close()
+	}
+}
+
+func (p *plugin) close() error {
+	p.in.Close()
+	return p.cmd.Wait()
+}
+
+// send one request and wait for its response
+func (p *plugin) call(req pluginRequest, resp *pluginResponse) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	if _, err = p.in.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("plugin %s: %v", p.name, err)
+	}
+	if !p.out.Scan() {
+		if err = p.out.Err(); err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("plugin %s: %v", p.name, err)
+	}
+	if err = json.Unmarshal(p.out.Bytes(), resp); err != nil {
+		return fmt.Errorf("plugin %s: %v", p.name, err)
+	}
+	if resp.Error != empty {
+		return fmt.Errorf("plugin %s: %s", p.name, resp.Error)
+	}
+	return nil
+}
+
+func (p *plugin) Name() string {
+	return p.name
+}
+
+func (p *plugin) Key(f FileDetail) (string, error) {
+	var resp pluginResponse
+	err := p.call(pluginRequest{Method: "key", File: &pluginFile{Path: f.path, Size: f.size, Hash: f.hash}}, &resp)
+	return resp.Key, err
+}
+
+func (p *plugin) Apply(g FileGroup, kept FileDetail, removed []FileDetail) error {
+	pg := &pluginGroup{Size: g.size, Hash: g.hash, Kept: kept.path}
+	for _, f := range removed {
+		pg.Dups = append(pg.Dups, f.path)
+	}
+	return p.call(pluginRequest{Method: "apply", Group: pg}, &pluginResponse{})
+}
+
+// take the files handled by content plugins out of fds and group them by plugin key
+func groupByPlugins(fds []FileDetail) ([]FileDetail, []FileGroup, error) {
+	var rest []FileDetail
+	var keys []string
+	groups := make(map[string][]FileDetail)
+	for _, f := range fds {
+		var p *plugin
+		for _, cp := range contentPlugins {
+			if cp.extensions[strings.ToLower(filepath.Ext(f.path))] {
+				p = cp
+				break
+			}
+		}
+		if p == nil {
+			rest = append(rest, f)
+			continue
+		}
+		k, err := p.Key(f)
+		if err != nil {
+			return nil, nil, err
+		}
+		key := p.name + ":" + k
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], f)
+	}
+	var dups []FileGroup
+	for _, key := range keys {
+		if files := groups[key]; len(files) > 1 {
+			dups = append(dups, FileGroup{size: strconv.FormatInt(files[0].size, 10), hash: key, files: files, tier: tierSimilar})
+		}
+	}
+	return rest, dups, nil
+}
+
+// run plugin actions on every group that isn't only reported
+func applyActions(dups []FileGroup) error {
+	for _, g := range dups {
+		kept, removed, ok := resolveExtra(g)
+		if !ok {
+			continue
+		}
+		for _, a := range actions {
+			if err := a.Apply(g, kept[0], removed); err != nil {
+				return fmt.Errorf("%s action on group %s-%s: %v", a.Name(), g.size, g.hash, err)
+			}
+			for _, f := range removed {
+				if err := audit("plugin", f.path, kept[0].path, f); err != nil {
+					return fmt.Errorf("can't write audit log: %v", err)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// keep policies with one kept file, ordering files of a group by preference
+var keepOrders = map[string]func(a, b FileDetail) bool{
+	"first": func(a, b FileDetail) bool {
+		return a.path < b.path
+	},
+	"oldest": func(a, b FileDetail) bool {
+		if !a.mtime.Equal(b.mtime) {
+			return a.mtime.Before(b.mtime)
+		}
+		return a.path < b.path
+	},
+	"newest": func(a, b FileDetail) bool {
+		if !a.mtime.Equal(b.mtime) {
+			return a.mtime.After(b.mtime)
+		}
+		return a.path < b.path
+	},
+	"shortest-path": func(a, b FileDetail) bool {
+		if len(a.path) != len(b.path) {
+			return len(a.path) < len(b.path)
+		}
+		return a.path < b.path
+	},
+}
+
+// prefix of the policy keeping every file under a directory
+const underPolicy = "under:"
+
+// check policy is known
+func validPolicy(policy string) error {
+	if _, ok := keepOrders[policy]; ok {
+		return nil
+	}
+	if strings.HasPrefix(policy, underPolicy) && len(policy) > len(underPolicy) {
+		return nil
+	}
+	return fmt.Errorf("unknown keep policy %q, must be first, oldest, newest, shortest-path or under:DIR", policy)
+}
+
+// split files of group into kept and removed ones according to policy, under:DIR
+// keeps every file under DIR and tops up from the others by path, the other
+// policies keep the first -keep-n files in their order; with -reference roots
+// their files are kept and all others removed, whatever the policy
+func keepFiles(g FileGroup, policy string) (kept []FileDetail, removed []FileDetail) {
+	// offline copies are only reported
+	g.files = localFiles(g.files)
+	if len(referenceDirs) > 0 {
+		for _, f := range g.files {
+			if isReference(f.path) {
+				kept = append(kept, f)
+			} else {
+				removed = append(removed, f)
+			}
+		}
+		return kept, removed
+	}
+	n := keepNFlag
+	if n < 1 {
+		n = 1
+	}
+	files := append([]FileDetail{}, g.files...)
+	if strings.HasPrefix(policy, underPolicy) {
+		dir := filepath.Clean(strings.TrimPrefix(policy, underPolicy))
+		sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+		for _, f := range files {
+			if underDir(f.path, dir) {
+				kept = append(kept, f)
+			} else {
+				removed = append(removed, f)
+			}
+		}
+		for len(kept) < n && len(removed) > 0 {
+			kept = append(kept, removed[0])
+			removed = removed[1:]
+		}
+		return kept, removed
+	}
+	sort.Slice(files, func(i, j int) bool { return keepOrders[policy](files[i], files[j]) })
+	if n > len(files) {
+		n = len(files)
+	}
+	return files[:n], files[n:]
+}
+
+// whether path is dir or inside it
+func isUnder(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(os.PathSeparator))+string(os.PathSeparator))
+}
+
+// isUnder for paths as given, both made absolute and clean first, so that the
+// paths of a relative scan root match absolute dirs and the other way round
+func underDir(path, dir string) bool {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return isUnder(filepath.Clean(path), filepath.Clean(dir))
+}
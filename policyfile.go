@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// YAML file of rules resolving groups by where their files are, see loadPolicyFile
+var policyFileFlag string
+
+// what is done to the duplicates of a group, by the action flags or a -policy-file rule
+type resolution struct {
+	under  string // only duplicates under this dir are acted on, all when empty
+	action string // delete, move, tag, hardlink, reflink or report
+	keep   string // keep policy choosing the kept files
+}
+
+// actions a rule can resolve to
+var policyActions = []string{"delete", "move", "tag", "hardlink", "reflink", "report"}
+
+var policyRules []resolution
+
+// read rules from a YAML list of the form
+//
+//	# delete downloads already in the library
+//	- under: /downloads
+//	  action: delete
+//	  keep: under:/library
+//	- under: /photos
+//	  action: hardlink
+//	- action: report
+//
+// the first rule with a duplicate under its dir, and a file under the dir of
+// an under:DIR keep policy, resolves a group, groups no rule matches are only
+// reported; keep defaults to -keep, move and tag need -move-to and -finder-tag
+func loadPolicyFile(file string) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == empty || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		if item := strings.TrimPrefix(trimmed, "-"); item != trimmed && strings.HasPrefix(line, "-") {
+			policyRules = append(policyRules, resolution{keep: keepFlag})
+			if trimmed = strings.TrimSpace(item); trimmed == empty {
+				continue
+			}
+		} else if len(policyRules) == 0 || !strings.HasPrefix(line, " ") {
+			return fmt.Errorf("%s:%d: want a list of rules, each starting with -", file, n)
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return fmt.Errorf("%s:%d: want KEY: VALUE", file, n)
+		}
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else if len(value) > 1 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+		}
+		r := &policyRules[len(policyRules)-1]
+		switch strings.TrimSpace(key) {
+		case "under":
+			r.under = filepath.Clean(value)
+		case "action":
+			r.action = value
+		case "keep":
+			if err = validPolicy(value); err != nil {
+				return fmt.Errorf("%s:%d: %v", file, n, err)
+			}
+			r.keep = value
+		default:
+			return fmt.Errorf("%s:%d: unknown key %q, must be under, action or keep", file, n, key)
+		}
+	}
+	for i, r := range policyRules {
+		switch r.action {
+		case "delete", "hardlink", "reflink", "report":
+		case "move":
+			if moveToFlag == empty {
+				return fmt.Errorf("%s: rule %d moves duplicates but no -move-to is given", file, i+1)
+			}
+		case "tag":
+			if tagFlag == empty {
+				return fmt.Errorf("%s: rule %d tags duplicates but no -finder-tag is given", file, i+1)
+			}
+		default:
+			return fmt.Errorf("%s: rule %d has action %q, must be one of %s", file, i+1, r.action, strings.Join(policyActions, ", "))
+		}
+	}
+	return nil
+}
+
+// resolution given by the action flags and -keep
+func flagResolution() resolution {
+	r := resolution{action: "report", keep: keepFlag}
+	switch {
+	case deleteFlag:
+		r.action = "delete"
+	case moveToFlag != empty:
+		r.action = "move"
+	case tagFlag != empty:
+		r.action = "tag"
+	case reflinkFlag:
+		r.action = "reflink"
+	case hardlinkFlag:
+		r.action = "hardlink"
+	}
+	return r
+}
+
+// resolution of group, its kept files and the duplicates it acts on
+func resolve(g FileGroup) (r resolution, kept []FileDetail, removed []FileDetail) {
+	if actTiers != nil && !actTiers[g.tier] {
+		kept, removed = keepFiles(g, keepFlag)
+		return resolution{action: "report", keep: keepFlag}, kept, removed
+	}
+	if len(policyRules) == 0 {
+		r = flagResolution()
+		kept, removed = keepFiles(g, r.keep)
+		return r, kept, removed
+	}
+	for _, r = range policyRules {
+		if dir := strings.TrimPrefix(r.keep, underPolicy); dir != r.keep && !anyUnder(g.files, filepath.Clean(dir)) {
+			continue
+		}
+		kept, removed = keepFiles(g, r.keep)
+		if r.under == empty {
+			return r, kept, removed
+		}
+		var in []FileDetail
+		for _, f := range removed {
+			if underDir(f.path, r.under) {
+				in = append(in, f)
+			}
+		}
+		if len(in) > 0 {
+			return r, kept, in
+		}
+	}
+	kept, removed = keepFiles(g, keepFlag)
+	return resolution{action: "report", keep: keepFlag}, kept, removed
+}
+
+// kept files and duplicates of g for -exec and plugin actions, which come on top of any
+// action flag; ok is false when -act-tiers or the policy file leave g to be reported only
+func resolveExtra(g FileGroup) (kept []FileDetail, removed []FileDetail, ok bool) {
+	r, kept, removed := resolve(g)
+	ok = r.action != "report" || len(policyRules) == 0 && (actTiers == nil || actTiers[g.tier])
+	return kept, removed, ok && len(kept) > 0
+}
+
+// whether one of files is under dir
+func anyUnder(files []FileDetail, dir string) bool {
+	for _, f := range files {
+		if underDir(f.path, dir) {
+			return true
+		}
+	}
+	return false
+}
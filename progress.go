@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// emit progress events in this format, only json so far
+var progressFormatFlag string
+
+// send progress events here instead of stderr: unix:/path/to/socket or tcp:host:port
+var progressToFlag string
+
+// time between two progress events
+var progressIntervalFlag time.Duration
+
+// one progress event, a JSON object per line
+type progressEvent struct {
+	Stage      string  `json:"stage"`
+	Files      int     `json:"files"`
+	FilesTotal int     `json:"files_total,omitempty"` // at most, for hash files ruled out by their samples are skipped
+	Bytes      int64   `json:"bytes"`
+	BytesTotal int64   `json:"bytes_total,omitempty"`
+	Rate       float64 `json:"rate"`          // bytes per second in this stage
+	ETA        float64 `json:"eta,omitempty"` // seconds until the stage is done, when its total is known
+	Elapsed    float64 `json:"elapsed"`       // seconds since the scan started
+}
+
+var progress struct {
+	out        io.Writer
+	enc        *json.Encoder
+	last       time.Time
+	stage      string
+	stageStart time.Time
+	stageBytes int64 // hashedBytes when the stage started
+	files      int
+	filesTotal int
+	bytesTotal int64
+}
+
+// open the -progress-to destination, return a function sending the last event and closing it
+func startProgress() (func(), error) {
+	if progressFormatFlag == empty {
+		return func() {}, nil
+	}
+	if progressFormatFlag != "json" {
+		return nil, fmt.Errorf("unknown -progress-format %s, only json is supported", progressFormatFlag)
+	}
+	progress.out = os.Stderr
+	if progressToFlag != empty {
+		network, addr, ok := strings.Cut(progressToFlag, ":")
+		if !ok || (network != "unix" && network != "tcp") {
+			return nil, fmt.Errorf("-progress-to must be unix:PATH or tcp:HOST:PORT, not %s", progressToFlag)
+		}
+		conn, err := net.Dial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		progress.out = conn
+	}
+	progress.enc = json.NewEncoder(progress.out)
+	return func() {
+		progressStage("done", 0, 0)
+		if c, ok := progress.out.(net.Conn); ok {
+			c.Close()
+		}
+	}, nil
+}
+
+// a new stage begins, with files and bytes expected in it when known,
+// events for the end of the last stage and for the new one are sent right away
+func progressStage(stage string, files int, bytes int64) {
+	if progress.enc == nil {
+		return
+	}
+	if progress.stage != empty {
+		progressEmit()
+	}
+	progress.stage, progress.stageStart, progress.stageBytes = stage, time.Now(), hashedBytes
+	progress.files, progress.filesTotal, progress.bytesTotal = 0, files, bytes
+	progressEmit()
+}
+
+// count a file done in the current stage, and send an event when due
+func progressFile() {
+	statsMu.Lock()
+	progress.files++
+	progressTick()
+	statsMu.Unlock()
+}
+
+// send an event when -progress-interval has passed since the last one, statsMu is held
+func progressTick() {
+	if progress.enc != nil && time.Since(progress.last) >= progressIntervalFlag {
+		progressEmit()
+	}
+}
+
+func progressEmit() {
+	progress.last = time.Now()
+	e := progressEvent{
+		Stage:      progress.stage,
+		Files:      progress.files,
+		FilesTotal: progress.filesTotal,
+		Bytes:      hashedBytes - progress.stageBytes,
+		BytesTotal: progress.bytesTotal,
+	}
+	if !scanStart.IsZero() {
+		e.Elapsed = time.Since(scanStart).Seconds()
+	}
+	if secs := time.Since(progress.stageStart).Seconds(); secs > 0 {
+		e.Rate = float64(e.Bytes) / secs
+	}
+	if e.BytesTotal > e.Bytes && e.Rate > 0 {
+		e.ETA = float64(e.BytesTotal-e.Bytes) / e.Rate
+	}
+	// a reader gone away must not stop the scan
+	if progress.enc.Encode(e) != nil {
+		progress.enc = nil
+	}
+}
+
+// hash writer counting read bytes as they come, for the budget and progress of large files
+type countingWriter struct {
+	io.Writer
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	addHashed(int64(n))
+	return n, err
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// purge files quarantined longer than this from the -move-to dir after acting, 0 keeps them
+var quarantineKeepFlag retention
+
+// flag value for how long to keep things, a duration like 36h or a number of days like 30d
+type retention time.Duration
+
+func (r *retention) String() string {
+	d := time.Duration(*r)
+	if d > 0 && d%(24*time.Hour) == 0 {
+		return strconv.FormatInt(int64(d/(24*time.Hour)), 10) + "d"
+	}
+	return d.String()
+}
+
+func (r *retention) Set(s string) error {
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid retention %q", s)
+		}
+		*r = retention(n * float64(24*time.Hour))
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return fmt.Errorf("invalid retention %q", s)
+	}
+	*r = retention(d)
+	return nil
+}
+
+// what restoring does when the original path of a file is taken again: skip, rename or overwrite
+var onConflictFlag string
+
+// dup quarantine: purge or restore files -move-to put into a quarantine dir
+func quarantineCmd(args []string) error {
+	flags := flag.NewFlagSet("quarantine", flag.ExitOnError)
+	logFlag := flags.String("log", empty, "audit log recording when files were quarantined, default audit.jsonl in the state dir")
+	flags.StringVar(&stateDirFlag, "state-dir", empty, "state dir holding the default audit log")
+	dryRun := flags.Bool("dry-run", false, "only list what would be done")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %[1]s quarantine purge -keep AGE [flags] DIR\n       %[1]s quarantine restore [flags] [PATTERN]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 || (args[0] != "purge" && args[0] != "restore") {
+		flags.Usage()
+		return errors.New("unknown quarantine command, must be purge or restore")
+	}
+	restore := args[0] == "restore"
+	if restore {
+		flags.StringVar(&onConflictFlag, "on-conflict", "skip", "when a file's original path is taken again: skip it, rename it to NAME.restored, or overwrite the file there")
+	} else {
+		quarantineKeepFlag = -1
+		flags.Var(&quarantineKeepFlag, "keep", "remove files quarantined longer ago than this, e.g. 30d or 12h, 0 for all")
+	}
+	parseFlags(flags, args[1:])
+	switch {
+	case restore && flags.NArg() > 1:
+		flags.Usage()
+		return errors.New("at most one pattern can be given")
+	case restore && onConflictFlag != "skip" && onConflictFlag != "rename" && onConflictFlag != "overwrite":
+		return fmt.Errorf("unknown -on-conflict %s, use skip, rename or overwrite", onConflictFlag)
+	case !restore && flags.NArg() != 1:
+		flags.Usage()
+		return errors.New("one quarantine dir must be given")
+	case !restore && quarantineKeepFlag < 0:
+		return errors.New("-keep must be given, -keep 0 purges everything")
+	}
+	if *logFlag == empty {
+		var err error
+		if *logFlag, err = defaultAuditLog(); err != nil {
+			return err
+		}
+	}
+	if !*dryRun {
+		if err := openAudit(*logFlag); err != nil {
+			return err
+		}
+		defer auditFile.Close()
+	}
+	if restore {
+		return restoreQuarantined(flags.Arg(0), *logFlag, *dryRun)
+	}
+	return purgeQuarantine(flags.Arg(0), *logFlag, quarantineKeepFlag, *dryRun)
+}
+
+// files under dir, any quarantine dir when empty, the audit log last records as quarantined there,
+// with that entry, files purged or restored since are left out
+func quarantined(dir, logFile string) (map[string]auditEntry, error) {
+	if dir != empty {
+		dir = checkpointKey(dir)
+	}
+	f, err := os.Open(logFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	files := make(map[string]auditEntry)
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*KB), int(1*MB))
+	for line := 1; s.Scan(); line++ {
+		var e auditEntry
+		if err = json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", logFile, line, err)
+		}
+		switch {
+		case e.Action == "quarantine" && (dir == empty || isUnder(e.Target, dir)):
+			files[e.Target] = e
+		case e.Action == "purge" || e.Action == "restore":
+			delete(files, e.Source)
+		}
+	}
+	return files, s.Err()
+}
+
+// remove files moved to the quarantine dir longer than keep ago, by the times
+// the audit log recorded, and the directories left empty by them
+func purgeQuarantine(dir, logFile string, keep retention, dryRun bool) error {
+	files, err := quarantined(dir, logFile)
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(files))
+	for p, e := range files {
+		if time.Since(e.Time) > time.Duration(keep) {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	var purged int
+	var bytes int64
+	for _, p := range paths {
+		e := files[p]
+		fi, err := os.Lstat(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err == nil && fi.Size() != e.Size {
+			err = fmt.Errorf("size changed from %d to %d bytes since it was quarantined", e.Size, fi.Size())
+		}
+		if err == nil && !dryRun {
+			err = os.Remove(p)
+		}
+		if err != nil {
+			log.Printf("skip %s: %v\n", p, err)
+			continue
+		}
+		if dryRun {
+			fmt.Printf("%s %s\n", e.Time.Format(time.RFC3339), p)
+		} else {
+			if err = audit("purge", p, empty, FileDetail{hash: e.Hash, size: e.Size}); err != nil {
+				return fmt.Errorf("can't write audit log: %v", err)
+			}
+			removeEmptyDirs(filepath.Dir(p), checkpointKey(dir))
+		}
+		purged++
+		bytes += e.Size
+	}
+	verb := "purged"
+	if dryRun {
+		verb = "would be purged"
+	}
+	log.Printf("%d files quarantined more than %s ago %s from %s, %d bytes\n", purged, keep.String(), verb, dir, bytes)
+	return nil
+}
+
+// remove dir and its parents up to root while they are empty
+func removeEmptyDirs(dir, root string) {
+	for dir != root && isUnder(dir, root) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// move files quarantined from an original path matching pattern, by name or whole path,
+// all with an empty pattern, back to where they were
+func restoreQuarantined(pattern, logFile string, dryRun bool) error {
+	if _, err := filepath.Match(pattern, empty); err != nil {
+		return err
+	}
+	files, err := quarantined(empty, logFile)
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(files))
+	for p, e := range files {
+		name, _ := filepath.Match(pattern, filepath.Base(e.Source))
+		whole, _ := filepath.Match(pattern, e.Source)
+		if pattern == empty || name || whole {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	var restored, skipped int
+	for _, p := range paths {
+		e := files[p]
+		if _, err := os.Lstat(p); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		dst, err := restorePath(e.Source)
+		if err == nil && dst == empty {
+			err = errors.New("original path is taken again, use -on-conflict rename or overwrite")
+		}
+		if err == nil && dryRun {
+			fmt.Printf("%s -> %s\n", p, dst)
+			restored++
+			continue
+		}
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(dst), 0755)
+		}
+		if err == nil {
+			err = moveFile(p, dst, e.Size)
+		}
+		if err != nil {
+			log.Printf("skip %s: %v\n", p, err)
+			skipped++
+			continue
+		}
+		log.Printf("restore %s -> %s\n", p, dst)
+		if err = audit("restore", p, dst, FileDetail{hash: e.Hash, size: e.Size}); err != nil {
+			return fmt.Errorf("can't write audit log: %v", err)
+		}
+		restored++
+	}
+	verb := "restored"
+	if dryRun {
+		verb = "would be restored"
+	}
+	log.Printf("%d quarantined files %s, %d skipped\n", restored, verb, skipped)
+	return nil
+}
+
+// where a file quarantined from original goes back to by -on-conflict, empty to skip it
+func restorePath(original string) (string, error) {
+	_, err := os.Lstat(original)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return original, nil
+	case err != nil:
+		return empty, err
+	case onConflictFlag == "overwrite":
+		return original, nil
+	case onConflictFlag == "rename":
+		dst := original + ".restored"
+		for i := 1; ; i++ {
+			if _, err := os.Lstat(dst); errors.Is(err, os.ErrNotExist) {
+				return dst, nil
+			}
+			dst = original + ".restored." + strconv.Itoa(i)
+		}
+	}
+	return empty, nil
+}
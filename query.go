@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dup query: look up files in the hashes of the -cache, without scanning
+func queryCmd(args []string) error {
+	flags := flag.NewFlagSet("query", flag.ExitOnError)
+	sum := flags.String("hash", empty, "list the cached files with this content hash, as hex or ALGORITHM:hex, e.g. the sha256 of a file, of any -hash or -strong-hash")
+	prefix := flags.String("path", empty, "list the cached files under this path prefix with their hashes")
+	flags.StringVar(&cacheDirFlag, "cache-dir", empty, "dir of the -cache hashes")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %[1]s query -hash HASH [flags]\n       %[1]s query -path PREFIX [flags]\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Answers from the hashes -cache scans kept, as of those scans, and fails when nothing matches.")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if (*sum == empty) == (*prefix == empty) || flags.NArg() > 0 {
+		flags.Usage()
+		return errors.New("one of -hash and -path must be given")
+	}
+	caches, err := loadHashCaches()
+	if err != nil {
+		return err
+	}
+	algo, hex, ok := strings.Cut(strings.ToLower(*sum), ":")
+	if !ok {
+		algo, hex = empty, algo
+	}
+	if *sum != empty && hex == empty {
+		return fmt.Errorf("no hash in -hash %s", *sum)
+	}
+	if *prefix != empty {
+		*prefix = checkpointKey(*prefix)
+	}
+	var lines []string
+	for _, c := range caches {
+		for path, e := range c.Hashes {
+			if *prefix != empty {
+				if strings.HasPrefix(path, *prefix) {
+					lines = append(lines, fmt.Sprintf("%s:%s %d %s", c.Algorithm, e.Hash, e.Size, path))
+				}
+				continue
+			}
+			strongAlgo, strong, _ := strings.Cut(e.Strong, ":")
+			if (algo == empty || algo == c.Algorithm) && e.Hash == hex || (algo == empty || algo == strongAlgo) && strong == hex {
+				lines = append(lines, path)
+			}
+		}
+	}
+	sort.Strings(lines)
+	var last string
+	for _, l := range lines {
+		// files cached by several algorithms show once
+		if l != last {
+			fmt.Println(l)
+		}
+		last = l
+	}
+	if len(lines) == 0 {
+		return errors.New("no cached file matches")
+	}
+	return nil
+}
+
+// the hash caches of every algorithm in the cache dir
+func loadHashCaches() ([]checkpointFile, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "hashes-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no hashes cached in %s, scan with -cache first", dir)
+	}
+	var caches []checkpointFile
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		var c checkpointFile
+		if err = json.Unmarshal(b, &c); err != nil {
+			return nil, fmt.Errorf("%s: %v", f, err)
+		}
+		caches = append(caches, c)
+	}
+	return caches, nil
+}
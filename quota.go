@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// show how much the usage of every user and group under the scanned dir shrinks with the -keep policy
+var quotaImpactFlag bool
+
+// bytes of a user or group under the scanned dir, and those removing the copies frees
+type quotaUsage struct {
+	name        string
+	used, freed int64
+}
+
+// names of gids looked up so far
+var groupNames = make(map[int]string)
+
+// user name of uid, the uid when it has none
+func uidName(uid int) string {
+	if name, ok := ownerNames[uid]; ok {
+		return name
+	}
+	name := strconv.Itoa(uid)
+	if u, err := user.LookupId(name); err == nil {
+		name = u.Username
+	}
+	ownerNames[uid] = name
+	return name
+}
+
+// group name of gid, the gid when it has none
+func gidName(gid int) string {
+	if name, ok := groupNames[gid]; ok {
+		return name
+	}
+	name := strconv.Itoa(gid)
+	if g, err := user.LookupGroupId(name); err == nil {
+		name = g.Name
+	}
+	groupNames[gid] = name
+	return name
+}
+
+// print the usage of the users and groups owning files under dir, as quotas count
+// it, and what removing the copies of the groups would free of it; removed files
+// free their owner's usage, hardlinks to kept files are charged to its owner
+func printQuotaImpact(dir string, dups []FileGroup) error {
+	byUser := make(map[int]*quotaUsage)
+	byGroup := make(map[int]*quotaUsage)
+	add := func(fi fs.FileInfo, size int64, freed bool) error {
+		uid, gid, ok := owner(fi)
+		if !ok {
+			return fmt.Errorf("-quota-impact needs the owners of files, which this platform doesn't give")
+		}
+		for _, u := range []struct {
+			m    map[int]*quotaUsage
+			id   int
+			name func(int) string
+		}{{byUser, uid, uidName}, {byGroup, gid, gidName}} {
+			if u.m[u.id] == nil {
+				u.m[u.id] = &quotaUsage{name: u.name(u.id)}
+			}
+			if freed {
+				u.m[u.id].freed += size
+			} else {
+				u.m[u.id].used += size
+			}
+		}
+		return nil
+	}
+	// inodes are charged once however many links they have
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if id, links, err := fileID(path); err == nil && links > 1 {
+			if seen[id] {
+				return nil
+			}
+			seen[id] = true
+		}
+		size := fi.Size()
+		if alloc, sparse := allocated(path, fi); sparse {
+			size = alloc
+		}
+		return add(fi, size, false)
+	})
+	if err != nil {
+		return err
+	}
+	for _, g := range dups {
+		for _, f := range freedFiles(keepFiles(g, keepFlag)) {
+			fi, err := os.Lstat(f.path)
+			if err != nil {
+				continue
+			}
+			if err = add(fi, f.onDisk(), true); err != nil {
+				return err
+			}
+		}
+	}
+	printQuota("quota impact by user", byUser)
+	printQuota("quota impact by group", byGroup)
+	return nil
+}
+
+func printQuota(title string, usage map[int]*quotaUsage) {
+	fmt.Printf("%s:\n", paint(colorCyan, title))
+	rows := make([]*quotaUsage, 0, len(usage))
+	for _, u := range usage {
+		rows = append(rows, u)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].freed != rows[j].freed {
+			return rows[i].freed > rows[j].freed
+		}
+		return rows[i].name < rows[j].name
+	})
+	for _, u := range rows {
+		var share float64
+		if u.used > 0 {
+			share = 100 * float64(u.freed) / float64(u.used)
+		}
+		fmt.Printf("  %5.1f%%  %s of %s freed  %s\n", share, paint(colorBold, fmt.Sprintf("%10s", formatSize(u.freed))), formatSize(u.used), u.name)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// order files are read in for hashing: path, inode or size
+var readOrderFlag string
+
+func validReadOrder(o string) error {
+	switch o {
+	case "path", "inode", "size":
+		return nil
+	}
+	return fmt.Errorf("unknown -read-order %q, must be path, inode or size", o)
+}
+
+// sort files into the -read-order, so that reads of a spinning disk stay close to
+// each other: by path keeps files of a dir together, by inode follows the order
+// most filesystems allocated them in, by size reads the largest files first
+func orderReads(files []FileDetail) {
+	switch readOrderFlag {
+	case "path":
+		sort.SliceStable(files, func(i, j int) bool { return files[i].path < files[j].path })
+	case "size":
+		sort.SliceStable(files, func(i, j int) bool { return files[i].size > files[j].size })
+	case "inode":
+		ids := make(map[string]string, len(files))
+		for _, f := range files {
+			// files whose id can't be read go first, by path
+			ids[f.path], _, _ = fileID(f.path)
+		}
+		sort.SliceStable(files, func(i, j int) bool {
+			a, b := ids[files[i].path], ids[files[j].path]
+			if a == b {
+				return files[i].path < files[j].path
+			}
+			return idLess(a, b)
+		})
+	}
+}
+
+// whether file id a, DEVICE:INDEX with numbers without leading zeros, comes before b;
+// numbers of the same base compare by their length first, then digit by digit
+func idLess(a, b string) bool {
+	da, ia, _ := strings.Cut(a, ":")
+	db, ib, _ := strings.Cut(b, ":")
+	if da != db {
+		return da < db
+	}
+	if len(ia) != len(ib) {
+		return len(ia) < len(ib)
+	}
+	return ia < ib
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// read-only roots holding the originals, only copies of their files elsewhere are duplicates
+var referenceFlag stringList
+
+// absolute -reference roots
+var referenceDirs []string
+
+// make the -reference roots absolute and check they are dirs
+func parseReferences() error {
+	for _, r := range referenceFlag {
+		abs, err := filepath.Abs(r)
+		if err != nil {
+			return err
+		}
+		fi, err := os.Stat(abs)
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("-reference %s is not a dir", r)
+		}
+		referenceDirs = append(referenceDirs, abs)
+	}
+	return nil
+}
+
+// whether path is under one of the -reference roots
+func isReference(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, r := range referenceDirs {
+		if isUnder(abs, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// -reference roots not under dir, which a walk of dir misses
+func referencesOutside(dir string) []string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return referenceDirs
+	}
+	var outside []string
+	for _, r := range referenceDirs {
+		if !isUnder(r, abs) {
+			outside = append(outside, r)
+		}
+	}
+	return outside
+}
+
+// groups with a file under a -reference root and a copy of it outside them,
+// the others hold nothing to report
+func withReference(dups []FileGroup) []FileGroup {
+	var result []FileGroup
+	for _, g := range dups {
+		var refs int
+		for _, f := range g.files {
+			if isReference(f.path) {
+				refs++
+			}
+		}
+		if refs > 0 && refs < len(g.files) {
+			result = append(result, g)
+		}
+	}
+	if len(result) < len(dups) {
+		log.Printf("%d groups without both a -reference file and a copy outside left out\n", len(dups)-len(result))
+	}
+	return result
+}
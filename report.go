@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"html"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// dup report: render where the reclaimable bytes are
+func reportCmd(args []string) error {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	from := flags.String("from", empty, "take the groups from a result written with -o instead of scanning")
+	treemap := flags.String("treemap", empty, "write a treemap of reclaimable bytes by directory, as SVG, or as JSON for d3.hierarchy when the name ends in .json")
+	width := flags.Int("width", 1200, "SVG width in pixels")
+	height := flags.Int("height", 800, "SVG height in pixels")
+	grep := flags.String("grep", empty, "list the groups with a file whose path matches this regular expression, e.g. a file name, a folder like /photos/2019/ or (?i)holiday for any case; -treemap then draws only them")
+	flags.StringVar(&keepFlag, "keep", "first", "which file of a group is kept, as for dup -keep, the others are reclaimable")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %[1]s report -treemap FILE [flags] [dir]\n       %[1]s report -grep PATTERN [flags] [dir]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if *treemap == empty && *grep == empty || flags.NArg() > 1 {
+		flags.Usage()
+		return errors.New("-treemap or -grep must be given")
+	}
+	if err := validPolicy(keepFlag); err != nil {
+		return err
+	}
+	re, err := regexp.Compile(*grep)
+	if err != nil {
+		return fmt.Errorf("-grep: %v", err)
+	}
+	var dups []FileGroup
+	if *from != empty {
+		if basedir, dups, err = readResult(*from); err != nil {
+			return err
+		}
+	} else {
+		basedir = "."
+		if flags.NArg() == 1 {
+			basedir = flags.Arg(0)
+		}
+		if dups, err = findDup(basedir); err != nil {
+			return err
+		}
+	}
+
+	if *grep != empty {
+		dups = grepGroups(dups, re)
+		for i, g := range dups {
+			fmt.Printf("%d: %v", i+1, g)
+		}
+		log.Printf("%d groups have a file matching %s\n", len(dups), *grep)
+		if len(dups) == 0 {
+			return fmt.Errorf("no group has a file matching %s", *grep)
+		}
+		if *treemap == empty {
+			return nil
+		}
+	}
+
+	root := wasteTree(basedir, dups)
+	f, err := os.Create(*treemap)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(strings.ToLower(*treemap), ".json") {
+		enc := json.NewEncoder(f)
+		enc.SetIndent(empty, " ")
+		err = enc.Encode(root)
+	} else {
+		err = writeTreemap(f, root, float64(*width), float64(*height))
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		log.Printf("%d reclaimable bytes drawn to %s\n", root.total(), *treemap)
+	}
+	return err
+}
+
+// groups with a file whose path matches re
+func grepGroups(dups []FileGroup, re *regexp.Regexp) []FileGroup {
+	var result []FileGroup
+	for _, g := range dups {
+		for _, f := range g.files {
+			if re.MatchString(f.path) {
+				result = append(result, g)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// directory or file holding reclaimable bytes, marshals as the nested
+// {name, children, value} objects d3.hierarchy expects
+type wasteNode struct {
+	Name     string       `json:"name"`
+	Path     string       `json:"path"`
+	Value    int64        `json:"value,omitempty"` // files only, directories sum their children
+	Children []*wasteNode `json:"children,omitempty"`
+	dirs     map[string]*wasteNode
+}
+
+func (n *wasteNode) total() int64 {
+	t := n.Value
+	for _, c := range n.Children {
+		t += c.total()
+	}
+	return t
+}
+
+// tree of the removed files freeing space, under directories relative to dir
+func wasteTree(dir string, dups []FileGroup) *wasteNode {
+	root := &wasteNode{Name: dir, Path: dir, dirs: make(map[string]*wasteNode)}
+	for _, g := range dups {
+		for _, f := range freedFiles(keepFiles(g, keepFlag)) {
+			rel, err := filepath.Rel(dir, f.path)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				rel = f.path
+			}
+			parts := strings.Split(filepath.ToSlash(rel), "/")
+			n := root
+			for _, p := range parts[:len(parts)-1] {
+				c := n.dirs[p]
+				if c == nil {
+					c = &wasteNode{Name: p, Path: filepath.Join(n.Path, p), dirs: make(map[string]*wasteNode)}
+					n.dirs[p] = c
+					n.Children = append(n.Children, c)
+				}
+				n = c
+			}
+			n.Children = append(n.Children, &wasteNode{Name: parts[len(parts)-1], Path: f.path, Value: f.onDisk()})
+		}
+	}
+	return root
+}
+
+type rect struct {
+	x, y, w, h float64
+}
+
+// header height of directories, their name is written into it
+const treemapHeader = 14
+
+// write the waste tree as SVG treemap, files are colored by extension
+func writeTreemap(f *os.File, root *wasteNode, width, height float64) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%.0f\" height=\"%.0f\" font-family=\"sans-serif\" font-size=\"11\">\n", width, height)
+	drawNode(&b, root, rect{0, 0, width, height})
+	b.WriteString("</svg>\n")
+	_, err := f.WriteString(b.String())
+	return err
+}
+
+func drawNode(b *strings.Builder, n *wasteNode, r rect) {
+	if r.w < 1 || r.h < 1 {
+		return
+	}
+	title := fmt.Sprintf("<title>%s\n%d bytes</title>", html.EscapeString(n.Path), n.total())
+	if n.Children == nil {
+		hue := crc32.ChecksumIEEE([]byte(strings.ToLower(filepath.Ext(n.Name)))) % 360
+		fmt.Fprintf(b, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"hsl(%d,60%%,65%%)\" stroke=\"#fff\" stroke-width=\"0.5\">%s</rect>\n", r.x, r.y, r.w, r.h, hue, title)
+		if label := fit(n.Name, r.w); label != empty && r.h > 14 {
+			fmt.Fprintf(b, "<text x=\"%.1f\" y=\"%.1f\">%s</text>\n", r.x+3, r.y+12, html.EscapeString(label))
+		}
+		return
+	}
+	fmt.Fprintf(b, "<g><rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"#ddd\" stroke=\"#666\" stroke-width=\"0.5\">%s</rect>\n", r.x, r.y, r.w, r.h, title)
+	inner := rect{r.x + 1, r.y + 1, r.w - 2, r.h - 2}
+	if label := fit(n.Name, r.w); label != empty && r.h > 3*treemapHeader {
+		fmt.Fprintf(b, "<text x=\"%.1f\" y=\"%.1f\">%s</text>\n", r.x+3, r.y+11, html.EscapeString(label))
+		inner.y += treemapHeader - 1
+		inner.h -= treemapHeader - 1
+	}
+	children := append([]*wasteNode(nil), n.Children...)
+	sort.Slice(children, func(i, j int) bool { return children[i].total() > children[j].total() })
+	values := make([]float64, len(children))
+	for i, c := range children {
+		values[i] = float64(c.total())
+	}
+	for i, cr := range squarify(values, inner) {
+		drawNode(b, children[i], cr)
+	}
+	b.WriteString("</g>\n")
+}
+
+// name shortened to what roughly fits into width pixels, empty when nothing useful does
+func fit(name string, width float64) string {
+	max := int((width - 6) / 6.5)
+	r := []rune(name)
+	if len(r) <= max {
+		return name
+	}
+	if max < 4 {
+		return empty
+	}
+	return string(r[:max-1]) + "…"
+}
+
+// lay out values, sorted descending, in r with squarified rows so that the
+// rectangles stay close to squares
+func squarify(values []float64, r rect) []rect {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	out := make([]rect, 0, len(values))
+	if sum <= 0 || r.w <= 0 || r.h <= 0 {
+		for range values {
+			out = append(out, rect{})
+		}
+		return out
+	}
+	scale := r.w * r.h / sum
+	areas := make([]float64, len(values))
+	for i, v := range values {
+		areas[i] = v * scale
+	}
+	// worst aspect ratio of row laid out along a side of length s
+	worst := func(row []float64, s float64) float64 {
+		var rs, rmax float64
+		rmin := math.Inf(1)
+		for _, a := range row {
+			rs += a
+			rmax = math.Max(rmax, a)
+			rmin = math.Min(rmin, a)
+		}
+		return math.Max(s*s*rmax/(rs*rs), rs*rs/(s*s*rmin))
+	}
+	for start := 0; start < len(areas); {
+		s := math.Min(r.w, r.h)
+		end := start + 1
+		for end < len(areas) && worst(areas[start:end+1], s) <= worst(areas[start:end], s) {
+			end++
+		}
+		var rs float64
+		for _, a := range areas[start:end] {
+			rs += a
+		}
+		if r.w >= r.h {
+			// column at the left
+			cw := rs / r.h
+			y := r.y
+			for _, a := range areas[start:end] {
+				out = append(out, rect{r.x, y, cw, a / cw})
+				y += a / cw
+			}
+			r.x, r.w = r.x+cw, r.w-cw
+		} else {
+			// row at the top
+			rh := rs / r.w
+			x := r.x
+			for _, a := range areas[start:end] {
+				out = append(out, rect{x, r.y, a / rh, rh})
+				x += a / rh
+			}
+			r.y, r.h = r.y+rh, r.h-rh
+		}
+		start = end
+	}
+	return out
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// saved scan result, written by -o and read back by -from and dup plan
+type scanResult struct {
+	Base string    `json:"base"`
+	Time time.Time `json:"time"`
+	// -hash the groups were found by, crc32 when missing
+	Algorithm string        `json:"algorithm,omitempty"`
+	Groups    []resultGroup `json:"groups"`
+}
+
+type resultGroup struct {
+	Size int64  `json:"size"`
+	Hash string `json:"hash"`
+	// -strong-hash of the files, as algorithm:hex
+	Strong string `json:"strong,omitempty"`
+	// user owning the files, with -scope-by-owner
+	Owner string `json:"owner,omitempty"`
+	// exact, probable or similar, see setTiers
+	Tier  string       `json:"tier,omitempty"`
+	Notes []string     `json:"notes,omitempty"`
+	Files []resultFile `json:"files"`
+}
+
+type resultFile struct {
+	Path  string    `json:"path"`
+	Size  int64     `json:"size"`
+	Mtime time.Time `json:"mtime"`
+	// files with equal extents already share their storage
+	Extents string `json:"extents,omitempty"`
+	// bytes allocated on disk, only for sparse files
+	Allocated *int64 `json:"allocated,omitempty"`
+	// label of the cataloged drive an offline file is on
+	Offline string `json:"offline,omitempty"`
+}
+
+// format of the -o file path, -format when it is the only one, otherwise what its name says, json by default
+func outputFormat(path string) string {
+	if len(outputFlag) == 1 && formatFlag != "json" {
+		return formatFlag
+	}
+	switch strings.ToLower(filepath.Ext(uncompressedName(path))) {
+	case ".jsonl", ".ndjson":
+		return "jsonl"
+	case ".parquet":
+		return "parquet"
+	case ".sqlite", ".sqlite3", ".db":
+		return "sqlite"
+	case ".sarif":
+		return "sarif"
+	case ".html", ".htm":
+		return "html"
+	case ".txt":
+		return "summary"
+	}
+	return "json"
+}
+
+// write duplicate groups found under dir to a JSON file
+func writeResult(path string, dir string, dups []FileGroup) error {
+	r := scanResult{Base: dir, Time: time.Now(), Algorithm: hashFlag, Groups: []resultGroup{}}
+	for _, g := range dups {
+		r.Groups = append(r.Groups, newResultGroup(g))
+	}
+	b, err := json.MarshalIndent(r, empty, "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutput(path, append(b, '\n'))
+}
+
+func newResultGroup(g FileGroup) resultGroup {
+	size, _ := strconv.ParseInt(g.size, 10, 64)
+	rg := resultGroup{Size: size, Hash: g.hash, Strong: g.strong, Tier: g.tier, Owner: g.owner, Notes: g.notes}
+	for _, f := range g.files {
+		rf := resultFile{Path: f.path, Size: f.size, Mtime: f.mtime, Extents: f.extents, Offline: f.offline}
+		if f.sparse {
+			alloc := f.alloc
+			rf.Allocated = &alloc
+		}
+		rg.Files = append(rg.Files, rf)
+	}
+	return rg
+}
+
+// read a saved scan result, return its base dir and groups
+func readResult(path string) (string, []FileGroup, error) {
+	if isSQLite(path) {
+		return readSQLiteResult(path)
+	}
+	b, err := readInput(path)
+	if err != nil {
+		return empty, nil, err
+	}
+	var r scanResult
+	if err = json.Unmarshal(b, &r); err != nil {
+		return empty, nil, err
+	}
+	// hashes are verified and shown with the algorithm they were made with
+	hashFlag = "crc32"
+	if r.Algorithm != empty {
+		hashFlag = r.Algorithm
+	}
+	var dups []FileGroup
+	for _, rg := range r.Groups {
+		g := FileGroup{size: strconv.FormatInt(rg.Size, 10), hash: rg.Hash, strong: rg.Strong, tier: rg.Tier, owner: rg.Owner, notes: rg.Notes}
+		for _, rf := range rg.Files {
+			f := FileDetail{path: rf.Path, size: rf.Size, mtime: rf.Mtime, hash: rg.Hash, extents: rf.Extents, offline: rf.Offline}
+			if rf.Allocated != nil {
+				f.sparse, f.alloc = true, *rf.Allocated
+			}
+			g.files = append(g.files, f)
+		}
+		dups = append(dups, g)
+	}
+	return r.Base, dups, nil
+}
+
+// tables of the results database, a run per scan written to it
+var resultTables = []sqliteTable{
+	{name: "runs", sql: "CREATE TABLE runs (id INTEGER PRIMARY KEY, base TEXT NOT NULL, time TEXT NOT NULL, algorithm TEXT NOT NULL)"},
+	{name: "groups", sql: "CREATE TABLE groups (id INTEGER PRIMARY KEY, run_id INTEGER NOT NULL REFERENCES runs(id), size INTEGER NOT NULL, hash TEXT NOT NULL, strong TEXT, notes TEXT, tier TEXT, owner TEXT)"},
+	{name: "files", sql: "CREATE TABLE files (id INTEGER PRIMARY KEY, group_id INTEGER NOT NULL REFERENCES groups(id), path TEXT NOT NULL, size INTEGER NOT NULL, mtime TEXT NOT NULL, extents TEXT, allocated INTEGER, offline TEXT)"},
+	{name: "errors", sql: "CREATE TABLE errors (id INTEGER PRIMARY KEY, run_id INTEGER NOT NULL REFERENCES runs(id), path TEXT NOT NULL, error TEXT NOT NULL)"},
+}
+
+// make sure a run can be added to the database at path, if there is one: it is
+// written anew with the result tables alone, so it can't have any other objects
+func checkSQLiteResult(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	if !isSQLite(path) {
+		return fmt.Errorf("%s exists and is no SQLite database", path)
+	}
+	schema, err := sqliteSchema(path)
+	if err != nil {
+		return err
+	}
+	for _, s := range schema {
+		if len(s.values) < 2 {
+			return fmt.Errorf("%s: broken schema", path)
+		}
+		typ, _ := s.values[0].(string)
+		name, _ := s.values[1].(string)
+		if !isResultTable(typ, name) {
+			return fmt.Errorf("%s has %s %s, which dup can't keep when adding a run, write the run to a new file", path, typ, name)
+		}
+	}
+	return nil
+}
+
+// whether the schema object typ name is one of the resultTables
+func isResultTable(typ, name string) bool {
+	for _, t := range resultTables {
+		if typ == "table" && name == t.name {
+			return true
+		}
+	}
+	return false
+}
+
+// add the groups found under dir as a new run to the SQLite database at path,
+// runs already in it are kept, so that they can be joined
+func writeSQLiteResult(path string, dir string, dups []FileGroup) error {
+	tables := make(map[string][]sqliteRow)
+	if _, err := os.Stat(path); err == nil {
+		if err = checkSQLiteResult(path); err != nil {
+			return err
+		}
+		if tables, err = readSQLite(path); err != nil {
+			return err
+		}
+	}
+	next := func(table string) int64 {
+		rows := tables[table]
+		if len(rows) == 0 {
+			return 1
+		}
+		return rows[len(rows)-1].id + 1
+	}
+	run := next("runs")
+	tables["runs"] = append(tables["runs"], sqliteRow{run, []interface{}{nil, dir, time.Now().Format(time.RFC3339Nano), hashFlag}})
+	group, file := next("groups"), next("files")
+	for _, g := range dups {
+		size, _ := strconv.ParseInt(g.size, 10, 64)
+		var notes interface{}
+		if len(g.notes) > 0 {
+			notes = strings.Join(g.notes, "\n")
+		}
+		tables["groups"] = append(tables["groups"], sqliteRow{group, []interface{}{nil, run, size, g.hash, sqliteText(g.strong), notes, sqliteText(g.tier), sqliteText(g.owner)}})
+		for _, f := range g.files {
+			var alloc interface{}
+			if f.sparse {
+				alloc = f.alloc
+			}
+			tables["files"] = append(tables["files"], sqliteRow{file, []interface{}{nil, group, f.path, f.size, f.mtime.Format(time.RFC3339Nano), sqliteText(f.extents), alloc, sqliteText(f.offline)}})
+			file++
+		}
+		group++
+	}
+	id := next("errors")
+	for _, e := range scanErrors {
+		tables["errors"] = append(tables["errors"], sqliteRow{id, []interface{}{nil, run, e.path, e.err}})
+		id++
+	}
+	all := make([]sqliteTable, len(resultTables))
+	for i, t := range resultTables {
+		all[i] = t
+		all[i].rows = tables[t.name]
+	}
+	return writeSQLite(path, all)
+}
+
+// s as a TEXT value, NULL when empty
+func sqliteText(s string) interface{} {
+	if s == empty {
+		return nil
+	}
+	return s
+}
+
+// read the latest run of a results database, return its base dir and groups
+func readSQLiteResult(path string) (string, []FileGroup, error) {
+	tables, err := readSQLite(path)
+	if err != nil {
+		return empty, nil, err
+	}
+	runs := tables["runs"]
+	if len(runs) == 0 {
+		return empty, nil, fmt.Errorf("%s holds no runs", path)
+	}
+	run := runs[len(runs)-1]
+	if len(run.values) < 4 {
+		return empty, nil, errors.New("broken runs table")
+	}
+	base, _ := run.values[1].(string)
+	hashFlag, _ = run.values[3].(string)
+	var dups []FileGroup
+	byID := make(map[int64]int)
+	for _, r := range tables["groups"] {
+		if len(r.values) < 6 || r.values[1] != run.id {
+			continue
+		}
+		size, _ := r.values[2].(int64)
+		g := FileGroup{size: strconv.FormatInt(size, 10)}
+		g.hash, _ = r.values[3].(string)
+		g.strong, _ = r.values[4].(string)
+		if notes, ok := r.values[5].(string); ok {
+			g.notes = strings.Split(notes, "\n")
+		}
+		// databases written before tier and owner were added have fewer columns
+		if len(r.values) >= 8 {
+			g.tier, _ = r.values[6].(string)
+			g.owner, _ = r.values[7].(string)
+		}
+		byID[r.id] = len(dups)
+		dups = append(dups, g)
+	}
+	for _, r := range tables["files"] {
+		if len(r.values) < 7 {
+			continue
+		}
+		gid, _ := r.values[1].(int64)
+		i, ok := byID[gid]
+		if !ok {
+			continue
+		}
+		f := FileDetail{hash: dups[i].hash}
+		f.path, _ = r.values[2].(string)
+		f.size, _ = r.values[3].(int64)
+		if mtime, ok := r.values[4].(string); ok {
+			f.mtime, _ = time.Parse(time.RFC3339Nano, mtime)
+		}
+		f.extents, _ = r.values[5].(string)
+		if alloc, ok := r.values[6].(int64); ok {
+			f.sparse, f.alloc = true, alloc
+		}
+		if len(r.values) >= 8 {
+			f.offline, _ = r.values[7].(string)
+		}
+		dups[i].files = append(dups[i].files, f)
+	}
+	return base, dups, nil
+}
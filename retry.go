@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"syscall"
+	"time"
+)
+
+// how often a read failing with a transient error, like EIO or a timeout on SMB or NFS, is tried again
+var retriesFlag = 3
+
+// pause before the first retry, doubled for every further one
+const retryPause = 200 * time.Millisecond
+
+// files left out as reading them kept failing, of the scanErrors
+var readFailures int
+
+// whether err may go away when the read is tried again
+func transient(err error) bool {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	for _, e := range transientErrnos {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// whether err is the process or system running out of file descriptors, which no
+// file is to blame for and ends the scan instead of leaving the file out
+func exhausted(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
+
+// whether err will fail the same way in later runs, as a denied permission or a
+// bad sector does, so that they may skip the file; running out of fds, interrupted
+// calls and timeouts say nothing about the file
+func lasting(err error) bool {
+	if exhausted(err) || errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, syscall.ETIMEDOUT) ||
+		errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN) || errors.Is(err, errSourceGone) {
+		return false
+	}
+	var re *readError
+	return errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EIO) || errors.As(err, &re)
+}
+
+// run op on the file at path, again after a pause while it fails with a transient
+// error and -retries are left, and whenever it failed as the scan root was gone
+func retried(path string, op func() error) error {
+	pause := retryPause
+	for tries := 0; ; tries++ {
+		err := op()
+		if err == nil {
+			return nil
+		}
+		if transient(err) && tries < retriesFlag {
+			log.Printf("retrying %s in %v: %v\n", path, pause, err)
+			time.Sleep(pause)
+			pause *= 2
+			continue
+		}
+		if err = awaitRoot(rootOf(path), err); err != nil {
+			return err
+		}
+	}
+}
+
+// note a file left out as it couldn't be read, unless err ends the scan anyway
+func noteReadError(path string, err error) bool {
+	if errors.Is(err, errBudget) || errors.Is(err, errSourceGone) || exhausted(err) {
+		return false
+	}
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	msg := err.Error()
+	if transient(err) {
+		msg = fmt.Sprintf("failed %d times: %v", retriesFlag+1, err)
+	}
+	log.Printf("skipping %s: %s\n", path, msg)
+	scanErrors = append(scanErrors, scanError{path, msg, lasting(err)})
+	var re *readError
+	if errors.As(err, &re) {
+		diskProblems = append(diskProblems, diskProblem{path, re.offset, re.err.Error()})
+	}
+	readFailures++
+	return true
+}
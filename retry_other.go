@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+import "syscall"
+
+// errors of reads that may succeed when tried again
+var transientErrnos = []error{syscall.EIO, syscall.ETIMEDOUT, syscall.EAGAIN, syscall.EINTR, syscall.ECONNRESET, syscall.EHOSTDOWN}
@@ -0,0 +1,7 @@
+package main
+
+import "syscall"
+
+// errors of reads that may succeed when tried again: ERROR_CRC, ERROR_UNEXP_NET_ERR,
+// ERROR_NETNAME_DELETED, ERROR_SEM_TIMEOUT and ERROR_NETWORK_BUSY
+var transientErrnos = []error{syscall.Errno(23), syscall.Errno(59), syscall.Errno(64), syscall.Errno(121), syscall.Errno(54)}
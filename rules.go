@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// file of rules for content to leave out of the hash, see loadRules
+var ignoreRulesFlag string
+
+// part of the content of files matching a name pattern that is not hashed
+type contentRule struct {
+	pattern    string
+	start, end int64          // byte range start up to end, with a nil re
+	re         *regexp.Regexp // lines matching it
+}
+
+var contentRules []contentRule
+
+// read rules of the form
+//
+//	*.wav bytes 0-128
+//	*.log lines ^#timestamp
+//
+// a line per rule, the pattern is matched against file names as for -exclude,
+// the range leaves out bytes from the first offset up to the second, the
+// expression whole lines; files still need the same size to be grouped, which
+// embedded timestamps and serials of fixed width keep
+func loadRules(file string) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == empty || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			return fmt.Errorf("%s:%d: want PATTERN bytes START-END or PATTERN lines REGEXP", file, n)
+		}
+		r := contentRule{pattern: fields[0]}
+		if _, err = path.Match(r.pattern, empty); err != nil {
+			return fmt.Errorf("%s:%d: %v", file, n, err)
+		}
+		arg := strings.TrimSpace(fields[2])
+		switch fields[1] {
+		case "bytes":
+			from, to, ok := strings.Cut(arg, "-")
+			if r.start, err = strconv.ParseInt(from, 10, 64); ok && err == nil {
+				r.end, err = strconv.ParseInt(to, 10, 64)
+			}
+			if !ok || err != nil || r.start < 0 || r.end <= r.start {
+				return fmt.Errorf("%s:%d: invalid byte range %q", file, n, arg)
+			}
+		case "lines":
+			if r.re, err = regexp.Compile(arg); err != nil {
+				return fmt.Errorf("%s:%d: %v", file, n, err)
+			}
+		default:
+			return fmt.Errorf("%s:%d: unknown rule %q, must be bytes or lines", file, n, fields[1])
+		}
+		contentRules = append(contentRules, r)
+	}
+	return nil
+}
+
+// rules applying to file
+func rulesFor(file string) []contentRule {
+	var rules []contentRule
+	name := filepath.Base(file)
+	for _, r := range contentRules {
+		if ok, _ := path.Match(r.pattern, name); ok {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// whether parts of file are left out of its hash, such hashes are not cached
+// or taken from git, and file is never sampled
+func ruled(file string) bool {
+	return len(contentRules) > 0 && len(rulesFor(file)) > 0
+}
+
+// content of file to hash, without what the rules leave out
+func openContent(file string) (io.ReadCloser, error) {
+	f, err := openHinted(file, true)
+	if err != nil {
+		return nil, err
+	}
+	rules := rulesFor(file)
+	if len(rules) == 0 {
+		return f, nil
+	}
+	var r io.Reader = &rangeSkipper{r: f, rules: rules}
+	var res []*regexp.Regexp
+	for _, rule := range rules {
+		if rule.re != nil {
+			res = append(res, rule.re)
+		}
+	}
+	if len(res) > 0 {
+		r = &lineSkipper{r: bufio.NewReader(r), res: res}
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, f}, nil
+}
+
+// reader leaving out the byte ranges of rules
+type rangeSkipper struct {
+	r     io.Reader
+	rules []contentRule
+	off   int64
+}
+
+func (s *rangeSkipper) Read(p []byte) (int, error) {
+	for {
+		n, err := s.r.Read(p)
+		if n == 0 {
+			return 0, err
+		}
+		start := s.off
+		s.off += int64(n)
+		// drop the bytes inside any range, keeping the order of the others
+		kept := p[:0]
+		for i := 0; i < n; i++ {
+			if !s.skipped(start + int64(i)) {
+				kept = append(kept, p[i])
+			}
+		}
+		if len(kept) > 0 || err != nil {
+			return len(kept), err
+		}
+	}
+}
+
+func (s *rangeSkipper) skipped(off int64) bool {
+	for _, r := range s.rules {
+		if r.re == nil && off >= r.start && off < r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// reader leaving out lines matching any of res
+type lineSkipper struct {
+	r   *bufio.Reader
+	res []*regexp.Regexp
+	buf []byte
+}
+
+func (s *lineSkipper) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		line, err := s.r.ReadBytes('\n')
+		if len(line) > 0 && !s.matches(bytes.TrimRight(line, "\r\n")) {
+			s.buf = line
+		}
+		if err != nil {
+			if len(s.buf) == 0 {
+				return 0, err
+			}
+			break
+		}
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+func (s *lineSkipper) matches(line []byte) bool {
+	for _, re := range s.res {
+		if re.Match(line) {
+			return true
+		}
+	}
+	return false
+}
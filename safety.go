@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// refuse destructive actions on filesystem and home roots unless -allow-root
+func checkRoot(dir string) error {
+	if !allowRootFlag && protectedRoot(dir) {
+		return fmt.Errorf("refusing to act on %s, add -allow-root if you really mean it", dir)
+	}
+	return nil
+}
+
+// make sure destructive actions are wanted: ask for a "yes" listing the totals
+// on a terminal, or require -force
+func confirmActions(dir string, dups []FileGroup) error {
+	if forceFlag {
+		return nil
+	}
+	if !isTerminal(os.Stdin) {
+		return errors.New("not running interactively, add -force to act on duplicates")
+	}
+	var files int
+	var bytes int64
+	for _, g := range dups {
+		r, _, removed := resolve(g)
+		// -exec and plugin actions still run on groups without a built-in action
+		_, _, extra := resolveExtra(g)
+		if r.action == "report" && !extra {
+			continue
+		}
+		for _, f := range removed {
+			files++
+			bytes += f.size
+		}
+	}
+	fmt.Fprintf(os.Stderr, tr("About to %s %d files in %d groups, %s bytes under %s\nType yes to continue: "),
+		actionName(), files, len(dups), strconv.FormatInt(bytes, 10), dir)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if strings.TrimSpace(answer) != "yes" {
+		return errors.New("aborted")
+	}
+	return nil
+}
+
+// filesystem roots and the home directory itself
+func protectedRoot(dir string) bool {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return true
+	}
+	abs = filepath.Clean(abs)
+	if abs == filepath.VolumeName(abs)+string(filepath.Separator) {
+		return true
+	}
+	if home, err := os.UserHomeDir(); err == nil && strings.EqualFold(abs, filepath.Clean(home)) {
+		return true
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+)
+
+// also write found groups to this SARIF file, for code scanning annotations in CI
+var sarifFlag string
+
+// SARIF 2.1.0, as much of it as tells a CI where the duplicates are
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool struct {
+		Driver struct {
+			Name           string      `json:"name"`
+			InformationURI string      `json:"informationUri"`
+			Rules          []sarifRule `json:"rules"`
+		} `json:"driver"`
+	} `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifLocation `json:"originalUriBaseIds"`
+	Results            []sarifResult            `json:"results"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifResult struct {
+	RuleID              string                `json:"ruleId"`
+	Level               string                `json:"level"`
+	Message             sarifMessage          `json:"message"`
+	Locations           []sarifResultLocation `json:"locations"`
+	PartialFingerprints map[string]string     `json:"partialFingerprints"`
+}
+
+type sarifResultLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation sarifLocation `json:"artifactLocation"`
+	} `json:"physicalLocation"`
+}
+
+// result at location
+func newSARIFResult(loc sarifLocation, text string) sarifResult {
+	r := sarifResult{RuleID: "duplicate-file", Level: "warning", Message: sarifMessage{Text: text}}
+	r.Locations = make([]sarifResultLocation, 1)
+	r.Locations[0].PhysicalLocation.ArtifactLocation = loc
+	return r
+}
+
+// write a result for every file -keep would remove, at its path relative to dir
+func writeSARIF(path, dir string, dups []FileGroup) error {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	var run sarifRun
+	run.Tool.Driver.Name = "dup"
+	run.Tool.Driver.InformationURI = "https://github.com/oneryx/dup"
+	run.Tool.Driver.Rules = []sarifRule{{ID: "duplicate-file", ShortDescription: sarifMessage{Text: "File with the same content as another file"}}}
+	run.OriginalURIBaseIDs = map[string]sarifLocation{"SRCROOT": {URI: fileURI(root) + "/"}}
+	run.Results = []sarifResult{}
+	for _, g := range dups {
+		kept, removed := keepFiles(g, keepFlag)
+		for _, f := range removed {
+			loc := sarifURI(root, f.path)
+			r := newSARIFResult(loc, fmt.Sprintf("%s bytes, same content as %s (%d copies)", g.size, kept[0].path, len(g.files)))
+			// the same duplicate is the same alert in later runs
+			r.PartialFingerprints = map[string]string{"dupFile/v1": g.id() + ":" + loc.URI}
+			run.Results = append(run.Results, r)
+		}
+	}
+	l := sarifLog{Schema: "https://json.schemastore.org/sarif-2.1.0.json", Version: "2.1.0", Runs: []sarifRun{run}}
+	b, err := json.MarshalIndent(l, empty, "  ")
+	if err != nil {
+		return err
+	}
+	return writeOutput(path, append(b, '\n'))
+}
+
+// location of file relative to the SRCROOT root, or absolute outside it
+func sarifURI(root, file string) sarifLocation {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		abs = file
+	}
+	if rel, err := filepath.Rel(root, abs); err == nil && isUnder(abs, root) {
+		return sarifLocation{URI: (&url.URL{Path: filepath.ToSlash(rel)}).String(), URIBaseID: "SRCROOT"}
+	}
+	return sarifLocation{URI: fileURI(abs)}
+}
+
+// file: URI of an absolute path
+func fileURI(abs string) string {
+	p := filepath.ToSlash(abs)
+	if p[0] != '/' {
+		// C:/dir on Windows
+		p = "/" + p
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
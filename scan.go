@@ -0,0 +1,355 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dup scan: find copies of files that only exist as a stream or inside
+// images, without extracting them
+func scanCmd(args []string) error {
+	flags := flag.NewFlagSet("scan", flag.ExitOnError)
+	stdinTar := flags.Bool("stdin-tar", false, "read a tar stream from stdin, plain or gzip compressed")
+	stdinZip := flags.Bool("stdin-zip", false, "read a zip stream from stdin")
+	manifest := flags.String("manifest", empty, "also look for copies in this manifest of hash and path lines, as sha256sum or b3sum write them, with the matching -hash")
+	flags.StringVar(&hashFlag, "hash", "crc32", "content hash to compare by: "+strings.Join(hashNames(), ", "))
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s scan [-stdin-tar|-stdin-zip] [flags] [docker://IMAGE|oci:DIR|dir]...\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Hashes the files of an archive read from stdin, e.g. from ssh host tar -c /data, and of the layers")
+		fmt.Fprintln(flags.Output(), "of container images, from docker save or an OCI layout dir, and reports the ones with identical")
+		fmt.Fprintln(flags.Output(), "content among them, under the dirs or in the manifest.")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if *stdinTar && *stdinZip {
+		flags.Usage()
+		return errors.New("only one of -stdin-tar and -stdin-zip can be given")
+	}
+	if err := validHash(hashFlag); err != nil {
+		return err
+	}
+
+	var stream []FileDetail
+	var dirs []string
+	if *stdinTar || *stdinZip {
+		var files []FileDetail
+		var err error
+		in := bufio.NewReaderSize(os.Stdin, int(1*MB))
+		if *stdinTar {
+			files, err = readTarStream(in, streamPrefix)
+		} else {
+			files, err = readZipStream(in)
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("%d files hashed from stdin\n", len(files))
+		stream = append(stream, files...)
+	}
+	for _, arg := range flags.Args() {
+		var files []FileDetail
+		var err error
+		switch {
+		case strings.HasPrefix(arg, dockerPrefix):
+			files, err = readDockerImage(strings.TrimPrefix(arg, dockerPrefix))
+		case strings.HasPrefix(arg, ociPrefix):
+			files, err = readOCILayout(strings.TrimPrefix(arg, ociPrefix))
+		case isOCILayout(arg):
+			files, err = readOCILayout(arg)
+		default:
+			dirs = append(dirs, arg)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", arg, err)
+		}
+		log.Printf("%d files hashed from %s\n", len(files), arg)
+		stream = append(stream, files...)
+	}
+	if len(stream) == 0 && !*stdinTar && !*stdinZip {
+		flags.Usage()
+		return errors.New("-stdin-tar, -stdin-zip or an image must be given")
+	}
+
+	// size-hash as key, as filterByHash has it
+	groups := make(map[string][]FileDetail)
+	sizes := make(map[int64]bool)
+	streamed := make(map[string]bool)
+	for _, f := range stream {
+		key := strconv.FormatInt(f.size, 10) + "-" + f.hash
+		groups[key] = append(groups[key], f)
+		sizes[f.size] = true
+		streamed[f.path] = true
+	}
+	for _, dir := range dirs {
+		basedir = dir
+		var fds []FileDetail
+		if err := recursiveReadDir(basedir, &fds); err != nil {
+			return err
+		}
+		// only files of a size found in the stream can be copies
+		var candidates []FileDetail
+		for _, f := range fds {
+			if sizes[f.size] {
+				candidates = append(candidates, f)
+			}
+		}
+		log.Printf("Hashing %d of %d files under %s\n", len(candidates), len(fds), basedir)
+		hashes, err := hashAll(candidates, false)
+		if err != nil {
+			return err
+		}
+		for i, f := range candidates {
+			key := strconv.FormatInt(f.size, 10) + "-" + hashes[i]
+			if _, ok := groups[key]; ok {
+				groups[key] = append(groups[key], f)
+			}
+		}
+	}
+	if *manifest != empty {
+		if err := addManifest(*manifest, groups); err != nil {
+			return err
+		}
+	}
+
+	var dups []FileGroup
+	var copied int
+	for key, files := range groups {
+		if len(files) < 2 {
+			continue
+		}
+		for _, f := range files {
+			if streamed[f.path] {
+				copied++
+			}
+		}
+		s := strings.SplitN(key, "-", 2)
+		dups = append(dups, FileGroup{size: s[0], hash: s[1], files: files})
+	}
+	sort.Slice(dups, func(i, j int) bool {
+		if dups[i].files[0].size != dups[j].files[0].size {
+			return dups[i].files[0].size > dups[j].files[0].size
+		}
+		return dups[i].hash < dups[j].hash
+	})
+	for i, g := range dups {
+		fmt.Printf("%d: %v", i+1, g)
+	}
+	log.Printf("%d of %d streamed files have a copy\n", copied, len(stream))
+	return nil
+}
+
+// paths of files from the stream start with this
+const streamPrefix = "stdin:"
+
+// hash content of r with the -hash algorithm
+func hashReader(r io.Reader) (string, int64, error) {
+	h := newHash()
+	n, err := io.Copy(countingWriter{h}, r)
+	if err != nil {
+		return empty, n, err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), n, nil
+}
+
+// hash regular files of a tar stream, gzip compressed ones are recognized by their magic,
+// their paths get prefix
+func readTarStream(in *bufio.Reader, prefix string) ([]FileDetail, error) {
+	var r io.Reader = in
+	if magic, err := in.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(in)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	var files []FileDetail
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// whiteouts of image layers only mark files of lower layers deleted
+		if hdr.Typeflag != tar.TypeReg || hdr.Size == 0 || hdr.Size < int64(minSizeFlag) || strings.HasPrefix(path.Base(hdr.Name), ".wh.") {
+			continue
+		}
+		hashstr, _, err := hashReader(tr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", hdr.Name, err)
+		}
+		files = append(files, FileDetail{path: prefix + hdr.Name, size: hdr.Size, mtime: hdr.ModTime, hash: hashstr})
+	}
+}
+
+// zip record signatures
+const (
+	zipLocalHeader = 0x04034b50
+	zipDescriptor  = 0x08074b50
+	zipCentralDir  = 0x02014b50
+)
+
+// hash files of a zip stream by its local headers, the central directory at
+// the end can't be waited for. Entries are stored or deflated, their sizes
+// may follow the data in a descriptor as streaming zip writers do
+func readZipStream(in *bufio.Reader) ([]FileDetail, error) {
+	var files []FileDetail
+	for {
+		var sig uint32
+		if err := binary.Read(in, binary.LittleEndian, &sig); err != nil {
+			if err == io.EOF && len(files) == 0 {
+				return nil, errors.New("stdin is empty")
+			}
+			return nil, err
+		}
+		if sig == zipCentralDir {
+			// the rest repeats what the local headers said
+			return files, nil
+		}
+		if sig != zipLocalHeader {
+			return nil, fmt.Errorf("not a zip stream, record signature %08x", sig)
+		}
+		var h struct {
+			Version, Flags, Method, Time, Date uint16
+			CRC, CSize, USize                  uint32
+			NameLen, ExtraLen                  uint16
+		}
+		if err := binary.Read(in, binary.LittleEndian, &h); err != nil {
+			return nil, err
+		}
+		head := make([]byte, int(h.NameLen)+int(h.ExtraLen))
+		if _, err := io.ReadFull(in, head); err != nil {
+			return nil, err
+		}
+		name := string(head[:h.NameLen])
+		csize, usize := int64(h.CSize), int64(h.USize)
+		zip64 := false
+		for extra := head[h.NameLen:]; len(extra) >= 4; {
+			id, n := binary.LittleEndian.Uint16(extra), int(binary.LittleEndian.Uint16(extra[2:]))
+			if len(extra) < 4+n {
+				break
+			}
+			if id == 0x0001 && n >= 16 {
+				zip64 = true
+				usize = int64(binary.LittleEndian.Uint64(extra[4:]))
+				csize = int64(binary.LittleEndian.Uint64(extra[12:]))
+			}
+			extra = extra[4+n:]
+		}
+		descriptor := h.Flags&0x8 != 0
+		if h.Flags&0x1 != 0 {
+			return nil, fmt.Errorf("%s is encrypted", name)
+		}
+
+		var data io.Reader
+		compressed := &io.LimitedReader{R: in, N: csize}
+		switch {
+		case h.Method == 0 && descriptor:
+			return nil, fmt.Errorf("%s is stored with its size after the data, which can't be read as a stream", name)
+		case h.Method == 0:
+			data = compressed
+		case h.Method == 8 && descriptor:
+			// flate reads no further than the end of the deflate data from a ByteReader
+			data = flate.NewReader(in)
+		case h.Method == 8:
+			data = flate.NewReader(compressed)
+		default:
+			return nil, fmt.Errorf("%s uses unsupported compression method %d", name, h.Method)
+		}
+		hashstr, n, err := hashReader(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if !descriptor && h.Method == 8 {
+			// skip what the deflate reader may have left of the compressed data
+			if _, err = io.Copy(io.Discard, compressed); err != nil {
+				return nil, err
+			}
+		}
+		if descriptor {
+			if err = skipZipDescriptor(in, zip64); err != nil {
+				return nil, err
+			}
+		}
+		if strings.HasSuffix(name, "/") || n == 0 || n < int64(minSizeFlag) {
+			continue
+		}
+		if !descriptor && n != usize {
+			return nil, fmt.Errorf("%s: %d bytes instead of %d", name, n, usize)
+		}
+		files = append(files, FileDetail{path: streamPrefix + name, size: n, mtime: dosTime(h.Date, h.Time), hash: hashstr})
+	}
+}
+
+// skip crc and sizes following deflated data, the signature before them is optional
+func skipZipDescriptor(in *bufio.Reader, zip64 bool) error {
+	rest := 12
+	if zip64 {
+		rest = 20
+	}
+	b, err := in.Peek(4)
+	if err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint32(b) == zipDescriptor {
+		rest += 4
+	}
+	_, err = in.Discard(rest)
+	return err
+}
+
+// time of a zip header, in MS-DOS format
+func dosTime(date, t uint16) time.Time {
+	return time.Date(int(date>>9)+1980, time.Month(date>>5&0xf), int(date&0x1f), int(t>>11), int(t>>5&0x3f), int(t&0x1f)*2, 0, time.Local)
+}
+
+// compare files of a manifest with the stream files by hash, their sizes aren't known
+func addManifest(path string, groups map[string][]FileDetail) error {
+	f, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	byHash := make(map[string][]string)
+	for key := range groups {
+		h := key[strings.Index(key, "-")+1:]
+		byHash[h] = append(byHash[h], key)
+	}
+	s := bufio.NewScanner(f)
+	var lines int
+	for s.Scan() {
+		// sha256sum writes "hash  path", or "hash *path" for binary mode
+		hashstr, file, ok := strings.Cut(s.Text(), " ")
+		if !ok {
+			continue
+		}
+		lines++
+		file = strings.TrimPrefix(strings.TrimPrefix(file, " "), "*")
+		for _, key := range byHash[strings.ToLower(hashstr)] {
+			size := groups[key][0].size
+			groups[key] = append(groups[key], FileDetail{path: file, size: size})
+		}
+	}
+	if lines == 0 && s.Err() == nil {
+		return fmt.Errorf("%s has no hash and path lines", path)
+	}
+	return s.Err()
+}
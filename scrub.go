@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// dup scrub: read every file fully and compare it with its hash of the last scrub
+func scrubCmd(args []string) error {
+	flags := flag.NewFlagSet("scrub", flag.ExitOnError)
+	flags.StringVar(&hashFlag, "hash", "sha256", "content hash to keep of every file: sha256 or blake3")
+	flags.StringVar(&cacheDirFlag, "cache-dir", empty, "dir of the hash cache the hashes are kept in")
+	accept := flags.Bool("accept", false, "keep the content of files that changed silently as their good content, once they were checked or restored")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s scrub [flags] DIR\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Hashes every file under DIR in full and keeps the hashes in the hash cache, as -cache does.")
+		fmt.Fprintln(flags.Output(), "Later scrubs list the files whose content changed while their size and mtime didn't, which")
+		fmt.Fprintln(flags.Output(), "bit rot does but programs don't, and fail when there are any; their hashes of the first")
+		fmt.Fprintln(flags.Output(), "scrub are kept until -accept, so that they are listed again until dealt with.")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("one dir must be given")
+	}
+	if err := validStrong(hashFlag); err != nil {
+		return fmt.Errorf("-hash: %v", err)
+	}
+	dir := flags.Arg(0)
+	path, err := hashCachePath()
+	if err != nil {
+		return err
+	}
+	if err = loadCheckpoint(path); err != nil {
+		return err
+	}
+	fds, err := listFiles(dir)
+	if err != nil {
+		return err
+	}
+	var verified, added, modified, changed, failed int
+	for i := range fds {
+		f := &fds[i]
+		key := checkpointKey(f.path)
+		old, known := knownHashes[key]
+		err := retried(f.path, func() (err error) {
+			_, err = hash(f, false)
+			return err
+		})
+		if err != nil {
+			if !noteReadError(f.path, err) {
+				return err
+			}
+			failed++
+			continue
+		}
+		switch {
+		case !known:
+			added++
+		case old.Size != f.size || !old.Mtime.Equal(f.mtime):
+			modified++
+		case old.Hash == f.hash:
+			verified++
+		default:
+			fmt.Println(f.path)
+			log.Printf("%s changed silently, its %s was %s, is %s\n", f.path, hashFlag, old.Hash, f.hash)
+			changed++
+			if !*accept {
+				knownHashes[key] = old
+			}
+		}
+	}
+	printDiskProblems(log.Writer())
+	if err = saveCheckpoint(path, dir, fds); err != nil {
+		return err
+	}
+	log.Printf("%d files verified, %d new and %d modified since the last scrub, %d changed silently, %d unreadable\n", verified, added, modified, changed, failed)
+	if changed > 0 {
+		return fmt.Errorf("%d files changed while their size and mtime didn't, check them against a backup", changed)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d files couldn't be read", failed)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// UUID of the filesystem holding dir, by the udev links to its device, empty if unknown
+func volumeSerial(dir string) string {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return empty
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return empty
+	}
+	links, _ := filepath.Glob("/dev/disk/by-uuid/*")
+	for _, l := range links {
+		dev, err := os.Stat(l)
+		if err != nil {
+			continue
+		}
+		if ds, ok := dev.Sys().(*syscall.Stat_t); ok && uint64(ds.Rdev) == uint64(st.Dev) {
+			return filepath.Base(l)
+		}
+	}
+	return empty
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !windows
+
+package main
+
+// volume serials are only read on Linux and Windows
+func volumeSerial(dir string) string {
+	return empty
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+var procGetVolumeInformationW = modkernel32.NewProc("GetVolumeInformationW")
+
+// serial number of the volume holding dir, empty if unknown
+func volumeSerial(dir string) string {
+	root, err := syscall.UTF16PtrFromString(filepath.VolumeName(dir) + `\`)
+	if err != nil {
+		return empty
+	}
+	var serial uint32
+	if r, _, _ := procGetVolumeInformationW.Call(uintptr(unsafe.Pointer(root)), 0, 0, uintptr(unsafe.Pointer(&serial)), 0, 0, 0, 0); r == 0 {
+		return empty
+	}
+	return fmt.Sprintf("%04X-%04X", serial>>16, serial&0xffff)
+}
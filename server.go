@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// certificate and key to serve HTTPS with, PEM files
+var (
+	tlsCertFlag string
+	tlsKeyFlag  string
+)
+
+// bearer token clients of the servers must send, better given as $DUP_AUTH_TOKEN
+var authTokenFlag string
+
+// user:password clients of the servers must log in with, better given as $DUP_AUTH_BASIC
+var authBasicFlag string
+
+func validServer() error {
+	if (tlsCertFlag == empty) != (tlsKeyFlag == empty) {
+		return errors.New("-tls-cert and -tls-key must be given together")
+	}
+	if authBasicFlag != empty && !strings.Contains(authBasicFlag, ":") {
+		return errors.New("-auth-basic must be user:password")
+	}
+	return nil
+}
+
+// serve h on addr, over TLS and behind the token or basic auth asked for,
+// what is the kind of server for messages
+func serve(what, addr string, h http.Handler) error {
+	scheme := "http"
+	if tlsCertFlag != empty {
+		scheme = "https"
+	}
+	if authTokenFlag != empty || authBasicFlag != empty {
+		h = requireAuth(h)
+	} else if !loopback(addr) {
+		log.Printf("warning: %s on %s is open to everyone who can reach it, add -auth-token or -auth-basic\n", what, addr)
+	}
+	log.Printf("%s on %s://%s\n", what, scheme, addr)
+	if tlsCertFlag != empty {
+		return http.ListenAndServeTLS(addr, tlsCertFlag, tlsKeyFlag, h)
+	}
+	return http.ListenAndServe(addr, h)
+}
+
+// let requests through with the -auth-token bearer token or the -auth-basic login
+func requireAuth(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authTokenFlag != empty {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(authTokenFlag)) == 1 {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		if authBasicFlag != empty {
+			user, pass, ok := r.BasicAuth()
+			if ok && subtle.ConstantTimeCompare([]byte(user+":"+pass), []byte(authBasicFlag)) == 1 {
+				h.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="dup"`)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// whether addr only listens on the loopback interface
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	_        = iota // ignore first value by assigning to blank identifier
+	KB int64 = 1 << (10 * iota)
+	MB
+	GB
+	TB
+)
+
+// flag value for byte counts like 4k, 10MiB, 1.5GB or 4096, units are powers of 1024
+type byteSize int64
+
+func (b *byteSize) String() string {
+	return formatSize(int64(*b))
+}
+
+func (b *byteSize) Set(s string) error {
+	v, err := parseSize(s)
+	*b = byteSize(v)
+	return err
+}
+
+var units = []struct {
+	suffix string
+	size   int64
+}{{"T", TB}, {"G", GB}, {"M", MB}, {"K", KB}, {empty, 1}}
+
+// parse a byte count with optional unit K, M, G or T, optionally followed by B or iB
+func parseSize(s string) (int64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	t = strings.TrimSuffix(strings.TrimSuffix(t, "B"), "I")
+	for _, u := range units {
+		if u.suffix != empty && !strings.HasSuffix(t, u.suffix) {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(t, u.suffix)), 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid size %q", s)
+		}
+		return int64(v * float64(u.size)), nil
+	}
+	return 0, fmt.Errorf("invalid size %q", s)
+}
+
+// byte count with the largest unit it has at least one of
+func formatSize(n int64) string {
+	for _, u := range units {
+		if n >= u.size && u.size > 1 {
+			return strings.TrimSuffix(strconv.FormatFloat(float64(n)/float64(u.size), 'f', 1, 64), ".0") + u.suffix + "B"
+		}
+	}
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// snapshot trees of ZFS, btrfs snapper, NetApp and Synology, files in there are
+// immutable copies so duplicates against them can't be reclaimed anyway
+var snapshotDirs = map[string]bool{
+	".zfs":       true,
+	".snapshot":  true,
+	".snapshots": true,
+	"~snapshot":  true,
+	"#snapshot":  true,
+}
+
+// absolute -move-to or export-links dir, never scanned
+var quarantineDir string
+
+// well-known backup structures, which are duplicated by design
+var backupPresets = map[string]func(path, name string) bool{
+	// macOS Time Machine, HFS+ backupdb and network backup bundles
+	"timemachine": func(path, name string) bool {
+		return name == "Backups.backupdb" || strings.HasSuffix(name, ".backupbundle")
+	},
+	// Windows File History target, laid out as FileHistory\<user>\<computer>\{Configuration,Data}
+	"filehistory": func(path, name string) bool {
+		if name != "FileHistory" {
+			return false
+		}
+		m, _ := filepath.Glob(filepath.Join(path, "*", "*", "Configuration"))
+		return len(m) > 0
+	},
+	// borg repository, always has a README telling what it is
+	"borg": func(path, name string) bool {
+		b, err := os.ReadFile(filepath.Join(path, "README"))
+		return err == nil && bytes.HasPrefix(b, []byte("This is a Borg Backup repository"))
+	},
+	// restic repository layout
+	"restic": func(path, name string) bool {
+		for _, d := range []string{"data", "index", "keys", "snapshots"} {
+			if !isDir(filepath.Join(path, d)) {
+				return false
+			}
+		}
+		fi, err := os.Stat(filepath.Join(path, "config"))
+		return err == nil && fi.Mode().IsRegular()
+	},
+}
+
+// backup presets enabled by -backup-presets
+var presets []func(path, name string) bool
+
+// enable backup presets from comma separated names
+func parsePresets(s string) error {
+	presets = nil
+	for _, name := range strings.Split(s, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case empty, "none":
+		case "all":
+			for _, p := range backupPresets {
+				presets = append(presets, p)
+			}
+		default:
+			p, ok := backupPresets[name]
+			if !ok {
+				return fmt.Errorf("unknown backup preset %q", name)
+			}
+			presets = append(presets, p)
+		}
+	}
+	return nil
+}
+
+// directories never looked into
+func skipDir(path string) bool {
+	name := filepath.Base(path)
+	if name == ".git" || name == "@eaDir" || name == "#recycle" {
+		return true
+	}
+	if excluded(path) {
+		return true
+	}
+	if !snapshotsFlag && snapshotDirs[name] {
+		return true
+	}
+	if quarantineDir != empty {
+		// files already quarantined or exported are not duplicates any more
+		if abs, err := filepath.Abs(path); err == nil && abs == quarantineDir {
+			return true
+		}
+	}
+	for _, p := range presets {
+		if p(path, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// files never considered for duplication check
+func skipFile(path string) bool {
+	return filepath.Base(path) == ".DS_Store" || excluded(path) || committed(path)
+}
+
+// whether file matches an -exclude pattern, by its name or its path relative to the base dir
+func excluded(file string) bool {
+	if len(excludeFlag) == 0 {
+		return false
+	}
+	name := filepath.Base(file)
+	rel, err := filepath.Rel(basedir, file)
+	if err != nil {
+		rel = file
+	}
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range excludeFlag {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
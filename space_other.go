@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package main
+
+// free space is unknown, moves are attempted regardless
+func freeSpace(path string) (uint64, error) {
+	return 0, errNotSupported
+}
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+// SQLite database files, written and read without the library: tables are
+// b-trees of 4KB pages keyed by rowid, holding rows as records of typed values,
+// see https://www.sqlite.org/fileformat.html
+
+const sqliteMagic = "SQLite format 3\x00"
+
+const sqlitePageSize = 4096
+
+// b-tree page types
+const (
+	sqliteInterior = 0x05
+	sqliteLeaf     = 0x0d
+)
+
+// row of a table, values are nil, int64, float64 or string, the INTEGER
+// PRIMARY KEY column is stored as the rowid and nil in the values
+type sqliteRow struct {
+	id     int64
+	values []interface{}
+}
+
+type sqliteTable struct {
+	name, sql string
+	rows      []sqliteRow
+}
+
+func isSQLite(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	b := make([]byte, len(sqliteMagic))
+	_, err = f.Read(b)
+	return err == nil && string(b) == sqliteMagic
+}
+
+// pages of a database being written, page 1 holds the header and the schema
+type sqliteWriter struct {
+	pages [][]byte
+}
+
+func (w *sqliteWriter) alloc() uint32 {
+	w.pages = append(w.pages, make([]byte, sqlitePageSize))
+	return uint32(len(w.pages))
+}
+
+func (w *sqliteWriter) page(n uint32) []byte {
+	return w.pages[n-1]
+}
+
+// write tables to a new database file at path
+func writeSQLite(path string, tables []sqliteTable) error {
+	w := &sqliteWriter{}
+	w.alloc()
+	var schema []sqliteRow
+	for i, t := range tables {
+		root, err := w.table(t.rows)
+		if err != nil {
+			return err
+		}
+		schema = append(schema, sqliteRow{id: int64(i + 1), values: []interface{}{"table", t.name, t.name, int64(root), t.sql}})
+	}
+	var cells [][]byte
+	for _, r := range schema {
+		cells = append(cells, w.leafCell(r))
+	}
+	if !fits(100, 8, cells) {
+		return errors.New("sqlite schema doesn't fit in the first page")
+	}
+	writePage(w.page(1), 100, sqliteLeaf, cells, 0)
+
+	h := w.page(1)
+	copy(h, sqliteMagic)
+	binary.BigEndian.PutUint16(h[16:], sqlitePageSize)
+	h[18], h[19] = 1, 1 // rollback journal
+	h[21], h[22], h[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(h[24:], 1) // change counter
+	binary.BigEndian.PutUint32(h[28:], uint32(len(w.pages)))
+	binary.BigEndian.PutUint32(h[40:], 1) // schema cookie
+	binary.BigEndian.PutUint32(h[44:], 4) // schema format
+	binary.BigEndian.PutUint32(h[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(h[92:], 1)
+	binary.BigEndian.PutUint32(h[96:], 3040001)
+	// a failed write leaves the database there as it was
+	tmp := path + ".dup-tmp"
+	if err := os.WriteFile(tmp, bytes.Join(w.pages, nil), 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// write the b-tree of rows, sorted by id, return its root page
+func (w *sqliteWriter) table(rows []sqliteRow) (uint32, error) {
+	type child struct {
+		page uint32
+		key  int64 // largest rowid below
+	}
+	var level []child
+	var cells [][]byte
+	var last int64
+	flush := func() {
+		p := w.alloc()
+		writePage(w.page(p), 0, sqliteLeaf, cells, 0)
+		level = append(level, child{p, last})
+		cells = nil
+	}
+	for _, r := range rows {
+		c := w.leafCell(r)
+		if len(cells) > 0 && !fits(0, 8, append(cells, c)) {
+			flush()
+		}
+		cells = append(cells, c)
+		last = r.id
+	}
+	if len(cells) > 0 || len(level) == 0 {
+		flush()
+	}
+	// interior pages over the level below until one page is the root, children
+	// are spread evenly, the last one of a page is its right pointer; a cell is
+	// a page number and a varint key, 15 bytes with its pointer at most
+	const perPage = (sqlitePageSize-12)/15 + 1
+	for len(level) > 1 {
+		pages := (len(level) + perPage - 1) / perPage
+		per := (len(level) + pages - 1) / pages
+		var up []child
+		for len(level) > 0 {
+			n := per
+			if n > len(level) {
+				n = len(level)
+			}
+			var cells [][]byte
+			for _, c := range level[:n-1] {
+				cell := uint32Bytes(c.page)
+				cells = append(cells, appendSQLiteVarint(cell, uint64(c.key)))
+			}
+			p := w.alloc()
+			writePage(w.page(p), 0, sqliteInterior, cells, level[n-1].page)
+			up = append(up, child{p, level[n-1].key})
+			level = level[n:]
+		}
+		level = up
+	}
+	return level[0].page, nil
+}
+
+// cell of a table leaf: payload size, rowid and the record, as much of it as
+// fits with the rest in a chain of overflow pages
+func (w *sqliteWriter) leafCell(r sqliteRow) []byte {
+	rec := sqliteRecord(r.values)
+	c := appendSQLiteVarint(nil, uint64(len(rec)))
+	c = appendSQLiteVarint(c, uint64(r.id))
+	local := sqliteLocal(len(rec), sqlitePageSize)
+	c = append(c, rec[:local]...)
+	if local == len(rec) {
+		return c
+	}
+	rest := rec[local:]
+	first := w.alloc()
+	c = append(c, uint32Bytes(first)...)
+	for p := first; ; {
+		n := copy(w.page(p)[4:], rest)
+		rest = rest[n:]
+		if len(rest) == 0 {
+			return c
+		}
+		next := w.alloc()
+		binary.BigEndian.PutUint32(w.page(p), next)
+		p = next
+	}
+}
+
+func uint32Bytes(v uint32) []byte {
+	b := make([]byte, 4, 13)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+// bytes of a payload of size p kept on a leaf page of usable size u
+func sqliteLocal(p, u int) int {
+	x := u - 35
+	if p <= x {
+		return p
+	}
+	m := (u-12)*32/255 - 23
+	if k := m + (p-m)%(u-4); k <= x {
+		return k
+	}
+	return m
+}
+
+// whether cells fit a page with its b-tree header of size header at off
+func fits(off, header int, cells [][]byte) bool {
+	used := off + header + 2*len(cells)
+	for _, c := range cells {
+		used += len(c)
+	}
+	return used <= sqlitePageSize
+}
+
+// lay out a b-tree page: header at off, cell pointers after it, cells from the end
+func writePage(pg []byte, off int, typ byte, cells [][]byte, right uint32) {
+	header := 8
+	if typ == sqliteInterior {
+		header = 12
+		binary.BigEndian.PutUint32(pg[off+8:], right)
+	}
+	content := len(pg)
+	for i, c := range cells {
+		content -= len(c)
+		copy(pg[content:], c)
+		binary.BigEndian.PutUint16(pg[off+header+2*i:], uint16(content))
+	}
+	pg[off] = typ
+	binary.BigEndian.PutUint16(pg[off+3:], uint16(len(cells)))
+	binary.BigEndian.PutUint16(pg[off+5:], uint16(content))
+}
+
+// record of values: header of serial types, then the values
+func sqliteRecord(values []interface{}) []byte {
+	var types, body []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			types = appendSQLiteVarint(types, 0)
+		case int64:
+			switch {
+			case v == 0:
+				types = appendSQLiteVarint(types, 8)
+			case v == 1:
+				types = appendSQLiteVarint(types, 9)
+			default:
+				t, n := uint64(6), 8
+				for i, size := range []int{1, 2, 3, 4, 6} {
+					if limit := int64(1) << (8*size - 1); v >= -limit && v < limit {
+						t, n = uint64(i+1), size
+						break
+					}
+				}
+				types = appendSQLiteVarint(types, t)
+				for i := n - 1; i >= 0; i-- {
+					body = append(body, byte(v>>(8*i)))
+				}
+			}
+		case float64:
+			types = appendSQLiteVarint(types, 7)
+			var b [8]byte
+			binary.BigEndian.PutUint64(b[:], math.Float64bits(v))
+			body = append(body, b[:]...)
+		case string:
+			types = appendSQLiteVarint(types, uint64(2*len(v)+13))
+			body = append(body, v...)
+		}
+	}
+	// the header size counts itself
+	size := len(types) + 1
+	for len(appendSQLiteVarint(nil, uint64(size)))+len(types) != size {
+		size++
+	}
+	rec := appendSQLiteVarint(nil, uint64(size))
+	return append(append(rec, types...), body...)
+}
+
+// SQLite varints are big endian, 7 bits a byte, the ninth byte has 8
+func appendSQLiteVarint(b []byte, v uint64) []byte {
+	if v > 1<<56-1 {
+		var buf [9]byte
+		buf[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(b, buf[:]...)
+	}
+	var buf [8]byte
+	n := 0
+	for {
+		buf[n] = byte(v & 0x7f)
+		v >>= 7
+		n++
+		if v == 0 {
+			break
+		}
+	}
+	for i := n - 1; i >= 0; i-- {
+		c := buf[i]
+		if i > 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+func sqliteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 8 && i < len(b); i++ {
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	if len(b) < 9 {
+		return v, len(b)
+	}
+	return v<<8 | uint64(b[8]), 9
+}
+
+// database file being read
+type sqliteReader struct {
+	b        []byte
+	pageSize int
+	usable   int
+}
+
+// open the database at path, return it with its schema, a row per table, index,
+// view or trigger of type, name, table name, root page and SQL
+func openSQLite(path string) (*sqliteReader, []sqliteRow, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(b) < 100 || string(b[:16]) != sqliteMagic {
+		return nil, nil, fmt.Errorf("%s is not an SQLite database", path)
+	}
+	r := &sqliteReader{b: b, pageSize: int(binary.BigEndian.Uint16(b[16:]))}
+	if r.pageSize == 1 {
+		r.pageSize = 65536
+	}
+	r.usable = r.pageSize - int(b[20])
+	if enc := binary.BigEndian.Uint32(b[56:]); enc > 1 {
+		return nil, nil, fmt.Errorf("%s: only UTF-8 databases can be read", path)
+	}
+	schema, err := r.rows(1, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return r, schema, nil
+}
+
+// schema of the database at path, see openSQLite
+func sqliteSchema(path string) ([]sqliteRow, error) {
+	_, schema, err := openSQLite(path)
+	return schema, err
+}
+
+// rows of every table of the database at path, by table name
+func readSQLite(path string) (map[string][]sqliteRow, error) {
+	r, schema, err := openSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[string][]sqliteRow)
+	for _, s := range schema {
+		if len(s.values) < 4 || s.values[0] != "table" {
+			continue
+		}
+		name, _ := s.values[1].(string)
+		root, _ := s.values[3].(int64)
+		if tables[name], err = r.rows(uint32(root), 0); err != nil {
+			return nil, fmt.Errorf("%s: table %s: %v", path, name, err)
+		}
+	}
+	return tables, nil
+}
+
+func (r *sqliteReader) page(n uint32) ([]byte, error) {
+	start := int(n-1) * r.pageSize
+	if n == 0 || start+r.pageSize > len(r.b) {
+		return nil, fmt.Errorf("page %d out of the file", n)
+	}
+	return r.b[start : start+r.pageSize], nil
+}
+
+// rows of the table b-tree at page n, depth guards against loops in broken files
+func (r *sqliteReader) rows(n uint32, depth int) ([]sqliteRow, error) {
+	if depth > 20 {
+		return nil, errors.New("b-tree too deep")
+	}
+	pg, err := r.page(n)
+	if err != nil {
+		return nil, err
+	}
+	off := 0
+	if n == 1 {
+		off = 100
+	}
+	cells := int(binary.BigEndian.Uint16(pg[off+3:]))
+	var rows []sqliteRow
+	switch pg[off] {
+	case sqliteLeaf:
+		for i := 0; i < cells; i++ {
+			c := pg[binary.BigEndian.Uint16(pg[off+8+2*i:]):]
+			size, k := sqliteVarint(c)
+			id, k2 := sqliteVarint(c[k:])
+			c = c[k+k2:]
+			local := sqliteLocal(int(size), r.usable)
+			rec := append([]byte{}, c[:local]...)
+			for ovfl := uint32(0); len(rec) < int(size); {
+				if ovfl == 0 {
+					ovfl = binary.BigEndian.Uint32(c[local:])
+				}
+				op, err := r.page(ovfl)
+				if err != nil {
+					return nil, err
+				}
+				n := int(size) - len(rec)
+				if n > r.usable-4 {
+					n = r.usable - 4
+				}
+				rec = append(rec, op[4:4+n]...)
+				ovfl = binary.BigEndian.Uint32(op)
+			}
+			values, err := sqliteValues(rec)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, sqliteRow{id: int64(id), values: values})
+		}
+	case sqliteInterior:
+		for i := 0; i <= cells; i++ {
+			var child uint32
+			if i < cells {
+				child = binary.BigEndian.Uint32(pg[binary.BigEndian.Uint16(pg[off+12+2*i:]):])
+			} else {
+				child = binary.BigEndian.Uint32(pg[off+8:])
+			}
+			more, err := r.rows(child, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, more...)
+		}
+	default:
+		return nil, fmt.Errorf("page %d is no table b-tree page", n)
+	}
+	return rows, nil
+}
+
+// values of a record
+func sqliteValues(rec []byte) ([]interface{}, error) {
+	size, k := sqliteVarint(rec)
+	if int(size) > len(rec) {
+		return nil, errors.New("broken record")
+	}
+	types, body := rec[k:size], rec[size:]
+	var values []interface{}
+	for len(types) > 0 {
+		t, k := sqliteVarint(types)
+		types = types[k:]
+		var n int
+		switch {
+		case t >= 1 && t <= 4:
+			n = int(t)
+		case t == 5:
+			n = 6
+		case t == 6 || t == 7:
+			n = 8
+		case t >= 12:
+			n = int(t-12) / 2
+		}
+		if n > len(body) {
+			return nil, errors.New("broken record")
+		}
+		v := body[:n]
+		body = body[n:]
+		switch {
+		case t == 0:
+			values = append(values, nil)
+		case t == 7:
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(v)))
+		case t == 8 || t == 9:
+			values = append(values, int64(t-8))
+		case t <= 6:
+			i := int64(int8(v[0]))
+			for _, c := range v[1:] {
+				i = i<<8 | int64(c)
+			}
+			values = append(values, i)
+		default:
+			// text, and blobs read as strings too
+			values = append(values, string(v))
+		}
+	}
+	return values, nil
+}
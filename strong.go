@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// confirm groups with this collision resistant hash and record it, sha256 or blake3
+var strongFlag string
+
+// strong hashes by path as algorithm:hex, from this run or the cache
+var strongHashes = make(map[string]string)
+
+func validStrong(name string) error {
+	if name != "sha256" && name != "blake3" {
+		return fmt.Errorf("unknown -strong-hash %q, must be sha256 or blake3", name)
+	}
+	return nil
+}
+
+// splits groups by -strong-hash, so that a collision of a weak -hash can't
+// make files with different content duplicates
+type strongComparator struct{}
+
+func (strongComparator) Name() string {
+	return "strong-hash"
+}
+
+func (strongComparator) Key(f FileDetail) (string, error) {
+	if s, ok := strongHashes[f.path]; ok {
+		return s, nil
+	}
+	if hashFlag == strongFlag && f.hash != empty {
+		// grouped by it already
+		strongHashes[f.path] = strongFlag + ":" + f.hash
+		return strongHashes[f.path], nil
+	}
+	key := checkpointKey(f.path)
+	prefix := strongFlag + ":"
+	statsMu.Lock()
+	e, cached := knownHashes[key]
+	statsMu.Unlock()
+	// only entries of the file as it is now get the strong hash
+	cached = cached && e.Size == f.size && e.Mtime.Equal(f.mtime)
+	if cached && strings.HasPrefix(e.Strong, prefix) {
+		strongHashes[f.path] = e.Strong
+		return e.Strong, nil
+	}
+
+	fh, err := openContent(f.path)
+	if err != nil {
+		return empty, err
+	}
+	defer fh.Close()
+	h := hashers[strongFlag]()
+	if _, err = io.Copy(countingWriter{h}, fh); err != nil {
+		return empty, err
+	}
+	s := fmt.Sprintf("%s%x", prefix, h.Sum(nil))
+	strongHashes[f.path] = s
+	if cached {
+		statsMu.Lock()
+		e.Strong = s
+		knownHashes[key] = e
+		statsMu.Unlock()
+	}
+	return s, nil
+}
+
+// record the strong hash of the files on their groups
+func noteStrong(dups []FileGroup) {
+	for i := range dups {
+		dups[i].strong = strongHashes[dups[i].files[0].path]
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// number of largest groups listed in the summary
+const summaryGroups = 10
+
+// print totals and the groups wasting the most space, short enough for a notification mail,
+// colored only on stdout
+func printSummary(w io.Writer, dir string, dups []FileGroup) {
+	color := paint
+	if w != os.Stdout {
+		color = func(_, s string) string { return s }
+	}
+	var files int
+	var bytes int64
+	waste := make([]int64, len(dups))
+	for i, g := range dups {
+		kept, removed := keepFiles(g, keepFlag)
+		_, waste[i] = reclaimable(kept, removed)
+		files += len(removed)
+		bytes += waste[i]
+	}
+	fmt.Fprintf(w, tr("dup: %d duplicate groups under %s, %d redundant files, %s bytes reclaimable\n"), len(dups), dir, files, color(colorBold, strconv.FormatInt(bytes, 10)))
+	order := make([]int, len(dups))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return waste[order[i]] > waste[order[j]] })
+	for n, i := range order {
+		if n == summaryGroups {
+			fmt.Fprintf(w, tr("  ... and %d more groups\n"), len(dups)-summaryGroups)
+			break
+		}
+		kept, _ := keepFiles(dups[i], keepFlag)
+		if len(kept) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, tr("  %s bytes  %d copies of %s\n"), color(colorBold, fmt.Sprintf("%12d", waste[i])), len(dups[i].files), color(colorGreen, kept[0].path))
+	}
+	printDiskProblems(w)
+}
+
+// write the summary to a text file
+func writeSummary(path, dir string, dups []FileGroup) error {
+	w, err := createOutput(path)
+	if err != nil {
+		return err
+	}
+	printSummary(w, dir, dups)
+	return w.Close()
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	_ "net/http/pprof" // profiles served by -pprof
+	"os"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serve net/http/pprof profiles on this address, e.g. :6060
+var pprofFlag string
+
+// write a Go execution trace with a region per scan stage to this file, for go tool trace
+var traceFlag string
+
+// send scan stage spans to this OpenTelemetry collector, by OTLP over HTTP
+var otlpFlag string
+
+// a timed scan stage, exported as OpenTelemetry span
+type span struct {
+	name       string
+	id         string
+	parent     string
+	start, end time.Time
+	attrs      map[string]int64
+	region     *trace.Region
+}
+
+var (
+	traceID   string
+	rootSpan  *span
+	spans     []*span
+	traceTask *trace.Task
+	traceCtx  = context.Background()
+)
+
+// start pprof, tracing and span export as asked, return a function ending them
+func startTelemetry() (func(), error) {
+	if pprofFlag != empty {
+		go func() {
+			if err := serve("pprof", pprofFlag, http.DefaultServeMux); err != nil {
+				log.Printf("pprof: %v\n", err)
+			}
+		}()
+	}
+	var traceFile *os.File
+	if traceFlag != empty {
+		var err error
+		if traceFile, err = os.Create(traceFlag); err != nil {
+			return nil, err
+		}
+		if err = trace.Start(traceFile); err != nil {
+			traceFile.Close()
+			return nil, err
+		}
+		traceCtx, traceTask = trace.NewTask(context.Background(), "dup")
+	}
+	if otlpFlag == empty {
+		otlpFlag = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	traceID = randomID(16)
+	rootSpan = startSpan("scan")
+	return func() {
+		rootSpan.finish()
+		if traceFile != nil {
+			traceTask.End()
+			trace.Stop()
+			traceFile.Close()
+		}
+		if otlpFlag != empty || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != empty {
+			if err := exportSpans(); err != nil {
+				log.Printf("can't export spans: %v\n", err)
+			}
+		}
+	}, nil
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// start a stage, child of the whole scan
+func startSpan(name string) *span {
+	s := &span{name: name, id: randomID(8), start: time.Now(), attrs: make(map[string]int64)}
+	if rootSpan != nil {
+		s.parent = rootSpan.id
+	}
+	if traceTask != nil {
+		s.region = trace.StartRegion(traceCtx, name)
+	}
+	spans = append(spans, s)
+	return s
+}
+
+// end the stage, with attributes as name, value pairs
+func (s *span) finish(attrs ...interface{}) {
+	if s == nil || !s.end.IsZero() {
+		return
+	}
+	s.end = time.Now()
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if v, ok := attrs[i+1].(int); ok {
+			s.attrs[attrs[i].(string)] = int64(v)
+		}
+	}
+	if s.region != nil {
+		s.region.End()
+	}
+}
+
+// OTLP JSON encoding, see opentelemetry-proto/opentelemetry/proto/trace/v1
+type otlpValue struct {
+	StringValue string `json:"stringValue,omitempty"`
+	IntValue    string `json:"intValue,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID      string     `json:"traceId"`
+	SpanID       string     `json:"spanId"`
+	ParentSpanID string     `json:"parentSpanId,omitempty"`
+	Name         string     `json:"name"`
+	Kind         int        `json:"kind"`
+	Start        string     `json:"startTimeUnixNano"`
+	End          string     `json:"endTimeUnixNano"`
+	Attributes   []otlpAttr `json:"attributes,omitempty"`
+}
+
+// post all finished spans to the collector
+func exportSpans() error {
+	var out []otlpSpan
+	for _, s := range spans {
+		if s.end.IsZero() {
+			continue
+		}
+		o := otlpSpan{TraceID: traceID, SpanID: s.id, ParentSpanID: s.parent, Name: s.name, Kind: 1,
+			Start: strconv.FormatInt(s.start.UnixNano(), 10), End: strconv.FormatInt(s.end.UnixNano(), 10)}
+		for k, v := range s.attrs {
+			o.Attributes = append(o.Attributes, otlpAttr{Key: "dup." + k, Value: otlpValue{IntValue: strconv.FormatInt(v, 10)}})
+		}
+		out = append(out, o)
+	}
+	body := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttr{{Key: "service.name", Value: otlpValue{StringValue: "dup"}}},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "dup"},
+				"spans": out,
+			}},
+		}},
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	url := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if url == empty {
+		url = strings.TrimSuffix(otlpFlag, "/") + "/v1/traces"
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	log.Printf("%d spans sent to %s\n", len(out), url)
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// tiers of groups, by how sure it is that their files are the same
+const (
+	tierExact    = "exact"    // whole content matched by a collision resistant hash or compared with -no-hash
+	tierProbable = "probable" // whole content matched by a fast hash only, pending -strong-hash
+	tierSimilar  = "similar"  // content matched after -ignore-rules left parts out, or by a plugin's key
+)
+
+var tiers = []string{tierExact, tierProbable, tierSimilar}
+
+// only report groups of these tiers, comma separated, all when empty
+var tiersFlag string
+
+// only act on groups of these tiers, comma separated, all when empty; the others are only reported
+var actTiersFlag string
+
+// tier sets of -tiers and -act-tiers, nil for all
+var reportTiers, actTiers map[string]bool
+
+// set of the comma separated tiers of a flag, nil when empty
+func parseTiers(name, list string) (map[string]bool, error) {
+	if list == empty {
+		return nil, nil
+	}
+	set := make(map[string]bool)
+	for _, t := range strings.Split(list, ",") {
+		t = strings.TrimSpace(t)
+		if t != tierExact && t != tierProbable && t != tierSimilar {
+			return nil, fmt.Errorf("unknown tier %q in -%s, must be %s", t, name, strings.Join(tiers, ", "))
+		}
+		set[t] = true
+	}
+	return set, nil
+}
+
+// give groups without one their tier, by the hashes that matched their files
+func setTiers(dups []FileGroup) {
+	for i := range dups {
+		g := &dups[i]
+		if g.tier != empty {
+			continue
+		}
+		g.tier = tierProbable
+		if g.strong != empty || validStrong(hashFlag) == nil || hashFlag == noHash {
+			g.tier = tierExact
+		}
+		for _, f := range g.files {
+			if ruled(f.path) {
+				g.tier = tierSimilar
+				break
+			}
+		}
+	}
+}
+
+// groups of the -tiers
+func withTiers(dups []FileGroup) []FileGroup {
+	var result []FileGroup
+	for _, g := range dups {
+		if reportTiers[g.tier] {
+			result = append(result, g)
+		}
+	}
+	log.Printf("%d groups of other tiers than %s left out\n", len(dups)-len(result), tiersFlag)
+	return result
+}
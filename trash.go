@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DSM keeps its configuration here, only present on Synology boxes
+const synoinfo = "/etc/synoinfo.conf"
+
+// how deleted files are moved to a recycle bin on this system, nil when there is no way
+func trashFunc() func(path string) (string, error) {
+	if _, err := os.Stat(synoinfo); err == nil {
+		return synologyRecycle
+	}
+	return platformTrash
+}
+
+// move path to the recycle bin, return where it went
+func trash(path string) (string, error) {
+	t := trashFunc()
+	if t == nil {
+		return empty, errNotSupported
+	}
+	return t(path)
+}
+
+// move path into the #recycle bin of its Synology share, /volumeN/share/dir/file
+// goes to /volumeN/share/#recycle/dir/file as DSM does itself
+func synologyRecycle(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return empty, err
+	}
+	parts := strings.SplitN(strings.TrimPrefix(abs, "/"), "/", 3)
+	if len(parts) < 3 || !strings.HasPrefix(parts[0], "volume") {
+		return empty, errors.New("not on a shared folder")
+	}
+	bin := filepath.Join("/", parts[0], parts[1], "#recycle")
+	if !isDir(bin) {
+		return empty, errors.New("recycle bin is not enabled for shared folder " + parts[1])
+	}
+	dst, err := freeName(filepath.Join(bin, parts[2]))
+	if err != nil {
+		return empty, err
+	}
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return empty, err
+	}
+	return dst, os.Rename(abs, dst)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/hex"
+	"os/exec"
+	"strings"
+)
+
+// Finder moves files to the Trash so that Put Back works
+var platformTrash = finderTrash
+
+// review duplicates in Finder by tag instead of deleting them
+var platformTag = finderTag
+
+// let Finder delete path, return its location in the Trash
+func finderTrash(path string) (string, error) {
+	out, err := exec.Command("osascript",
+		"-e", "on run argv",
+		"-e", `tell application "Finder" to set t to delete (POSIX file (item 1 of argv) as alias)`,
+		"-e", "return POSIX path of (t as alias)",
+		"-e", "end run",
+		path).Output()
+	if err != nil {
+		return empty, err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// extended attribute holding Finder tags as binary property list of strings
+const userTagsXattr = "com.apple.metadata:_kMDItemUserTags"
+
+// add Finder tag to path, keeping the tags it already has
+func finderTag(path, tag string) error {
+	var tags []string
+	if out, err := exec.Command("xattr", "-px", userTagsXattr, path).Output(); err == nil {
+		b, err := hex.DecodeString(strings.Join(strings.Fields(string(out)), empty))
+		if err != nil {
+			return err
+		}
+		if tags, err = parseStringsPlist(b); err != nil {
+			return err
+		}
+	}
+	for _, t := range tags {
+		// tags may carry a color as "name\ncolor"
+		if strings.SplitN(t, "\n", 2)[0] == tag {
+			return nil
+		}
+	}
+	b := stringsPlist(append(tags, tag))
+	return exec.Command("xattr", "-wx", userTagsXattr, hex.EncodeToString(b), path).Run()
+}
@@ -0,0 +1,9 @@
+//go:build !darwin && !windows
+
+package main
+
+// no platform recycle bin, only Synology DSM's is known
+var platformTrash func(path string) (string, error)
+
+// Finder tags only exist on macOS
+var platformTag func(path, tag string) error
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// deletions go through the shell's IFileOperation, like Explorer does, so
+// files can be restored from the Recycle Bin
+var platformTrash = recycle
+
+// Finder tags only exist on macOS
+var platformTag func(path, tag string) error
+
+var (
+	modole32                        = syscall.NewLazyDLL("ole32.dll")
+	modshell32                      = syscall.NewLazyDLL("shell32.dll")
+	procCoInitializeEx              = modole32.NewProc("CoInitializeEx")
+	procCoUninitialize              = modole32.NewProc("CoUninitialize")
+	procCoCreateInstance            = modole32.NewProc("CoCreateInstance")
+	procSHCreateItemFromParsingName = modshell32.NewProc("SHCreateItemFromParsingName")
+)
+
+type guid struct {
+	data1 uint32
+	data2 uint16
+	data3 uint16
+	data4 [8]byte
+}
+
+var (
+	clsidFileOperation = guid{0x3ad05575, 0x8857, 0x4850, [8]byte{0x92, 0x77, 0x11, 0xb8, 0x5b, 0xdb, 0x8e, 0x09}}
+	iidFileOperation   = guid{0x947aab5f, 0x0a5c, 0x4c13, [8]byte{0xb4, 0xd6, 0x4b, 0xf7, 0x83, 0x6f, 0xc9, 0xf8}}
+	iidShellItem       = guid{0x43826d1e, 0xe718, 0x42ee, [8]byte{0xbc, 0x55, 0xa1, 0xe2, 0x61, 0xc3, 0x7b, 0xfe}}
+)
+
+const (
+	coinitApartmentThreaded = 0x2
+	coinitDisableOLE1DDE    = 0x4
+	clsctxAll               = 0x17
+	rpcEChangedMode         = 0x80010106
+
+	fofSilent           = 0x4
+	fofNoConfirmation   = 0x10
+	fofAllowUndo        = 0x40
+	fofNoErrorUI        = 0x400
+	fofxRecycleOnDelete = 0x80000
+	fofxEarlyFailure    = 0x100000
+)
+
+// vtable slots of IUnknown and IFileOperation
+const (
+	vtRelease                 = 2
+	vtSetOperationFlags       = 5
+	vtDeleteItem              = 18
+	vtPerformOperations       = 21
+	vtGetAnyOperationsAborted = 22
+)
+
+// call method slot of COM object obj
+func comCall(obj unsafe.Pointer, slot int, args ...uintptr) uintptr {
+	vtbl := *(**[vtGetAnyOperationsAborted + 1]uintptr)(obj)
+	r, _, _ := syscall.SyscallN(vtbl[slot], append([]uintptr{uintptr(obj)}, args...)...)
+	return r
+}
+
+func comFailed(hr uintptr) bool {
+	return int32(hr) < 0
+}
+
+func hresult(what string, hr uintptr) error {
+	return fmt.Errorf("%s failed: HRESULT 0x%08x", what, uint32(hr))
+}
+
+// move path to the Recycle Bin without any UI
+func recycle(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return empty, err
+	}
+	p, err := syscall.UTF16PtrFromString(abs)
+	if err != nil {
+		return empty, err
+	}
+	// COM state is per thread
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	hr, _, _ := procCoInitializeEx.Call(0, coinitApartmentThreaded|coinitDisableOLE1DDE)
+	if comFailed(hr) && hr != rpcEChangedMode {
+		return empty, hresult("CoInitializeEx", hr)
+	}
+	if !comFailed(hr) {
+		defer procCoUninitialize.Call()
+	}
+	var op unsafe.Pointer
+	hr, _, _ = procCoCreateInstance.Call(uintptr(unsafe.Pointer(&clsidFileOperation)), 0, clsctxAll,
+		uintptr(unsafe.Pointer(&iidFileOperation)), uintptr(unsafe.Pointer(&op)))
+	if comFailed(hr) {
+		return empty, hresult("CoCreateInstance(FileOperation)", hr)
+	}
+	defer comCall(op, vtRelease)
+	var item unsafe.Pointer
+	hr, _, _ = procSHCreateItemFromParsingName.Call(uintptr(unsafe.Pointer(p)), 0,
+		uintptr(unsafe.Pointer(&iidShellItem)), uintptr(unsafe.Pointer(&item)))
+	if comFailed(hr) {
+		return empty, hresult("SHCreateItemFromParsingName", hr)
+	}
+	defer comCall(item, vtRelease)
+	flags := uintptr(fofAllowUndo | fofSilent | fofNoConfirmation | fofNoErrorUI | fofxRecycleOnDelete | fofxEarlyFailure)
+	if hr = comCall(op, vtSetOperationFlags, flags); comFailed(hr) {
+		return empty, hresult("SetOperationFlags", hr)
+	}
+	if hr = comCall(op, vtDeleteItem, uintptr(item), 0); comFailed(hr) {
+		return empty, hresult("DeleteItem", hr)
+	}
+	if hr = comCall(op, vtPerformOperations); comFailed(hr) {
+		return empty, hresult("PerformOperations", hr)
+	}
+	var aborted int32
+	if hr = comCall(op, vtGetAnyOperationsAborted, uintptr(unsafe.Pointer(&aborted))); !comFailed(hr) && aborted != 0 {
+		return empty, fmt.Errorf("moving %s to the Recycle Bin was aborted", abs)
+	}
+	return "Recycle Bin", nil
+}
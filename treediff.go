@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// dup tree-diff: compare two trees by content
+func treeDiffCmd(args []string) error {
+	flags := flag.NewFlagSet("tree-diff", flag.ExitOnError)
+	all := flags.Bool("all", false, "also list identical files")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s tree-diff [flags] A B\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Compares trees A and B by content hash, lines are marked")
+		fmt.Fprintln(flags.Output(), "  -  only in A        + only in B         ~ same path, different content")
+		fmt.Fprintln(flags.Output(), "  >  content of A at another path in B  = identical (with -all)")
+		flags.PrintDefaults()
+	}
+	parseFlags(flags, args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return errors.New("A and B must be given")
+	}
+	a, b := flags.Arg(0), flags.Arg(1)
+	aFiles, aIndex, err := relFiles(a)
+	if err != nil {
+		return err
+	}
+	bFiles, bIndex, err := relFiles(b)
+	if err != nil {
+		return err
+	}
+
+	var onlyA, onlyB, changed, moved, identical int
+	for _, rel := range sortedKeys(aFiles) {
+		fa := aFiles[rel]
+		if fb, ok := bFiles[rel]; ok {
+			same := fa.size == fb.size
+			if same {
+				if same, err = sameContent(fa, fb.path); err != nil {
+					return err
+				}
+			}
+			if same {
+				identical++
+				if *all {
+					fmt.Printf("= %s\n", rel)
+				}
+			} else {
+				changed++
+				fmt.Printf("~ %s\n", rel)
+			}
+			continue
+		}
+		other, err := bIndex.find(fa)
+		if err != nil {
+			return err
+		}
+		if other != nil {
+			moved++
+			orel, _ := filepath.Rel(b, other.path)
+			fmt.Printf("> %s -> %s\n", rel, orel)
+			continue
+		}
+		onlyA++
+		fmt.Printf("- %s\n", rel)
+	}
+	for _, rel := range sortedKeys(bFiles) {
+		if _, ok := aFiles[rel]; ok {
+			continue
+		}
+		other, err := aIndex.find(bFiles[rel])
+		if err != nil {
+			return err
+		}
+		// content also in A is already listed as moved
+		if other == nil {
+			onlyB++
+			fmt.Printf("+ %s\n", rel)
+		}
+	}
+	fmt.Printf("%d only in A, %d only in B, %d changed, %d at other paths, %d identical\n", onlyA, onlyB, changed, moved, identical)
+	return nil
+}
+
+// regular files of tree by path relative to it, and their content index
+func relFiles(dir string) (map[string]*FileDetail, *treeIndex, error) {
+	fds, err := listFiles(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	ix := &treeIndex{bySize: make(map[int64][]*FileDetail)}
+	files := make(map[string]*FileDetail)
+	for i := range fds {
+		f := &fds[i]
+		rel, err := filepath.Rel(dir, f.path)
+		if err != nil {
+			return nil, nil, err
+		}
+		files[rel] = f
+		// share the FileDetail, so that every file is hashed at most once
+		ix.bySize[f.size] = append(ix.bySize[f.size], f)
+	}
+	return files, ix, nil
+}
+
+func sortedKeys(m map[string]*FileDetail) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
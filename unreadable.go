@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// try files again that couldn't be read in the last runs
+var retryUnreadableFlag bool
+
+// runs in a row a file must fail in before later runs skip it
+const unreadableRuns = 2
+
+// a file or dir that couldn't be read, as it was when it failed
+type unreadableEntry struct {
+	Error string    `json:"error"`
+	Size  int64     `json:"size"`
+	Mtime time.Time `json:"mtime"`
+	Runs  int       `json:"runs"` // runs in a row it failed in
+}
+
+// files and dirs that failed in earlier runs, by absolute path
+var unreadable map[string]unreadableEntry
+
+// paths skipped in this run as they keep failing
+var skippedUnreadable map[string]bool
+
+func unreadablePath() (string, error) {
+	state, err := stateDir()
+	if err != nil {
+		return empty, err
+	}
+	return filepath.Join(state, "unreadable.json"), nil
+}
+
+// read the files that failed in earlier runs, a missing list starts empty
+func loadUnreadable() error {
+	unreadable = make(map[string]unreadableEntry)
+	skippedUnreadable = make(map[string]bool)
+	path, err := unreadablePath()
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, &unreadable)
+}
+
+// whether the walk skips the file or dir of d, as it failed in the last runs and
+// is unchanged since
+func skipUnreadable(path string, d fs.DirEntry) bool {
+	if retryUnreadableFlag {
+		return false
+	}
+	key := checkpointKey(path)
+	e, ok := unreadable[key]
+	if !ok || e.Runs < unreadableRuns {
+		return false
+	}
+	fi, err := d.Info()
+	if err != nil || !fi.IsDir() && fi.Size() != e.Size || !fi.ModTime().Equal(e.Mtime) {
+		return false
+	}
+	skippedUnreadable[key] = true
+	return true
+}
+
+// write the files that failed in this run for lasting reasons, and those skipped,
+// under dir; paths that were read this time are forgotten, those of other dirs kept
+func saveUnreadable(dir string) error {
+	if unreadable == nil {
+		return nil
+	}
+	if n := len(skippedUnreadable); n > 0 {
+		log.Printf("%d files skipped that couldn't be read in earlier runs either, -retry-unreadable tries them again\n", n)
+	}
+	root := checkpointKey(dir)
+	next := make(map[string]unreadableEntry)
+	for k, e := range unreadable {
+		if skippedUnreadable[k] || !isUnder(k, root) {
+			next[k] = e
+		}
+	}
+	for _, se := range scanErrors {
+		if !se.lasting {
+			continue
+		}
+		k := checkpointKey(se.path)
+		e := unreadableEntry{Error: se.err, Runs: unreadable[k].Runs + 1}
+		if fi, err := os.Lstat(se.path); err == nil {
+			e.Size, e.Mtime = fi.Size(), fi.ModTime()
+		}
+		next[k] = e
+	}
+	path, err := unreadablePath()
+	if err != nil {
+		return err
+	}
+	if len(next) == 0 {
+		if err = os.Remove(path); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	b, err := json.MarshalIndent(next, empty, "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".dup-tmp"
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+// the change journal only exists on NTFS
+func enumerateUSN(dir string, fds *[]FileDetail) error {
+	return errors.New("USN enumeration is only supported on Windows")
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	fsctlEnumUsnData     = 0x000900b3
+	fsctlQueryUsnJournal = 0x000900f4
+)
+
+// USN_JOURNAL_DATA_V0
+type usnJournalData struct {
+	UsnJournalID    uint64
+	FirstUsn        int64
+	NextUsn         int64
+	LowestValidUsn  int64
+	MaxUsn          int64
+	MaximumSize     uint64
+	AllocationDelta uint64
+}
+
+// MFT_ENUM_DATA_V0
+type mftEnumData struct {
+	StartFileReferenceNumber uint64
+	LowUsn                   int64
+	HighUsn                  int64
+}
+
+// one MFT entry as reported by FSCTL_ENUM_USN_DATA
+type usnEntry struct {
+	parent uint64
+	name   string
+	dir    bool
+}
+
+// enumerate all files under dir by reading the MFT through the change journal,
+// this avoids listing every directory but needs admin rights on the volume
+func enumerateUSN(dir string, fds *[]FileDetail) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	baseRef, err := fileReference(abs)
+	if err != nil {
+		return err
+	}
+	entries, err := readMFT(filepath.VolumeName(abs))
+	if err != nil {
+		return err
+	}
+
+	// resolved directory paths, empty when the directory is not under the base dir
+	dirs := map[uint64]string{baseRef: abs}
+	var resolve func(ref uint64) string
+	resolve = func(ref uint64) string {
+		if path, ok := dirs[ref]; ok {
+			return path
+		}
+		// mark first, so that a cycle in corrupted metadata can't recurse forever
+		dirs[ref] = empty
+		e, ok := entries[ref]
+		if !ok || !e.dir {
+			return empty
+		}
+		if parent := resolve(e.parent); parent != empty {
+			if path := filepath.Join(parent, e.name); !skipDir(path) {
+				dirs[ref] = path
+			}
+		}
+		return dirs[ref]
+	}
+
+	for _, e := range entries {
+		if e.dir {
+			continue
+		}
+		parent := resolve(e.parent)
+		if parent == empty {
+			continue
+		}
+		path := filepath.Join(parent, e.name)
+		if skipFile(path) {
+			continue
+		}
+		fi, err := os.Lstat(path)
+		if err != nil {
+			// entry vanished or can't be accessed, same as walking past it
+			continue
+		}
+		// 0 size file is lock file, we don't want to consider it for duplication check
+		if size := fi.Size(); size > 0 && size >= int64(minSizeFlag) && !fi.IsDir() {
+			*fds = append(*fds, FileDetail{size: size, path: path, mtime: fi.ModTime()})
+		}
+	}
+	return nil
+}
+
+// 64 bit file reference number of path, same as the one used in USN records
+func fileReference(path string) (uint64, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	h, err := syscall.CreateFile(p, 0, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer syscall.CloseHandle(h)
+	var fi syscall.ByHandleFileInformation
+	if err = syscall.GetFileInformationByHandle(h, &fi); err != nil {
+		return 0, err
+	}
+	return uint64(fi.FileIndexHigh)<<32 | uint64(fi.FileIndexLow), nil
+}
+
+// read every file name record of the volume, keyed by file reference number
+func readMFT(volume string) (map[uint64]usnEntry, error) {
+	p, err := syscall.UTF16PtrFromString(`\\.\` + volume)
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(p, syscall.GENERIC_READ, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE,
+		nil, syscall.OPEN_EXISTING, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.CloseHandle(h)
+
+	var jd usnJournalData
+	var n uint32
+	if err = syscall.DeviceIoControl(h, fsctlQueryUsnJournal, nil, 0,
+		(*byte)(unsafe.Pointer(&jd)), uint32(unsafe.Sizeof(jd)), &n, nil); err != nil {
+		return nil, err
+	}
+
+	entries := make(map[uint64]usnEntry)
+	med := mftEnumData{HighUsn: jd.NextUsn}
+	buf := make([]byte, 1*MB)
+	for {
+		err = syscall.DeviceIoControl(h, fsctlEnumUsnData, (*byte)(unsafe.Pointer(&med)), uint32(unsafe.Sizeof(med)),
+			&buf[0], uint32(len(buf)), &n, nil)
+		if err == syscall.ERROR_HANDLE_EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n <= 8 {
+			return entries, nil
+		}
+		// buffer starts with the reference number to continue from, followed by USN_RECORD_V2 records
+		med.StartFileReferenceNumber = binary.LittleEndian.Uint64(buf)
+		for off := uint32(8); off+60 <= n; {
+			rec := buf[off:n]
+			length := binary.LittleEndian.Uint32(rec)
+			if length == 0 || length > uint32(len(rec)) {
+				break
+			}
+			if binary.LittleEndian.Uint16(rec[4:]) == 2 {
+				attrs := binary.LittleEndian.Uint32(rec[52:])
+				nameLen := uint32(binary.LittleEndian.Uint16(rec[56:]))
+				nameOff := uint32(binary.LittleEndian.Uint16(rec[58:]))
+				if nameOff+nameLen <= length {
+					name := make([]uint16, nameLen/2)
+					for i := range name {
+						name[i] = binary.LittleEndian.Uint16(rec[nameOff+uint32(i)*2:])
+					}
+					entries[binary.LittleEndian.Uint64(rec[8:])] = usnEntry{
+						parent: binary.LittleEndian.Uint64(rec[16:]),
+						name:   syscall.UTF16ToString(name),
+						dir:    attrs&syscall.FILE_ATTRIBUTE_DIRECTORY != 0,
+					}
+				}
+			}
+			off += length
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// how files are checked against the scan before acting on them: off, size
+// (size and mtime), hash (rehashed) or auto, which is hash for -from results
+// and size otherwise
+var verifyFlag string
+
+func validVerify(v string) error {
+	switch v {
+	case "off", "size", "hash", "auto":
+		return nil
+	}
+	return fmt.Errorf("unknown -verify %q, must be off, size, hash or auto", v)
+}
+
+// check every file of the group, kept and removed ones, is still as the scan
+// found it, files may have changed or vanished since, above all with -from
+func verifyGroup(g FileGroup) error {
+	level := verifyFlag
+	if level == "auto" {
+		level = "size"
+		if fromFlag != empty {
+			level = "hash"
+		}
+	}
+	if level == "off" {
+		return nil
+	}
+	for _, f := range localFiles(g.files) {
+		fi, err := os.Stat(f.path)
+		if err != nil {
+			return fmt.Errorf("%s vanished: %v", f.path, err)
+		}
+		if fi.Size() != f.size {
+			return fmt.Errorf("%s changed its size from %d to %d bytes", f.path, f.size, fi.Size())
+		}
+		if !f.mtime.IsZero() && !fi.ModTime().Equal(f.mtime) {
+			return fmt.Errorf("%s was modified at %v", f.path, fi.ModTime())
+		}
+		if level != "hash" || hashFlag == noHash {
+			continue
+		}
+		fresh := FileDetail{path: f.path, size: fi.Size(), mtime: fi.ModTime(), sparse: f.sparse}
+		h, err := hash(&fresh, false)
+		if err != nil {
+			return fmt.Errorf("can't verify %s: %v", f.path, err)
+		}
+		if h != g.hash {
+			return fmt.Errorf("%s has %s %s now instead of %s", f.path, hashFlag, h, g.hash)
+		}
+	}
+	if level == "hash" && hashFlag == noHash {
+		// without hashes the files are compared again
+		classes, err := compareMany(g.files)
+		if err != nil {
+			return fmt.Errorf("can't verify: %v", err)
+		}
+		if len(classes) != 1 || len(classes[0]) != len(g.files) {
+			return fmt.Errorf("files don't have the same content any more")
+		}
+	}
+	return nil
+}
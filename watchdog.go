@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// how long to wait for a scan root that became unavailable, e.g. a dropped network share, to come back
+var sourceWaitFlag time.Duration
+
+// the scan root was gone longer than -source-wait
+var errSourceGone = errors.New("scan root unavailable")
+
+// one goroutine waits for the root at a time, the others wait for it
+var sourceMu sync.Mutex
+
+// whether root can still be listed
+func rootAvailable(root string) bool {
+	f, err := os.Open(root)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	_, err = f.Readdirnames(1)
+	return err == nil || err == io.EOF
+}
+
+// the scan root path is under, a -reference root or the base dir
+func rootOf(path string) string {
+	for _, r := range referencesOutside(basedir) {
+		if isUnder(checkpointKey(path), r) {
+			return r
+		}
+	}
+	return basedir
+}
+
+// check root after an operation failed with err: err is returned when root is there,
+// so that it's about the file, otherwise it waits for root with growing pauses and
+// returns nil once root is back, for the operation to be retried, or errSourceGone
+// after -source-wait
+func awaitRoot(root string, err error) error {
+	if root == empty || rootAvailable(root) {
+		return err
+	}
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+	start := time.Now()
+	if rootAvailable(root) {
+		return nil
+	}
+	log.Printf("%s became unavailable (%v), waiting up to %v for it to come back\n", root, err, sourceWaitFlag)
+	for pause := time.Second; !rootAvailable(root); pause *= 2 {
+		left := sourceWaitFlag - time.Since(start)
+		if left <= 0 {
+			return fmt.Errorf("%w: %s for %v, last error: %v", errSourceGone, root, sourceWaitFlag, err)
+		}
+		if pause > 30*time.Second {
+			pause = 30 * time.Second
+		}
+		if pause > left {
+			pause = left
+		}
+		time.Sleep(pause)
+	}
+	log.Printf("%s is back after %v, continuing\n", root, time.Since(start).Round(time.Second))
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+// extended attributes are only read on Linux
+const xattrSupported = false
+
+func listXattrs(path string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+func setXattr(path, name string, value []byte) error {
+	return errNotSupported
+}
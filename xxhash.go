@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// XXH64 with seed 0, see https://github.com/Cyan4973/xxHash/blob/dev/doc/xxhash_spec.md
+var (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+type xxhash64 struct {
+	v     [4]uint64
+	total uint64
+	mem   [32]byte
+	n     int
+}
+
+func newXXHash64() *xxhash64 {
+	x := &xxhash64{}
+	x.Reset()
+	return x
+}
+
+func (x *xxhash64) Reset() {
+	x.v = [4]uint64{xxPrime1 + xxPrime2, xxPrime2, 0, -xxPrime1}
+	x.total, x.n = 0, 0
+}
+
+func (x *xxhash64) Size() int      { return 8 }
+func (x *xxhash64) BlockSize() int { return 32 }
+
+func xxRound(acc, input uint64) uint64 {
+	return bits.RotateLeft64(acc+input*xxPrime2, 31) * xxPrime1
+}
+
+func xxMerge(acc, v uint64) uint64 {
+	return (acc^xxRound(0, v))*xxPrime1 + xxPrime4
+}
+
+// consume one 32 byte stripe
+func (x *xxhash64) stripe(b []byte) {
+	for i := range x.v {
+		x.v[i] = xxRound(x.v[i], binary.LittleEndian.Uint64(b[8*i:]))
+	}
+}
+
+func (x *xxhash64) Write(b []byte) (int, error) {
+	n := len(b)
+	x.total += uint64(n)
+	if x.n > 0 {
+		c := copy(x.mem[x.n:], b)
+		x.n += c
+		b = b[c:]
+		if x.n < 32 {
+			return n, nil
+		}
+		x.stripe(x.mem[:])
+		x.n = 0
+	}
+	for ; len(b) >= 32; b = b[32:] {
+		x.stripe(b)
+	}
+	x.n = copy(x.mem[:], b)
+	return n, nil
+}
+
+func (x *xxhash64) Sum64() uint64 {
+	var h uint64
+	if x.total >= 32 {
+		h = bits.RotateLeft64(x.v[0], 1) + bits.RotateLeft64(x.v[1], 7) + bits.RotateLeft64(x.v[2], 12) + bits.RotateLeft64(x.v[3], 18)
+		for _, v := range x.v {
+			h = xxMerge(h, v)
+		}
+	} else {
+		h = xxPrime5
+	}
+	h += x.total
+	b := x.mem[:x.n]
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func (x *xxhash64) Sum(b []byte) []byte {
+	return appendUint(b, x.Sum64(), 8)
+}